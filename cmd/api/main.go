@@ -2,10 +2,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -17,6 +20,7 @@ import (
 	"github.com/nikojunttila/community/internal/logger"
 	customMW "github.com/nikojunttila/community/internal/middleware"
 	"github.com/nikojunttila/community/internal/routes"
+	"github.com/nikojunttila/community/internal/services/audit"
 	"github.com/nikojunttila/community/internal/services/cron"
 	"github.com/nikojunttila/community/internal/services/email"
 	"github.com/nikojunttila/community/internal/utility"
@@ -50,6 +54,7 @@ func main() {
 	logger.Setup()
 	db.InitDefault()
 	auth.Setup()
+	audit.Setup()
 	email.EmailerInit(&email.Mailer)
 	cron.Setup()
 
@@ -77,8 +82,24 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
-	log.Info().Msgf("Listening at: %s", portAddr)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatal().Err(err).Msg("HTTP server error")
+	go func() {
+		log.Info().Msgf("Listening at: %s", portAddr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal().Err(err).Msg("HTTP server error")
+		}
+	}()
+
+	// Finish the requests in flight and write their audit logs before exiting
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+	log.Info().Msg("Shutting down")
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("HTTP server shutdown error")
+	}
+	if err := audit.Close(ctx); err != nil {
+		log.Error().Err(err).Msg("Audit logs were not flushed")
 	}
 }
@@ -0,0 +1,145 @@
+// Package main checks the admin audit log for tampering
+//
+//	go run ./cmd/auditchain genkey      prints a new key entry for AUDIT_CHECKPOINT_KEYS
+//	go run ./cmd/auditchain pubkeys     prints the public keys of AUDIT_CHECKPOINT_KEYS
+//	go run ./cmd/auditchain checkpoint  signs the current head of the chain and prints it as JSON
+//	go run ./cmd/auditchain verify [checkpoint.json ...]
+//	                                    walks the chain and checks every checkpoint
+//	go run ./cmd/auditchain archive     archives and deletes logs past AUDIT_RETENTION_DAYS
+//
+// verify exits with status 1 and names the first broken log when the chain doesn't match.
+// Checkpoints stored in the database prove nothing about logs deleted together with them,
+// so export them off-host: save the JSON printed by checkpoint (or logged by the server
+// every 15 minutes) somewhere the database host can't write, and pass the newest copy to
+// verify. verify then fails when the chain is shorter than that checkpoint.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/services/audit"
+	"github.com/rs/zerolog/log"
+)
+
+const usage = `usage: auditchain genkey|pubkeys|checkpoint|verify [checkpoint.json ...]|archive
+
+Checkpoints in the database can be deleted along with the logs. Keep the JSON printed
+by checkpoint off-host and pass it to verify to catch a truncated chain.`
+
+func main() {
+	if len(os.Args) < 2 || (len(os.Args) > 2 && os.Args[1] != "verify") {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	if os.Args[1] == "genkey" {
+		seed, public, err := audit.GenerateCheckpointKey()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate key")
+		}
+		fmt.Printf("%s:%s\npublic key: %s\n", time.Now().UTC().Format("20060102"), seed, public)
+		return
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Warn().Err(err).Msg("No .env file, using environment")
+	}
+	if err := audit.LoadCheckpointKeys(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load audit checkpoint keys")
+	}
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "pubkeys":
+		for id, key := range audit.CheckpointPublicKeys() {
+			fmt.Printf("%s:%s\n", id, key)
+		}
+	case "checkpoint":
+		db.InitDefault()
+		cp, created, err := audit.CreateCheckpoint(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create checkpoint")
+		}
+		if !created {
+			log.Info().Msg("No new logs since the last checkpoint, printing the latest one")
+			if cp, err = audit.LatestCheckpoint(ctx); err != nil {
+				log.Fatal().Err(err).Msg("Failed to read the latest checkpoint")
+			}
+		}
+		log.Info().Msgf("Checkpoint %d covers %d logs up to log %d, keep the JSON below off-host", cp.ID, cp.LogCount, cp.LastLogID)
+		if err := json.NewEncoder(os.Stdout).Encode(audit.ExportCheckpoint(cp)); err != nil {
+			log.Fatal().Err(err).Msg("Failed to print checkpoint")
+		}
+	case "verify":
+		var external []audit.ExportedCheckpoint
+		for _, path := range os.Args[2:] {
+			cp, err := readCheckpoint(path)
+			if err != nil {
+				log.Fatal().Err(err).Msgf("Failed to read checkpoint %s", path)
+			}
+			external = append(external, cp)
+		}
+		if len(external) == 0 {
+			log.Warn().Msg("No external checkpoint given, logs deleted together with their checkpoints go unnoticed")
+		}
+		db.InitDefault()
+		v, err := audit.Verify(ctx, external...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to read the audit log")
+		}
+		log.Info().Msgf("Checked %d chained logs and %d checkpoints, %d logs predate the chain, %d were archived",
+			v.Checked, v.Checkpoints, v.Unchained, v.Archived)
+		if !v.OK() {
+			if v.BrokenAt != 0 {
+				log.Error().Msgf("Chain broken at log %d: %s", v.BrokenAt, v.Problem)
+			} else {
+				log.Error().Msgf("Chain broken: %s", v.Problem)
+			}
+			os.Exit(1)
+		}
+		log.Info().Msg("Audit log is intact")
+	case "archive":
+		if err := audit.LoadRetention(); err != nil {
+			log.Fatal().Err(err).Msg("Failed to load audit retention settings")
+		}
+		if !audit.RetentionEnabled() {
+			log.Fatal().Msg("AUDIT_RETENTION_DAYS is not set, logs are kept forever")
+		}
+		db.InitDefault()
+		archive, created, err := audit.ArchiveExpired(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to archive audit logs")
+		}
+		if !created {
+			log.Info().Msg("No audit logs past the retention period")
+			return
+		}
+		log.Info().Msgf("Archived %d logs to %s", archive.LogCount, archive.File)
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
+
+// readCheckpoint reads a checkpoint saved from the output of the checkpoint command
+func readCheckpoint(path string) (audit.ExportedCheckpoint, error) {
+	var cp audit.ExportedCheckpoint
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return cp, err
+	}
+	if err := json.Unmarshal(raw, &cp); err != nil {
+		return cp, err
+	}
+	if cp.Signature == "" {
+		return cp, errors.New("checkpoint is not signed")
+	}
+	return cp, nil
+}
@@ -0,0 +1,103 @@
+// Package main builds the offline breached password files used by PASSWORD_BREACHED_DIR
+//
+//	go run ./cmd/breachedpasswords import <dir> < passwords.txt
+//
+// Every input line is either a password or an uppercase SHA-1 with an optional :COUNT,
+// e.g. a full Have I Been Pwned hash list. Entries are merged into <dir>/<PREFIX>.txt
+// range files. The Have I Been Pwned downloader can write the range files directly.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/rs/zerolog/log"
+)
+
+var sha1Line = regexp.MustCompile(`^[0-9A-F]{40}(:[0-9]+)?$`)
+
+func main() {
+	if len(os.Args) != 3 || os.Args[1] != "import" {
+		fmt.Println("usage: breachedpasswords import <dir> < passwords.txt")
+		os.Exit(2)
+	}
+	dir := os.Args[2]
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatal().Err(err).Msgf("Failed to create %s", dir)
+	}
+
+	// prefix -> suffix -> count
+	ranges := map[string]map[string]int{}
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var lines int
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		prefix, suffix, count := parseLine(line)
+		if ranges[prefix] == nil {
+			ranges[prefix] = map[string]int{}
+		}
+		ranges[prefix][suffix] += count
+		lines++
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to read input")
+	}
+
+	for prefix, suffixes := range ranges {
+		if err := mergeRange(filepath.Join(dir, prefix+".txt"), suffixes); err != nil {
+			log.Fatal().Err(err).Msgf("Failed to write range %s", prefix)
+		}
+	}
+	log.Info().Msgf("Imported %d entries into %d range files", lines, len(ranges))
+}
+
+// parseLine returns the range of a hash line, or of the hashed password
+func parseLine(line string) (prefix, suffix string, count int) {
+	if sha1Line.MatchString(line) {
+		hash, rawCount, _ := strings.Cut(line, ":")
+		count = 1
+		if n, err := strconv.Atoi(rawCount); err == nil {
+			count = n
+		}
+		return hash[:5], hash[5:], count
+	}
+	prefix, suffix = auth.BreachedPasswordHash(line)
+	return prefix, suffix, 1
+}
+
+// mergeRange adds the counts to the existing range file and rewrites it sorted by suffix
+func mergeRange(path string, suffixes map[string]int) error {
+	if existing, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(existing), "\n") {
+			suffix, rawCount, ok := strings.Cut(strings.TrimSpace(line), ":")
+			if !ok {
+				continue
+			}
+			count, _ := strconv.Atoi(rawCount)
+			suffixes[suffix] += count
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	sorted := make([]string, 0, len(suffixes))
+	for suffix := range suffixes {
+		sorted = append(sorted, suffix)
+	}
+	sort.Strings(sorted)
+	var b strings.Builder
+	for _, suffix := range sorted {
+		fmt.Fprintf(&b, "%s:%d\n", suffix, suffixes[suffix])
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
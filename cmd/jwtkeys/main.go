@@ -0,0 +1,97 @@
+// Package main manages the keys access tokens are signed with
+//
+//	go run ./cmd/jwtkeys generate [EdDSA|RS256]  adds a signing key to JWT_KEY_DIR
+//	go run ./cmd/jwtkeys rotate [EdDSA|RS256]    adds a signing key and retires all but the previous one
+//	go run ./cmd/jwtkeys prune                   deletes retired keys whose tokens have expired
+//	go run ./cmd/jwtkeys list                    prints the keys and which one signs
+//
+// The newest private key signs new tokens after a restart, every key in the dir verifies them
+// and is published at /.well-known/jwks.json. Retired keys keep only their public half.
+// Prune deletes them once the access tokens they signed have expired and keeps the rest.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/utility"
+	"github.com/rs/zerolog/log"
+)
+
+const usage = "usage: jwtkeys generate|rotate [EdDSA|RS256] | prune | list"
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+	if err := godotenv.Load(); err != nil {
+		log.Warn().Err(err).Msg("No .env file, using environment")
+	}
+	dir := utility.GetEnv("JWT_KEY_DIR")
+	alg := "EdDSA"
+	if len(os.Args) > 2 {
+		alg = os.Args[2]
+	}
+
+	switch os.Args[1] {
+	case "generate":
+		kid, err := auth.GenerateJWTKey(dir, alg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate key")
+		}
+		log.Info().Msgf("Generated %s key %s", alg, kid)
+
+	case "rotate":
+		// The previous signing key stays private so servers that haven't restarted yet keep working
+		previous, err := auth.LoadJWTKeys(dir, "")
+		if err != nil && !os.IsNotExist(err) && !errors.Is(err, auth.ErrNoSigningKey) {
+			log.Fatal().Err(err).Msg("Failed to load current keys")
+		}
+		kid, err := auth.GenerateJWTKey(dir, alg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate key")
+		}
+		keep := []string{kid}
+		if previous.Active != nil {
+			keep = append(keep, previous.Active.KeyID())
+		}
+		retired, err := auth.RetireJWTKeys(dir, keep...)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Generated key %s but failed to retire old keys", kid)
+		}
+		log.Info().Msgf("Generated %s key %s, retired %s", alg, kid, strings.Join(retired, ", "))
+
+	case "prune":
+		pruned, kept, err := auth.PruneJWTKeys(dir)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to prune keys")
+		}
+		log.Info().Msgf("Pruned %d keys %s", len(pruned), strings.Join(pruned, ", "))
+		if len(kept) > 0 {
+			log.Info().Msgf("Kept %d recently retired keys %s, tokens they signed may still be valid", len(kept), strings.Join(kept, ", "))
+		}
+
+	case "list":
+		keyring, err := auth.LoadJWTKeys(dir, utility.GetEnvDefault("JWT_SIGNING_KEY_ID", ""))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load keys")
+		}
+		for i := 0; i < keyring.Public.Len(); i++ {
+			key, _ := keyring.Public.Key(i)
+			marker := ""
+			if key.KeyID() == keyring.Active.KeyID() {
+				marker = " (signing)"
+			}
+			fmt.Printf("%s %s%s\n", key.KeyID(), key.Algorithm(), marker)
+		}
+
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
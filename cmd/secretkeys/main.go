@@ -0,0 +1,61 @@
+// Package main encrypts TOTP secrets at rest and rotates their encryption key
+//
+//	go run ./cmd/secretkeys genkey   prints a new key entry for SECRET_ENCRYPTION_KEYS
+//	go run ./cmd/secretkeys migrate  seals secrets still stored as plaintext
+//	go run ./cmd/secretkeys rotate   re-encrypts every secret with SECRET_ENCRYPTION_KEY_ID
+//
+// To rotate, add the new key to SECRET_ENCRYPTION_KEYS, point SECRET_ENCRYPTION_KEY_ID at it,
+// restart the servers and run rotate. Old keys can be removed once rotate reports no failures.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("usage: secretkeys genkey|migrate|rotate")
+		os.Exit(2)
+	}
+
+	if os.Args[1] == "genkey" {
+		key, err := auth.GenerateSecretKey()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate key")
+		}
+		fmt.Printf("%s:%s\n", time.Now().UTC().Format("20060102"), key)
+		return
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Warn().Err(err).Msg("No .env file, using environment")
+	}
+	db.InitDefault()
+	if err := auth.LoadSecretKeys(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load secret encryption keys")
+	}
+
+	var rotate bool
+	switch os.Args[1] {
+	case "migrate":
+	case "rotate":
+		rotate = true
+	default:
+		fmt.Println("usage: secretkeys genkey|migrate|rotate")
+		os.Exit(2)
+	}
+	updated, err := userService.ResealTOTPSecrets(context.Background(), rotate)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Stopped after updating %d secrets", updated)
+	}
+	log.Info().Msgf("Updated %d secrets", updated)
+}
@@ -5,11 +5,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/nikojunttila/community/internal/db"
 	"github.com/nikojunttila/community/internal/logger"
-	"github.com/nikojunttila/community/internal/utility"
 )
 
 var tokenAuth *jwtauth.JWTAuth
@@ -21,35 +23,152 @@ func GetTokenAuth() *jwtauth.JWTAuth {
 
 // Setup is used to initiate auth system on startup
 func Setup() {
-	secret := utility.GetEnv("JWT_SECRET")
-	tokenAuth = jwtauth.New("HS256", []byte(secret), nil)
+	setupTokenAuth()
+	setupSecretKeys()
+	setupEmailVerification()
+	setupWebAuthn()
+	setupPasswordPolicy()
 	newAuth()
 }
 
 // define claim keys to avoid typos
 const (
-	ClaimLookupID = "lookupID"
-	ClaimRole     = "role"
-	Admin         = "admin"
-	User          = "user"
+	ClaimLookupID    = "lookupID"
+	ClaimRole        = "role"
+	ClaimSessionID   = "sid"
+	ClaimTokenID     = jwt.JwtIDKey
+	ClaimAMR         = "amr"
+	ClaimMFAPending  = "mfa_pending"
+	ClaimActor       = "act"   // RFC 8693 actor, {"sub": lookupID of the impersonating admin}
+	ClaimPermissions = "perms" // permissions of the role, informational, RequirePermission resolves them again
+	Admin            = "admin"
+	Moderator        = "moderator"
+	User             = "user"
+	Unverified       = "unverified" // role of email users that haven't confirmed their address yet
 )
 
-// MakeToken creates a signed JWT for the given user lookupID and optional role
-func MakeToken(lookupID string, role ...string) string {
+// Authentication method references (RFC 8176) recorded in the amr claim
+const (
+	AMRPassword  = "pwd"
+	AMRFederated = "fed" // OAuth provider login
+	AMROTP       = "otp"
+	AMRRecovery  = "rec" // one-time recovery code used instead of the OTP
+	AMRPasskey   = "hwk" // WebAuthn credential, proof of possession of a key
+)
+
+// MFAPendingTTL is the lifetime of a session that passed the password but not the second factor yet
+const MFAPendingTTL = 5 * time.Minute
+
+// AccessClaims are the user specific values signed into an access token
+type AccessClaims struct {
+	TokenID     string // jti, generated when empty
+	LookupID    string
+	SessionID   string
+	Role        string
+	AMR         []string // authentication methods the session was established with
+	MFAPending  bool     // first factor passed, second factor still required
+	Actor       string   // lookupID of the admin impersonating the user, see Impersonate
+	Permissions []string // resolved permissions of Role, see RolePermissions
+}
+
+// MakeToken creates a signed short-lived access token for the given claims.
+// Every token gets a unique jti so it can be revoked before it expires.
+func MakeToken(ac AccessClaims) (string, time.Time, error) {
+	if ac.TokenID == "" {
+		ac.TokenID = uuid.New().String()
+	}
+	now := time.Now()
+	ttl := AccessTokenTTL
+	if ac.MFAPending {
+		ttl = MFAPendingTTL
+	}
+	if ac.Actor != "" {
+		ttl = ImpersonationTTL
+	}
+	expiresAt := now.Add(ttl)
 	claims := map[string]any{
-		ClaimLookupID: lookupID,
+		ClaimLookupID:  ac.LookupID,
+		ClaimSessionID: ac.SessionID,
+		ClaimTokenID:   ac.TokenID,
+		ClaimAMR:       ac.AMR,
+	}
+	if ac.Role != "" {
+		claims[ClaimRole] = ac.Role
+	}
+	if ac.MFAPending {
+		claims[ClaimMFAPending] = true
+	}
+	if ac.Actor != "" {
+		claims[ClaimActor] = map[string]any{"sub": ac.Actor}
+	}
+	if len(ac.Permissions) > 0 {
+		claims[ClaimPermissions] = ac.Permissions
+	}
+	jwtauth.SetIssuedAt(claims, now)
+	jwtauth.SetExpiry(claims, expiresAt)
+
+	_, tokenString, err := tokenAuth.Encode(claims)
+	if err != nil {
+		return "", time.Time{}, err
 	}
-	if len(role) > 0 {
-		claims[ClaimRole] = role[0]
+	return tokenString, expiresAt, nil
+}
+
+// AMRFromClaims returns the authentication methods recorded in the token claims
+func AMRFromClaims(claims map[string]any) []string {
+	raw, _ := claims[ClaimAMR].([]any)
+	methods := make([]string, 0, len(raw))
+	for _, m := range raw {
+		if method, ok := m.(string); ok {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// HasSecondFactor reports whether any of the methods is a second factor
+func HasSecondFactor(methods []string) bool {
+	for _, m := range methods {
+		if m == AMROTP || m == AMRRecovery || m == AMRPasskey {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresSecondFactor reports whether the user has TOTP or a passkey enrolled
+func RequiresSecondFactor(ctx context.Context, user db.User) (bool, error) {
+	if user.Secret != "" {
+		return true, nil
 	}
+	passkeys, err := db.Get().CountWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return passkeys > 0, nil
+}
 
-	_, tokenString, _ := tokenAuth.Encode(claims)
-	return tokenString
+// IsMFAPending reports whether the token claims belong to a session still waiting for its second factor
+func IsMFAPending(claims map[string]any) bool {
+	pending, _ := claims[ClaimMFAPending].(bool)
+	return pending
 }
 
 var errLookupIDMissing = errors.New("lookupID not found in token")
 var errUserNotFound = errors.New("user not found in database")
 
+// ErrUserSuspended indicates the user has been disabled by an admin.
+var ErrUserSuspended = errors.New("user is suspended")
+
+// IsSuspended reports whether the user is disabled right now. A suspension with an
+// end time lifts itself once that time has passed.
+func IsSuspended(user db.User) bool {
+	if !user.Disabled {
+		return false
+	}
+	return !user.SuspendedUntil.Valid || time.Now().Before(user.SuspendedUntil.Time)
+}
+
 // GetUserLookupID returns lookup id from context
 func GetUserLookupID(ctx context.Context) (string, error) {
 	_, claims, err := jwtauth.FromContext(ctx)
@@ -79,5 +198,8 @@ func GetUserFromContext(ctx context.Context) (db.User, error) {
 		logger.Error(ctx, err, fmt.Sprintf("no user found for lookupID %s", lookupID))
 		return db.User{}, errUserNotFound
 	}
+	if IsSuspended(user) {
+		return db.User{}, ErrUserSuspended
+	}
 	return user, nil
 }
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// breachedPrefixLength is the number of hex characters of the SHA-1 naming each range file
+const breachedPrefixLength = 5
+
+// BreachedPasswords looks passwords up in an offline copy of a breached password corpus,
+// laid out like the Have I Been Pwned range API: the directory holds one file per SHA-1
+// prefix, e.g. 5BAA6.txt, with SUFFIX:COUNT lines. Only the file of the password's prefix is read.
+type BreachedPasswords struct {
+	dir string
+}
+
+// OpenBreachedPasswords uses the range files in dir, written by go run ./cmd/breachedpasswords
+// or by the Have I Been Pwned downloader
+func OpenBreachedPasswords(dir string) (*BreachedPasswords, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PASSWORD_BREACHED_DIR: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("PASSWORD_BREACHED_DIR %s is not a directory", dir)
+	}
+	return &BreachedPasswords{dir: dir}, nil
+}
+
+// BreachedPasswordHash returns the uppercase SHA-1 hex of the password split into the
+// range prefix and the suffix stored in the range file
+func BreachedPasswordHash(password string) (prefix, suffix string) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+}
+
+// Count returns how many times the password appears in the corpus
+func (b *BreachedPasswords) Count(password string) (int, error) {
+	prefix, suffix := BreachedPasswordHash(password)
+	file, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// No breached password has this prefix
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(line, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			// A listed hash without a count is still breached
+			return 1, nil
+		}
+		// Padding entries of the range API have a count of 0
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
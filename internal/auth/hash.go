@@ -1,17 +1,149 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrUnknownPasswordHash indicates the stored hash isn't in a format any hasher understands
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+// PasswordHasher hashes new passwords and verifies stored hashes
+type PasswordHasher interface {
+	// Hash returns the encoded hash of the password
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether the hash should be replaced with one from Hash
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idParams are the cost parameters of argon2id hashes
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follow the OWASP recommendation of 19 MiB memory and 2 iterations
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher writes PHC formatted argon2id hashes, e.g.
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>. Legacy bcrypt hashes still verify
+// but always need a rehash.
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+// NewArgon2idHasher returns a hasher using the given parameters
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{Params: params}
+}
+
+var passwordHasher PasswordHasher = NewArgon2idHasher(DefaultArgon2idParams)
+
+// SetPasswordHasher replaces the hasher used by HashPassword and CheckPasswordHash
+func SetPasswordHasher(hasher PasswordHasher) {
+	passwordHasher = hasher
+}
+
 // HashPassword hashes the password
 func HashPassword(password string) (string, error) {
-	hashBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashBytes), err
+	return passwordHasher.Hash(password)
 }
 
 // CheckPasswordHash compares password string and hash
 func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	ok, err := passwordHasher.Verify(password, hash)
+	return err == nil && ok
+}
+
+// PasswordNeedsRehash reports whether the stored hash uses an old algorithm or outdated parameters
+func PasswordNeedsRehash(hash string) bool {
+	return passwordHasher.NeedsRehash(hash)
+}
+
+// Hash implements PasswordHasher
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.Params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify implements PasswordHasher
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	if isBcryptHash(encoded) {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// NeedsRehash implements PasswordHasher
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params != h.Params
+}
+
+func isBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// decodeArgon2id parses a PHC formatted argon2id hash
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+	var params Argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2idParams{}, nil, nil, ErrUnknownPasswordHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
 }
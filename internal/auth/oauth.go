@@ -1,23 +1,53 @@
 package auth
 
 import (
+	"fmt"
 	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/gorilla/sessions"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
+	"github.com/markbates/goth/providers/discord"
+	"github.com/markbates/goth/providers/github"
 	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/openidConnect"
 	"github.com/nikojunttila/community/internal/utility"
+	"github.com/rs/zerolog/log"
 )
 
 const (
 	maxAge = 86400 * 30
 )
 
+// OAuthProviderConfig is a login provider read from the environment. For a provider named
+// corp the settings are OAUTH_CORP_CLIENT, OAUTH_CORP_SECRET, OAUTH_CORP_SCOPES (space or
+// comma separated), OAUTH_CORP_REDIRECT and, for providers other than google, discord and
+// github, OAUTH_CORP_DISCOVERY_URL of the OpenID Connect issuer.
+type OAuthProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+	DiscoveryURL string
+}
+
+// enabledProviders holds the names of the providers registered with goth in OAUTH_PROVIDERS order
+var enabledProviders []string
+
+// providerNamePattern keeps provider names usable as a path segment and in env variable names
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// OAuthProviderEnabled reports whether logging in with the provider is configured
+func OAuthProviderEnabled(name string) bool {
+	return slices.Contains(enabledProviders, name)
+}
+
 func newAuth() {
-	ClientID := utility.GetEnv("OAUTH_GOOGLE_CLIENT")
-	ClientSecret := utility.GetEnv("OAUTH_GOOGLE_SECRET")
-	redirectURL := utility.GetEnv("GOOGLE_REDIRECT")
 	key := utility.GetEnv("OAUTH_KEY")
 	var isProd bool
 	if prod := utility.GetEnv("PROD"); prod == "true" {
@@ -29,9 +59,99 @@ func newAuth() {
 	store.Options.Path = "/"
 	store.Options.HttpOnly = true
 	store.Options.Secure = isProd
-	store.Options.Domain = "localhost"
+	// Host only cookie unless a domain is configured
+	store.Options.Domain = os.Getenv("OAUTH_COOKIE_DOMAIN")
 	store.Options.SameSite = http.SameSiteLaxMode
 
 	gothic.Store = store
-	goth.UseProviders(google.New(ClientID, ClientSecret, redirectURL))
+
+	var providers []goth.Provider
+	for _, cfg := range oauthProviderConfigs() {
+		provider, err := newOAuthProvider(cfg)
+		if err != nil {
+			// One broken issuer shouldn't keep the other logins from working
+			log.Error().Err(err).Msgf("OAuth provider %s is disabled", cfg.Name)
+			continue
+		}
+		providers = append(providers, provider)
+		enabledProviders = append(enabledProviders, cfg.Name)
+	}
+	goth.UseProviders(providers...)
+}
+
+// oauthProviderConfigs reads the providers listed in OAUTH_PROVIDERS. Without the list
+// google is enabled when OAUTH_GOOGLE_CLIENT is set, like before providers were configurable.
+func oauthProviderConfigs() []OAuthProviderConfig {
+	list := os.Getenv("OAUTH_PROVIDERS")
+	if list == "" && os.Getenv("OAUTH_GOOGLE_CLIENT") != "" {
+		list = "google"
+	}
+	var configs []OAuthProviderConfig
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !providerNamePattern.MatchString(name) {
+			log.Fatal().Msgf("OAUTH_PROVIDERS contains an invalid provider name %q", name)
+		}
+		prefix := oauthEnvPrefix(name)
+		redirect := os.Getenv(prefix + "REDIRECT")
+		if redirect == "" && name == "google" {
+			redirect = os.Getenv("GOOGLE_REDIRECT")
+		}
+		if redirect == "" {
+			redirect = strings.TrimSuffix(utility.GetEnvDefault("APP_URL", ""), "/") + "/public/" + name + "/callback"
+		}
+		configs = append(configs, OAuthProviderConfig{
+			Name:         name,
+			ClientID:     utility.GetEnv(prefix + "CLIENT"),
+			ClientSecret: utility.GetEnv(prefix + "SECRET"),
+			Scopes:       strings.FieldsFunc(os.Getenv(prefix+"SCOPES"), func(r rune) bool { return r == ',' || r == ' ' }),
+			RedirectURL:  redirect,
+			DiscoveryURL: os.Getenv(prefix + "DISCOVERY_URL"),
+		})
+	}
+	return configs
+}
+
+// newOAuthProvider builds the goth provider. Names other than the built in ones are
+// OpenID Connect providers found with the discovery document.
+func newOAuthProvider(cfg OAuthProviderConfig) (goth.Provider, error) {
+	switch cfg.Name {
+	case "google":
+		return google.New(cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, cfg.Scopes...), nil
+	case "discord":
+		scopes := cfg.Scopes
+		if len(scopes) == 0 {
+			// identify alone doesn't return the email address
+			scopes = []string{discord.ScopeIdentify, discord.ScopeEmail}
+		}
+		return discord.New(cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, scopes...), nil
+	case "github":
+		scopes := cfg.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"read:user", "user:email"}
+		}
+		return github.New(cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, scopes...), nil
+	}
+	if cfg.DiscoveryURL == "" {
+		return nil, fmt.Errorf("%sDISCOVERY_URL is required for OpenID Connect providers", oauthEnvPrefix(cfg.Name))
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	provider, err := openidConnect.New(cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, cfg.DiscoveryURL, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	// The name is the path segment in /public/{provider}/begin and the stored identity provider
+	provider.SetName(cfg.Name)
+	return provider, nil
+}
+
+// oauthEnvPrefix is the prefix of the provider's settings, OAUTH_MY_IDP_ for my-idp
+func oauthEnvPrefix(name string) string {
+	return "OAUTH_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
 }
@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/utility"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrPasswordPolicy indicates the password was rejected by the password policy.
+// The returned error is a *PasswordPolicyError telling the user why.
+var ErrPasswordPolicy = errors.New("password does not meet the password policy")
+
+// PasswordPolicyError is the reason a password was rejected, safe to show to the user
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string { return e.Reason }
+
+// Is makes errors.Is(err, ErrPasswordPolicy) match every policy violation
+func (e *PasswordPolicyError) Is(target error) bool { return target == ErrPasswordPolicy }
+
+// PasswordPolicy decides which passwords users may choose
+type PasswordPolicy struct {
+	MinLength int // in characters
+	MaxLength int // in characters, keeps hashing cheap enough
+	// MinScore is the lowest accepted strength score from 0 (too guessable) to 4 (very unguessable)
+	MinScore int
+	// Banned are lowercase passwords that are never accepted. They also count as single
+	// dictionary words when scoring longer passwords that contain them.
+	Banned map[string]struct{}
+	// Breached are known leaked passwords, nil disables the check
+	Breached *BreachedPasswords
+}
+
+// commonPasswords are banned even without PASSWORD_BANNED_FILE
+var commonPasswords = []string{
+	"password", "passw0rd", "123456", "12345678", "123456789", "1234567890", "qwerty", "qwertyuiop",
+	"abc123", "111111", "iloveyou", "admin", "welcome", "letmein", "monkey", "dragon", "football",
+	"baseball", "sunshine", "princess", "master", "shadow", "superman", "trustno1", "changeme",
+	"secret", "login", "starwars", "whatever", "community",
+}
+
+// DefaultPasswordPolicy is used until LoadPasswordPolicy reads the configuration
+func DefaultPasswordPolicy() *PasswordPolicy {
+	policy := &PasswordPolicy{
+		MinLength: 8,
+		MaxLength: 128,
+		MinScore:  2,
+		Banned:    make(map[string]struct{}, len(commonPasswords)),
+	}
+	for _, password := range commonPasswords {
+		policy.Banned[password] = struct{}{}
+	}
+	return policy
+}
+
+var passwordPolicy = DefaultPasswordPolicy()
+
+// setupPasswordPolicy loads the policy from env and exits if it is not usable
+func setupPasswordPolicy() {
+	if err := LoadPasswordPolicy(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load password policy")
+	}
+}
+
+// LoadPasswordPolicy reads PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_MIN_SCORE,
+// PASSWORD_BANNED_FILE (one password per line, added to the built in list) and
+// PASSWORD_BREACHED_DIR (see OpenBreachedPasswords).
+func LoadPasswordPolicy() error {
+	policy := DefaultPasswordPolicy()
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{"PASSWORD_MIN_LENGTH", &policy.MinLength},
+		{"PASSWORD_MAX_LENGTH", &policy.MaxLength},
+		{"PASSWORD_MIN_SCORE", &policy.MinScore},
+	} {
+		raw := utility.GetEnvDefault(setting.name, strconv.Itoa(*setting.value))
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return fmt.Errorf("%s must be a non-negative number, got %q", setting.name, raw)
+		}
+		*setting.value = value
+	}
+	if policy.MaxLength < policy.MinLength {
+		return fmt.Errorf("PASSWORD_MAX_LENGTH %d is below PASSWORD_MIN_LENGTH %d", policy.MaxLength, policy.MinLength)
+	}
+	if policy.MinScore > 4 {
+		return fmt.Errorf("PASSWORD_MIN_SCORE must be between 0 and 4, got %d", policy.MinScore)
+	}
+	if path := os.Getenv("PASSWORD_BANNED_FILE"); path != "" {
+		if err := policy.loadBanned(path); err != nil {
+			return err
+		}
+	}
+	if dir := os.Getenv("PASSWORD_BREACHED_DIR"); dir != "" {
+		breached, err := OpenBreachedPasswords(dir)
+		if err != nil {
+			return err
+		}
+		policy.Breached = breached
+	}
+	passwordPolicy = policy
+	return nil
+}
+
+func (p *PasswordPolicy) loadBanned(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open PASSWORD_BANNED_FILE: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if password := strings.ToLower(strings.TrimSpace(scanner.Text())); password != "" {
+			p.Banned[password] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
+
+// CheckPassword validates a new password of the user with the email against the configured policy
+func CheckPassword(ctx context.Context, password, email string) error {
+	return passwordPolicy.Check(ctx, password, email)
+}
+
+// Check returns a *PasswordPolicyError when the password isn't acceptable. Failing to read
+// the breached password list is logged and doesn't reject the password.
+func (p *PasswordPolicy) Check(ctx context.Context, password, email string) error {
+	length := len([]rune(password))
+	if length < p.MinLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("password must be at least %d characters", p.MinLength)}
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("password must be at most %d characters", p.MaxLength)}
+	}
+	lower := strings.ToLower(password)
+	if _, banned := p.Banned[lower]; banned {
+		return &PasswordPolicyError{Reason: "password is too common"}
+	}
+	if similarToEmail(lower, email) {
+		return &PasswordPolicyError{Reason: "password is too similar to the email address"}
+	}
+	if p.Score(password) < p.MinScore {
+		return &PasswordPolicyError{Reason: "password is too easy to guess, use a longer password or a few unrelated words"}
+	}
+	if p.Breached != nil {
+		count, err := p.Breached.Count(password)
+		if err != nil {
+			logger.Warn(ctx, err, "failed to check breached passwords")
+		} else if count > 0 {
+			return &PasswordPolicyError{Reason: "password has appeared in a data breach, choose another one"}
+		}
+	}
+	return nil
+}
+
+// similarToEmail reports whether the password contains the email's local part or domain
+// name, or is contained in the email
+func similarToEmail(lowerPassword, email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	if strings.Contains(email, lowerPassword) {
+		return true
+	}
+	local, domain, _ := strings.Cut(email, "@")
+	domain, _, _ = strings.Cut(domain, ".")
+	for _, part := range []string{local, domain} {
+		if len(part) >= 4 && strings.Contains(lowerPassword, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyboardSequences are runs people type instead of picking characters
+var keyboardSequences = []string{
+	"abcdefghijklmnopqrstuvwxyz", "01234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm",
+}
+
+// Score estimates how hard the password is to guess on zxcvbn's 0-4 scale. Banned
+// passwords inside the password count as one guess from the list, and repeated
+// characters or keyboard and alphabet sequences count as one bit per character.
+func (p *PasswordPolicy) Score(password string) int {
+	bits := passwordEntropy(strings.ToLower(password), passwordPool(password), p.Banned)
+	switch {
+	case bits < 20:
+		return 0
+	case bits < 30:
+		return 1
+	case bits < 40:
+		return 2
+	case bits < 55:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// passwordPool is the number of characters an attacker brute forcing the password would try
+func passwordPool(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	var pool float64
+	for _, class := range []struct {
+		used bool
+		size float64
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	return pool
+}
+
+// passwordEntropy estimates the bits of the lowercased password
+func passwordEntropy(lower string, pool float64, banned map[string]struct{}) float64 {
+	runes := []rune(lower)
+	charBits := math.Log2(pool)
+	wordBits := math.Log2(float64(len(banned)) + 1)
+	var bits float64
+	for i := 0; i < len(runes); {
+		if word := longestBannedWord(runes[i:], banned); word > 0 {
+			bits += wordBits
+			i += word
+			continue
+		}
+		if i > 0 && predictable(runes[i-1], runes[i]) {
+			bits++
+		} else {
+			bits += charBits
+		}
+		i++
+	}
+	return bits
+}
+
+// longestBannedWord returns the length of the longest banned password of at least
+// four characters the runes start with
+func longestBannedWord(runes []rune, banned map[string]struct{}) int {
+	for n := len(runes); n >= 4; n-- {
+		if _, ok := banned[string(runes[:n])]; ok {
+			return n
+		}
+	}
+	return 0
+}
+
+// predictable reports whether next repeats prev or continues a sequence from it
+func predictable(prev, next rune) bool {
+	if prev == next {
+		return true
+	}
+	for _, sequence := range keyboardSequences {
+		i := strings.IndexRune(sequence, prev)
+		if i < 0 {
+			continue
+		}
+		if (i+1 < len(sequence) && rune(sequence[i+1]) == next) || (i > 0 && rune(sequence[i-1]) == next) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+)
+
+// Permissions granted to roles in role_permissions, checked with middleware.RequirePermission
+const (
+	PermAdminAccess       = "admin:access" // any /admin route
+	PermUsersRead         = "users:read"
+	PermUsersWrite        = "users:write"
+	PermUsersSuspend      = "users:suspend"
+	PermUsersImpersonate  = "users:impersonate"
+	PermAuditRead         = "audit:read"
+	PermRolesRead         = "roles:read"
+	PermRolesWrite        = "roles:write"
+	PermOAuthClientsWrite = "oauth_clients:write"
+)
+
+// permissionCacheTTL bounds how long another instance keeps using permissions changed elsewhere.
+// Changes made through this instance call InvalidatePermissions and apply immediately.
+const permissionCacheTTL = time.Minute
+
+// ErrUnknownRole indicates the role isn't in the roles table.
+var ErrUnknownRole = errors.New("unknown role")
+
+// permissionPattern is resource:action, lowercase
+var permissionPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*:[a-z][a-z0-9_]*$`)
+
+// ValidPermission reports whether the permission has the resource:action form
+func ValidPermission(permission string) bool {
+	return permissionPattern.MatchString(permission)
+}
+
+// RoleGraph resolves the permissions of roles through their parent roles
+type RoleGraph struct {
+	parents     map[string]string
+	permissions map[string][]string
+}
+
+// NewRoleGraph builds the graph from the roles and role_permissions tables
+func NewRoleGraph(roles []db.Role, permissions []db.RolePermission) *RoleGraph {
+	g := &RoleGraph{
+		parents:     make(map[string]string, len(roles)),
+		permissions: make(map[string][]string, len(roles)),
+	}
+	for _, role := range roles {
+		g.parents[role.Name] = role.ParentRole
+	}
+	for _, p := range permissions {
+		g.permissions[p.Role] = append(g.permissions[p.Role], p.Permission)
+	}
+	return g
+}
+
+// Exists reports whether the role is defined
+func (g *RoleGraph) Exists(role string) bool {
+	_, ok := g.parents[role]
+	return ok
+}
+
+// ancestors returns the role followed by its parents. A cycle stops at the first repeated role.
+func (g *RoleGraph) ancestors(role string) []string {
+	var chain []string
+	for role != "" && g.Exists(role) && !slices.Contains(chain, role) {
+		chain = append(chain, role)
+		role = g.parents[role]
+	}
+	return chain
+}
+
+// Inherits reports whether role is ancestor or has it as a parent, grandparent and so on
+func (g *RoleGraph) Inherits(role, ancestor string) bool {
+	return slices.Contains(g.ancestors(role), ancestor)
+}
+
+// Permissions returns the sorted permissions of the role, including inherited ones
+func (g *RoleGraph) Permissions(role string) []string {
+	var permissions []string
+	for _, r := range g.ancestors(role) {
+		for _, p := range g.permissions[r] {
+			if !slices.Contains(permissions, p) {
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	slices.Sort(permissions)
+	return permissions
+}
+
+// Has reports whether the role has the permission, directly or inherited
+func (g *RoleGraph) Has(role, permission string) bool {
+	return slices.Contains(g.Permissions(role), permission)
+}
+
+var permissionCache struct {
+	sync.Mutex
+	graph    *RoleGraph
+	loadedAt time.Time
+}
+
+// InvalidatePermissions drops the cached roles so the next check reloads them
+func InvalidatePermissions() {
+	permissionCache.Lock()
+	defer permissionCache.Unlock()
+	permissionCache.graph = nil
+}
+
+// Roles returns the cached role graph, reloading it when it is older than permissionCacheTTL
+func Roles(ctx context.Context) (*RoleGraph, error) {
+	permissionCache.Lock()
+	defer permissionCache.Unlock()
+	if permissionCache.graph != nil && time.Since(permissionCache.loadedAt) < permissionCacheTTL {
+		return permissionCache.graph, nil
+	}
+	roles, err := db.Get().ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := db.Get().ListRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	permissionCache.graph = NewRoleGraph(roles, permissions)
+	permissionCache.loadedAt = time.Now()
+	return permissionCache.graph, nil
+}
+
+// RolePermissions returns the permissions of the role, including inherited ones
+func RolePermissions(ctx context.Context, role string) ([]string, error) {
+	g, err := Roles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return g.Permissions(role), nil
+}
+
+// RoleHasPermission reports whether the role has the permission, directly or inherited
+func RoleHasPermission(ctx context.Context, role, permission string) (bool, error) {
+	g, err := Roles(ctx)
+	if err != nil {
+		return false, err
+	}
+	return g.Has(role, permission), nil
+}
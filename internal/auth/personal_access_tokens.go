@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token so the Verifier can tell them from JWTs
+const PersonalAccessTokenPrefix = "pat_"
+
+const (
+	// DefaultPersonalAccessTokenTTL is used when the user doesn't pick an expiry
+	DefaultPersonalAccessTokenTTL = 30 * 24 * time.Hour
+	// MaxPersonalAccessTokenTTL is the longest a personal access token may live
+	MaxPersonalAccessTokenTTL = 365 * 24 * time.Hour
+	// patDisplayLength is how many characters of the token are stored in the clear for display
+	patDisplayLength = len(PersonalAccessTokenPrefix) + 8
+	// patTouchInterval limits how often last_used_at is written
+	patTouchInterval = time.Minute
+)
+
+// Scopes of personal access tokens
+const (
+	ScopeRead  = "read"  // GET and HEAD requests
+	ScopeWrite = "write" // every method, implies read
+	ScopeAdmin = "admin" // keeps the role of users with admin:access, without it they act as a user
+)
+
+// PersonalAccessTokenScopes are the scopes a personal access token can be created with
+var PersonalAccessTokenScopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// Claims only present on requests authenticated with a personal access token
+const (
+	ClaimPersonalAccessToken = "pat" // id of the personal access token
+	ClaimScopes              = "scp"
+)
+
+// ErrInvalidAccessTokenParams indicates a personal access token without a name, with unknown scopes or a bad expiry.
+var ErrInvalidAccessTokenParams = errors.New("token needs a name, scopes out of read, write and admin and an expiry of at most a year")
+
+// ErrPersonalAccessTokenInvalid indicates the personal access token is unknown, revoked or expired.
+var ErrPersonalAccessTokenInvalid = errors.New("personal access token is invalid or expired")
+
+// CreatePersonalAccessToken stores a new token for the user. The returned token is only shown
+// once, the database keeps its hash and a short prefix to recognise it by.
+func CreatePersonalAccessToken(ctx context.Context, user db.User, name string, scopes []string, ttl time.Duration) (db.PersonalAccessToken, string, error) {
+	name = strings.TrimSpace(name)
+	if ttl == 0 {
+		ttl = DefaultPersonalAccessTokenTTL
+	}
+	if name == "" || len(scopes) == 0 || ttl < 0 || ttl > MaxPersonalAccessTokenTTL {
+		return db.PersonalAccessToken{}, "", ErrInvalidAccessTokenParams
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(PersonalAccessTokenScopes, scope) {
+			return db.PersonalAccessToken{}, "", ErrInvalidAccessTokenParams
+		}
+	}
+	if slices.Contains(scopes, ScopeAdmin) {
+		staff, err := RoleHasPermission(ctx, user.Role, PermAdminAccess)
+		if err != nil {
+			return db.PersonalAccessToken{}, "", err
+		}
+		if !staff {
+			return db.PersonalAccessToken{}, "", ErrInvalidAccessTokenParams
+		}
+	}
+
+	secret, err := GenerateOpaqueToken()
+	if err != nil {
+		return db.PersonalAccessToken{}, "", err
+	}
+	token := PersonalAccessTokenPrefix + secret
+	now := time.Now().UTC()
+	pat := db.PersonalAccessToken{
+		ID:          uuid.New().String(),
+		UserID:      user.ID,
+		Name:        name,
+		TokenPrefix: token[:patDisplayLength],
+		TokenHash:   HashToken(token),
+		Scopes:      strings.Join(scopes, " "),
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+	}
+	if err := db.Get().CreatePersonalAccessToken(ctx, db.CreatePersonalAccessTokenParams{
+		ID:          pat.ID,
+		UserID:      pat.UserID,
+		Name:        pat.Name,
+		TokenPrefix: pat.TokenPrefix,
+		TokenHash:   pat.TokenHash,
+		Scopes:      pat.Scopes,
+		ExpiresAt:   pat.ExpiresAt,
+		CreatedAt:   pat.CreatedAt,
+	}); err != nil {
+		return db.PersonalAccessToken{}, "", err
+	}
+	logger.Info(ctx, fmt.Sprintf("personal access token %s created for user %s", pat.ID, user.ID))
+	return pat, token, nil
+}
+
+// VerifyPersonalAccessToken looks the token up and returns claims shaped like an access token,
+// so the rest of the middleware chain and cache.GetUser work unchanged. The token carries the
+// pat and scp claims instead of a session, RejectRevokedTokens skips the session check for it.
+func VerifyPersonalAccessToken(ctx context.Context, token string) (jwt.Token, error) {
+	stored, err := db.Get().GetPersonalAccessTokenByHash(ctx, HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPersonalAccessTokenInvalid
+		}
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if now.After(stored.ExpiresAt) {
+		return nil, ErrPersonalAccessTokenInvalid
+	}
+	user, err := db.Get().GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPersonalAccessTokenInvalid
+		}
+		return nil, err
+	}
+
+	scopes := strings.Fields(stored.Scopes)
+	roles, err := Roles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	role := tokenRole(user)
+	if roles.Has(role, PermAdminAccess) && !slices.Contains(scopes, ScopeAdmin) {
+		role = User
+	}
+	claims := map[string]any{
+		ClaimLookupID:            user.LookupID,
+		ClaimRole:                role,
+		ClaimPermissions:         roles.Permissions(role),
+		ClaimTokenID:             stored.ID,
+		ClaimPersonalAccessToken: stored.ID,
+		ClaimScopes:              stored.Scopes,
+		jwt.IssuedAtKey:          stored.CreatedAt,
+		jwt.ExpirationKey:        stored.ExpiresAt,
+	}
+	tok := jwt.New()
+	for key, value := range claims {
+		if err := tok.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.Get().TouchPersonalAccessToken(ctx, db.TouchPersonalAccessTokenParams{
+		LastUsedAt:   sql.NullTime{Time: now, Valid: true},
+		ID:           stored.ID,
+		LastUsedAt_2: sql.NullTime{Time: now.Add(-patTouchInterval), Valid: true},
+	}); err != nil {
+		logger.Warn(ctx, err, "failed to record personal access token usage")
+	}
+	return tok, nil
+}
+
+// IsPersonalAccessToken reports whether the claims come from a personal access token
+func IsPersonalAccessToken(claims map[string]any) bool {
+	id, _ := claims[ClaimPersonalAccessToken].(string)
+	return id != ""
+}
+
+// HasScope reports whether the personal access token claims allow the scope. write implies read.
+func HasScope(claims map[string]any, scope string) bool {
+	raw, _ := claims[ClaimScopes].(string)
+	scopes := strings.Fields(raw)
+	if scope == ScopeRead && slices.Contains(scopes, ScopeWrite) {
+		return true
+	}
+	return slices.Contains(scopes, scope)
+}
+
+// ListPersonalAccessTokens returns the user's tokens that haven't been revoked
+func ListPersonalAccessTokens(ctx context.Context, userID string) ([]db.PersonalAccessToken, error) {
+	return db.Get().ListPersonalAccessTokens(ctx, userID)
+}
+
+// RevokePersonalAccessToken revokes one of the user's tokens, sql.ErrNoRows if they don't own it
+func RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) error {
+	rows, err := db.Get().RevokePersonalAccessToken(ctx, db.RevokePersonalAccessTokenParams{
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:        tokenID,
+		UserID:    userID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	logger.Info(ctx, fmt.Sprintf("personal access token %s revoked by user %s", tokenID, userID))
+	return nil
+}
+
+// PurgeExpiredPersonalAccessTokens removes tokens that expired or were revoked
+func PurgeExpiredPersonalAccessTokens(ctx context.Context) error {
+	now := time.Now().UTC()
+	return db.Get().DeleteExpiredPersonalAccessTokens(ctx, db.DeleteExpiredPersonalAccessTokensParams{
+		ExpiresAt: now,
+		RevokedAt: sql.NullTime{Time: now, Valid: true},
+	})
+}
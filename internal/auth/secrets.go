@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nikojunttila/community/internal/utility"
+	"github.com/rs/zerolog/log"
+)
+
+// sealedSecretPrefix marks values written by SealSecret, the full format is
+// enc:v1:<key id>:<base64 of nonce and ciphertext>
+const sealedSecretPrefix = "enc:v1:"
+
+// secretKeySize is the AES-256 key length in bytes
+const secretKeySize = 32
+
+// ErrSecretKeyUnknown indicates a sealed secret references a key id that isn't configured.
+var ErrSecretKeyUnknown = errors.New("secret sealed with an unknown key id")
+
+// ErrSecretMalformed indicates a sealed secret could not be parsed or authenticated.
+var ErrSecretMalformed = errors.New("sealed secret is malformed")
+
+// secretKeyring holds the AES-GCM keys for secrets stored at rest, such as TOTP secrets.
+// New values are always sealed with the active key, older keys are kept for decryption.
+type secretKeyring struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+var secretKeys secretKeyring
+
+// setupSecretKeys loads the keyring from env and exits if it is not usable
+func setupSecretKeys() {
+	if err := LoadSecretKeys(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load secret encryption keys")
+	}
+}
+
+// LoadSecretKeys reads SECRET_ENCRYPTION_KEYS, a comma separated list of id:base64key
+// pairs, and SECRET_ENCRYPTION_KEY_ID, the id used for sealing (defaults to the first key).
+func LoadSecretKeys() error {
+	spec := utility.GetEnv("SECRET_ENCRYPTION_KEYS")
+	keyring := secretKeyring{keys: map[string]cipher.AEAD{}}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return fmt.Errorf("invalid key entry %q, expected id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("key %s is not valid base64: %w", id, err)
+		}
+		if len(key) != secretKeySize {
+			return fmt.Errorf("key %s must be %d bytes, got %d", id, secretKeySize, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		keyring.keys[id] = aead
+		if keyring.activeID == "" {
+			keyring.activeID = id
+		}
+	}
+	keyring.activeID = utility.GetEnvDefault("SECRET_ENCRYPTION_KEY_ID", keyring.activeID)
+	if _, ok := keyring.keys[keyring.activeID]; !ok {
+		return fmt.Errorf("active key %s is not in SECRET_ENCRYPTION_KEYS", keyring.activeID)
+	}
+	secretKeys = keyring
+	return nil
+}
+
+// GenerateSecretKey returns a new random key in the base64 form SECRET_ENCRYPTION_KEYS expects
+func GenerateSecretKey() (string, error) {
+	key := make([]byte, secretKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// SealSecret encrypts plaintext with the active key. The owner, e.g. the user id,
+// is authenticated with the ciphertext so sealed values can't be moved between rows.
+func SealSecret(owner, plaintext string) (string, error) {
+	aead, ok := secretKeys.keys[secretKeys.activeID]
+	if !ok {
+		return "", ErrSecretKeyUnknown
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(owner))
+	return sealedSecretPrefix + secretKeys.activeID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSecret decrypts a value written by SealSecret. Values without the sealed
+// prefix are legacy plaintext and returned unchanged until they are migrated.
+func OpenSecret(owner, value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, sealedSecretPrefix), ":")
+	if !ok {
+		return "", ErrSecretMalformed
+	}
+	aead, ok := secretKeys.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretKeyUnknown, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrSecretMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(owner))
+	if err != nil {
+		return "", ErrSecretMalformed
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed reports whether value was written by SealSecret
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedSecretPrefix)
+}
+
+// IsSealedWithActiveKey reports whether value is already sealed with the current key
+func IsSealedWithActiveKey(value string) bool {
+	return strings.HasPrefix(value, sealedSecretPrefix+secretKeys.activeID+":")
+}
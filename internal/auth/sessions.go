@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+// sessionTouchInterval limits how often last_seen_at is written
+const sessionTouchInterval = time.Minute
+
+// ClientInfo describes the device a request comes from. The ClientInfo middleware stores it
+// in the request context so logins can record where they happened.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+type clientInfoKey struct{}
+
+// NewClientContext returns a context carrying the client info
+func NewClientContext(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientFromContext returns the client info of the request, empty outside of requests
+func ClientFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
+
+// recordSession stores the login, or moves it to the newest access token after a refresh
+func recordSession(ctx context.Context, userID, sessionID, jti string, expiresAt time.Time) error {
+	client := ClientFromContext(ctx)
+	now := time.Now().UTC()
+	return db.Get().UpsertSession(ctx, db.UpsertSessionParams{
+		ID:         sessionID,
+		UserID:     userID,
+		CurrentJti: jti,
+		UserAgent:  client.UserAgent,
+		IpAddress:  client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+	})
+}
+
+// TouchSession records that the session was just used, at most once a minute
+func TouchSession(ctx context.Context, sessionID string) error {
+	now := time.Now().UTC()
+	return db.Get().TouchSession(ctx, db.TouchSessionParams{
+		LastSeenAt:   now,
+		IpAddress:    ClientFromContext(ctx).IP,
+		ID:           sessionID,
+		LastSeenAt_2: now.Add(-sessionTouchInterval),
+	})
+}
+
+// ListSessions returns the user's signed in sessions, most recently used first
+func ListSessions(ctx context.Context, userID string) ([]db.Session, error) {
+	return db.Get().ListActiveSessions(ctx, db.ListActiveSessionsParams{
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC(),
+	})
+}
+
+// RevokeUserSession signs one of the user's devices out, sql.ErrNoRows if the session isn't theirs or already ended
+func RevokeUserSession(ctx context.Context, userID, sessionID string) error {
+	session, err := db.Get().GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID || session.RevokedAt.Valid {
+		return sql.ErrNoRows
+	}
+	return RevokeSession(ctx, session.ID)
+}
+
+// RevokeOtherSessions signs the user out of every device except the session making the request.
+// Personal access tokens are kept, they are revoked one by one or by RevokeAllUserSessions.
+func RevokeOtherSessions(ctx context.Context, userID, currentSessionID string) error {
+	sessions, err := ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+		if err := RevokeSession(ctx, session.ID); err != nil {
+			return err
+		}
+	}
+	logger.Info(ctx, fmt.Sprintf("user %s signed out their other sessions", userID))
+	return nil
+}
+
+// endSession denylists the newest access token of the session right away instead of
+// letting it live out its remaining minutes, and hides the session from the device list
+func endSession(ctx context.Context, session db.Session) error {
+	if err := RevokeAccessToken(ctx, session.CurrentJti, time.Now().Add(AccessTokenTTL)); err != nil {
+		return err
+	}
+	return db.Get().MarkSessionRevoked(ctx, db.MarkSessionRevokedParams{
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:        session.ID,
+	})
+}
+
+// PurgeExpiredSessions removes sessions that expired or were signed out
+func PurgeExpiredSessions(ctx context.Context) error {
+	now := time.Now().UTC()
+	return db.Get().DeleteExpiredSessions(ctx, db.DeleteExpiredSessionsParams{
+		ExpiresAt: now,
+		RevokedAt: sql.NullTime{Time: now, Valid: true},
+	})
+}
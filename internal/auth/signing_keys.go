@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/nikojunttila/community/internal/utility"
+	"github.com/rs/zerolog/log"
+)
+
+// Suffixes of the files in JWT_KEY_DIR. The file name without the suffix is the kid.
+// Retired keys only keep their public half, they verify tokens but never sign new ones.
+const (
+	privateKeySuffix = ".pem"
+	publicKeySuffix  = ".pub.pem"
+)
+
+// rsaKeyBits is the modulus size of generated RS256 keys
+const rsaKeyBits = 3072
+
+// ErrNoSigningKey indicates JWT_KEY_DIR holds no private key to sign tokens with.
+var ErrNoSigningKey = errors.New("no private signing key found")
+
+// ErrSharedSecretSigning indicates tokens are signed with JWT_SECRET, so nothing signed for other apps may be issued.
+var ErrSharedSecretSigning = errors.New("tokens are signed with the shared JWT_SECRET, set JWT_KEY_DIR")
+
+// JWTKeyring holds the keys access tokens are signed and verified with
+type JWTKeyring struct {
+	Active jwk.Key // private key new tokens are signed with
+	Public jwk.Set // every key tokens are accepted from, published as the JWKS
+}
+
+// tokenVerifier is how incoming tokens are matched to a key: by kid against the
+// public key set, or with the shared secret in the legacy HS256 mode
+var tokenVerifier jwt.ParseOption
+
+var jwtKeys JWTKeyring
+
+// setupTokenAuth signs tokens with the keys in JWT_KEY_DIR. Without a key dir it falls
+// back to HS256 with JWT_SECRET, which means every verifier needs the shared secret.
+// The OpenID Connect provider is disabled then, see AsymmetricSigning.
+func setupTokenAuth() {
+	dir := utility.GetEnvDefault("JWT_KEY_DIR", "")
+	if dir == "" {
+		log.Warn().Msg("JWT_KEY_DIR is not set, signing tokens with the shared HS256 JWT_SECRET and disabling the OpenID Connect provider")
+		secret := []byte(utility.GetEnv("JWT_SECRET"))
+		tokenAuth = jwtauth.New("HS256", secret, nil)
+		tokenVerifier = jwt.WithKey(jwa.HS256, secret)
+		jwtKeys = JWTKeyring{Public: jwk.NewSet()}
+		return
+	}
+
+	keyring, err := LoadJWTKeys(dir, utility.GetEnvDefault("JWT_SIGNING_KEY_ID", ""))
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to load JWT keys from %s", dir)
+	}
+	jwtKeys = keyring
+	tokenAuth = jwtauth.New(keyring.Active.Algorithm().String(), keyring.Active, nil)
+	tokenVerifier = jwt.WithKeySet(keyring.Public)
+	log.Info().Msgf("Signing tokens with key %s, %d verification keys", keyring.Active.KeyID(), keyring.Public.Len())
+}
+
+// LoadJWTKeys reads every key in dir. The key with activeID signs new tokens, without an
+// id the newest private key does. Kids start with a timestamp, so the newest key sorts last.
+func LoadJWTKeys(dir, activeID string) (JWTKeyring, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return JWTKeyring{}, err
+	}
+	keyring := JWTKeyring{Public: jwk.NewSet()}
+	private := map[string]jwk.Key{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, privateKeySuffix) {
+			continue
+		}
+		kid := strings.TrimSuffix(strings.TrimSuffix(name, publicKeySuffix), privateKeySuffix)
+		key, err := readJWTKey(filepath.Join(dir, name), kid)
+		if err != nil {
+			return JWTKeyring{}, fmt.Errorf("%s: %w", name, err)
+		}
+		public, err := key.PublicKey()
+		if err != nil {
+			return JWTKeyring{}, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := keyring.Public.AddKey(public); err != nil {
+			return JWTKeyring{}, fmt.Errorf("%s: %w", name, err)
+		}
+		if !strings.HasSuffix(name, publicKeySuffix) {
+			private[kid] = key
+		}
+	}
+	if len(private) == 0 {
+		return JWTKeyring{}, ErrNoSigningKey
+	}
+
+	if activeID == "" {
+		for kid := range private {
+			activeID = max(activeID, kid)
+		}
+	}
+	active, ok := private[activeID]
+	if !ok {
+		return JWTKeyring{}, fmt.Errorf("%w: %s", ErrNoSigningKey, activeID)
+	}
+	keyring.Active = active
+	return keyring, nil
+}
+
+// readJWTKey parses a PEM key file and labels it with its kid, algorithm and use
+func readJWTKey(path, kid string) (jwk.Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwk.ParseKey(data, jwk.WithPEM(true))
+	if err != nil {
+		return nil, err
+	}
+	var alg jwa.SignatureAlgorithm
+	switch key.KeyType() {
+	case jwa.RSA:
+		alg = jwa.RS256
+	case jwa.OKP:
+		alg = jwa.EdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %s, use RSA or Ed25519", key.KeyType())
+	}
+	for name, value := range map[string]any{
+		jwk.KeyIDKey:     kid,
+		jwk.AlgorithmKey: alg,
+		jwk.KeyUsageKey:  jwk.ForSignature,
+	} {
+		if err := key.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// GenerateJWTKey writes a new private key for alg (RS256 or EdDSA) to dir and returns its kid.
+// It becomes the signing key on the next start unless JWT_SIGNING_KEY_ID pins another one.
+func GenerateJWTKey(dir, alg string) (string, error) {
+	var private any
+	switch jwa.SignatureAlgorithm(alg) {
+	case jwa.RS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return "", err
+		}
+		private = key
+	case jwa.EdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		private = key
+	default:
+		return "", fmt.Errorf("unsupported algorithm %s, use RS256 or EdDSA", alg)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	kid := fmt.Sprintf("%s-%x", time.Now().UTC().Format("20060102T150405.000000Z"), suffix)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+privateKeySuffix), data, 0o600); err != nil {
+		return "", err
+	}
+	return kid, nil
+}
+
+// RetireJWTKeys replaces every private key except keep with its public half, so the retired
+// keys still verify tokens they signed but can't sign new ones. It returns the retired kids.
+func RetireJWTKeys(dir string, keep ...string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var retired []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, publicKeySuffix) || !strings.HasSuffix(name, privateKeySuffix) {
+			continue
+		}
+		kid := strings.TrimSuffix(name, privateKeySuffix)
+		if slices.Contains(keep, kid) {
+			continue
+		}
+		key, err := readJWTKey(filepath.Join(dir, name), kid)
+		if err != nil {
+			return retired, fmt.Errorf("%s: %w", name, err)
+		}
+		var raw any
+		public, err := key.PublicKey()
+		if err == nil {
+			err = public.Raw(&raw)
+		}
+		if err != nil {
+			return retired, fmt.Errorf("%s: %w", name, err)
+		}
+		der, err := x509.MarshalPKIXPublicKey(raw)
+		if err != nil {
+			return retired, fmt.Errorf("%s: %w", name, err)
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, kid+publicKeySuffix), data, 0o644); err != nil {
+			return retired, err
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return retired, err
+		}
+		retired = append(retired, kid)
+	}
+	return retired, nil
+}
+
+// maxSignedTokenTTL is the longest lifetime of a token signed with the JWT keys. ID tokens live
+// shorter, refresh tokens and personal access tokens aren't signed at all.
+const maxSignedTokenTTL = max(AccessTokenTTL, ImpersonationTTL, MFAPendingTTL)
+
+// PruneJWTKeys deletes retired public keys once every token they signed has expired. A key
+// was retired when its public key file was written, keys retired more recently than the
+// longest token lifetime are kept and returned so the caller can report them.
+func PruneJWTKeys(dir string) (pruned, kept []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	cutoff := time.Now().Add(-maxSignedTokenTTL)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), publicKeySuffix) {
+			continue
+		}
+		kid := strings.TrimSuffix(entry.Name(), publicKeySuffix)
+		info, err := entry.Info()
+		if err != nil {
+			return pruned, kept, err
+		}
+		if info.ModTime().After(cutoff) {
+			kept = append(kept, kid)
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return pruned, kept, err
+		}
+		pruned = append(pruned, kid)
+	}
+	return pruned, kept, nil
+}
+
+// PublicJWKS returns the public verification keys, empty in the legacy HS256 mode
+func PublicJWKS() jwk.Set {
+	return jwtKeys.Public
+}
+
+// VerifyToken checks the signature of an access token against the verification keys and validates its claims
+func VerifyToken(tokenString string) (jwt.Token, error) {
+	token, err := jwt.Parse([]byte(tokenString), tokenVerifier, jwt.WithValidate(false))
+	if err != nil {
+		return nil, jwtauth.ErrorReason(err)
+	}
+	if err := jwt.Validate(token); err != nil {
+		return token, jwtauth.ErrorReason(err)
+	}
+	return token, nil
+}
+
+// SignClaims signs claims such as an ID token with the key access tokens are signed with.
+// It refuses in the HS256 mode, other apps could only verify the token with JWT_SECRET
+// and would then be able to forge access tokens.
+func SignClaims(claims map[string]any) (string, error) {
+	if !AsymmetricSigning() {
+		return "", ErrSharedSecretSigning
+	}
+	_, tokenString, err := tokenAuth.Encode(claims)
+	return tokenString, err
+}
+
+// AsymmetricSigning reports whether tokens are signed with a private key from JWT_KEY_DIR
+// that others can verify through the JWKS, false in the HS256 mode
+func AsymmetricSigning() bool {
+	return jwtKeys.Active != nil
+}
+
+// SigningAlgorithm is the JWS algorithm new tokens are signed with, empty in the HS256 mode
+func SigningAlgorithm() string {
+	if !AsymmetricSigning() {
+		return ""
+	}
+	return jwtKeys.Active.Algorithm().String()
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+const (
+	// AccessTokenTTL is how long a signed access token is accepted by the Verifier
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can be exchanged for a new token pair
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// ErrRefreshTokenInvalid indicates the refresh token is unknown, revoked or expired.
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+
+// ErrRefreshTokenReused indicates an already rotated refresh token was presented again.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// TokenPair is the access and refresh token handed out on login and refresh
+type TokenPair struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	SessionID        string
+	MFAPending       bool
+}
+
+// GenerateOpaqueToken returns a random URL safe token suitable for refresh and one-time tokens
+func GenerateOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex encoded sha256 of an opaque token. Only hashes are stored in the database.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueTokenPair starts a new refresh token family (session) for the user, used on login.
+// methods are the authentication methods (AMRPassword, AMROTP...) the user just passed.
+func IssueTokenPair(ctx context.Context, user db.User, methods ...string) (TokenPair, error) {
+	return issueTokenPair(ctx, user, uuid.New().String(), uuid.New().String(), methods)
+}
+
+// CompleteMFA replaces a session that is waiting for its second factor with a fresh one that
+// records the passed method. The old session is revoked so its tokens can't be reused.
+func CompleteMFA(ctx context.Context, user db.User, sessionID string, methods []string, method string) (TokenPair, error) {
+	if err := RevokeSession(ctx, sessionID); err != nil {
+		return TokenPair{}, err
+	}
+	upgraded := append(slices.Clone(methods), method)
+	return IssueTokenPair(ctx, user, upgraded...)
+}
+
+// issueTokenPair stores a new refresh token with the given id in the family and signs a matching access token
+func issueTokenPair(ctx context.Context, user db.User, familyID, refreshID string, methods []string) (TokenPair, error) {
+	if IsSuspended(user) {
+		return TokenPair{}, ErrUserSuspended
+	}
+	// Users with a second factor enrolled only get a limited session until they pass it
+	required, err := RequiresSecondFactor(ctx, user)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	pending := required && !HasSecondFactor(methods)
+	refreshTTL := RefreshTokenTTL
+	if pending {
+		refreshTTL = MFAPendingTTL
+	}
+
+	refreshToken, err := GenerateOpaqueToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	now := time.Now().UTC()
+	stored, err := db.Get().CreateRefreshToken(ctx, db.CreateRefreshTokenParams{
+		ID:        refreshID,
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: HashToken(refreshToken),
+		ExpiresAt: now.Add(refreshTTL),
+		Amr:       strings.Join(methods, " "),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	role := tokenRole(user)
+	permissions, err := RolePermissions(ctx, role)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to resolve permissions: %w", err)
+	}
+	jti := uuid.New().String()
+	accessToken, accessExpiresAt, err := MakeToken(AccessClaims{
+		TokenID:     jti,
+		LookupID:    user.LookupID,
+		SessionID:   familyID,
+		Role:        role,
+		AMR:         methods,
+		MFAPending:  pending,
+		Permissions: permissions,
+	})
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+	if err := recordSession(ctx, user.ID, familyID, jti, stored.ExpiresAt); err != nil {
+		return TokenPair{}, fmt.Errorf("failed to record session: %w", err)
+	}
+	return TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: stored.ExpiresAt,
+		SessionID:        familyID,
+		MFAPending:       pending,
+	}, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new token pair in the same family.
+// Presenting a token that was already rotated revokes the whole family, since either
+// the legitimate client or an attacker is holding a stolen copy.
+func RotateRefreshToken(ctx context.Context, refreshToken string) (TokenPair, error) {
+	stored, err := db.Get().GetRefreshTokenByHash(ctx, HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TokenPair{}, ErrRefreshTokenInvalid
+		}
+		return TokenPair{}, err
+	}
+	if stored.RevokedAt.Valid {
+		if stored.ReplacedBy == "" {
+			return TokenPair{}, ErrRefreshTokenInvalid
+		}
+		return TokenPair{}, revokeReusedFamily(ctx, stored)
+	}
+	if time.Now().UTC().After(stored.ExpiresAt) {
+		return TokenPair{}, ErrRefreshTokenInvalid
+	}
+
+	user, err := db.Get().GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to load refresh token owner: %w", err)
+	}
+	methods := strings.Fields(stored.Amr)
+	required, err := RequiresSecondFactor(ctx, user)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if required && !HasSecondFactor(methods) {
+		// Sessions waiting for the second factor can't be extended
+		return TokenPair{}, ErrRefreshTokenInvalid
+	}
+	// Store the successor first so the session never looks empty to the revocation check
+	newID := uuid.New().String()
+	pair, err := issueTokenPair(ctx, user, stored.FamilyID, newID, methods)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	rotated, err := db.Get().MarkRefreshTokenRotated(ctx, db.MarkRefreshTokenRotatedParams{
+		ReplacedBy: newID,
+		ID:         stored.ID,
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if rotated == 0 {
+		// Another request rotated this token between our read and write
+		return TokenPair{}, revokeReusedFamily(ctx, stored)
+	}
+	return pair, nil
+}
+
+// revokeReusedFamily kills every token descended from the same login and returns ErrRefreshTokenReused
+func revokeReusedFamily(ctx context.Context, stored db.RefreshToken) error {
+	logger.Warn(ctx, ErrRefreshTokenReused, fmt.Sprintf("revoking token family %s of user %s", stored.FamilyID, stored.UserID))
+	if err := RevokeSession(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// RevokeRefreshToken revokes the family the refresh token belongs to. Unknown tokens are ignored.
+func RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	stored, err := db.Get().GetRefreshTokenByHash(ctx, HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	return RevokeSession(ctx, stored.FamilyID)
+}
+
+// RevokeSession revokes every refresh token in the family. Access tokens carrying the
+// session id are rejected by the revocation check from then on.
+func RevokeSession(ctx context.Context, sessionID string) error {
+	if err := db.Get().RevokeRefreshTokenFamily(ctx, sessionID); err != nil {
+		return err
+	}
+	session, err := db.Get().GetSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if session.RevokedAt.Valid {
+		return nil
+	}
+	return endSession(ctx, session)
+}
+
+// RevokeAllUserSessions signs the user out of every device and revokes their personal
+// access tokens, which would otherwise keep working after a password reset or suspension
+func RevokeAllUserSessions(ctx context.Context, userID string) error {
+	if err := db.Get().RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := db.Get().RevokeUserPersonalAccessTokens(ctx, db.RevokeUserPersonalAccessTokensParams{
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		UserID:    userID,
+	}); err != nil {
+		return err
+	}
+	sessions, err := ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := endSession(ctx, session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken denylists a single access token until it would have expired anyway
+func RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return db.Get().RevokeAccessToken(ctx, db.RevokeAccessTokenParams{
+		Jti:       jti,
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
+
+// IsTokenRevoked reports whether the access token itself was revoked or its session no longer has a live refresh token
+func IsTokenRevoked(ctx context.Context, jti, sessionID string) (bool, error) {
+	revoked, err := db.Get().CountRevokedAccessTokens(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	if revoked > 0 {
+		return true, nil
+	}
+	active, err := db.Get().CountActiveRefreshTokensInFamily(ctx, db.CountActiveRefreshTokensInFamilyParams{
+		FamilyID:  sessionID,
+		ExpiresAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return false, err
+	}
+	return active == 0, nil
+}
+
+// PurgeExpiredTokens removes refresh tokens and denylist entries that can no longer be used
+func PurgeExpiredTokens(ctx context.Context) error {
+	now := time.Now().UTC()
+	if err := db.Get().DeleteExpiredRefreshTokens(ctx, now); err != nil {
+		return err
+	}
+	if err := PurgeExpiredSessions(ctx); err != nil {
+		return err
+	}
+	return db.Get().DeleteExpiredRevokedTokens(ctx, now)
+}
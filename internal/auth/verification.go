@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/utility"
+)
+
+// EmailVerificationMode controls what email/password users can do before confirming their address
+type EmailVerificationMode string
+
+const (
+	// VerificationOptional lets unverified users log in with their normal role
+	VerificationOptional EmailVerificationMode = "optional"
+	// VerificationBlockLogin refuses login until the address is verified
+	VerificationBlockLogin EmailVerificationMode = "block"
+	// VerificationRestrictRole issues tokens with the Unverified role until the address is verified
+	VerificationRestrictRole EmailVerificationMode = "restrict"
+)
+
+var errUnknownVerificationMode = errors.New("unknown EMAIL_VERIFICATION mode")
+
+var emailVerificationMode = VerificationOptional
+
+// setupEmailVerification reads the EMAIL_VERIFICATION mode, defaulting to optional
+func setupEmailVerification() {
+	mode := EmailVerificationMode(utility.GetEnvDefault("EMAIL_VERIFICATION", string(VerificationOptional)))
+	switch mode {
+	case VerificationOptional, VerificationBlockLogin, VerificationRestrictRole:
+		emailVerificationMode = mode
+	default:
+		logger.Fatal(context.Background(), errUnknownVerificationMode, fmt.Sprintf("EMAIL_VERIFICATION=%s", mode))
+	}
+}
+
+// LoginBlockedByVerification reports whether the user has to verify their email before logging in
+func LoginBlockedByVerification(user db.User) bool {
+	return emailVerificationMode == VerificationBlockLogin && !user.EmailVerified
+}
+
+// tokenRole returns the role embedded in the user's access tokens
+func tokenRole(user db.User) string {
+	if emailVerificationMode == VerificationRestrictRole && !user.EmailVerified {
+		return Unverified
+	}
+	return user.Role
+}
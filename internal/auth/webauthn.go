@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/nikojunttila/community/internal/utility"
+	"github.com/rs/zerolog/log"
+)
+
+var webAuthn *webauthn.WebAuthn
+
+// setupWebAuthn configures the relying party for passkeys. The id and origins default to APP_URL,
+// WEBAUTHN_RP_ID and WEBAUTHN_RP_ORIGINS (comma separated) override them.
+func setupWebAuthn() {
+	appURL := utility.GetEnv("APP_URL")
+	parsed, err := url.Parse(appURL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("APP_URL is not a valid url")
+	}
+	origins := strings.Split(utility.GetEnvDefault("WEBAUTHN_RP_ORIGINS", strings.TrimSuffix(appURL, "/")), ",")
+
+	webAuthn, err = webauthn.New(&webauthn.Config{
+		RPID:          utility.GetEnvDefault("WEBAUTHN_RP_ID", parsed.Hostname()),
+		RPDisplayName: utility.GetEnvDefault("WEBAUTHN_RP_NAME", "Community"),
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure WebAuthn")
+	}
+}
+
+// WebAuthn returns the relying party used for passkey ceremonies
+func WebAuthn() *webauthn.WebAuthn {
+	return webAuthn
+}
@@ -31,6 +31,9 @@ func GetUser(ctx context.Context) (db.User, error) {
 	user, ok := userCache.Get(lookupID)
 	if ok {
 		logger.Info(ctx, "user from cache")
+		if auth.IsSuspended(user) {
+			return db.User{}, auth.ErrUserSuspended
+		}
 		return user, nil
 	}
 	user, err = auth.GetUserFromContext(ctx)
@@ -41,3 +44,8 @@ func GetUser(ctx context.Context) (db.User, error) {
 	userCache.Add(user.LookupID, user)
 	return user, nil
 }
+
+// RemoveUser evicts the user so the next request reloads it from the database
+func RemoveUser(lookupID string) {
+	userCache.Remove(lookupID)
+}
@@ -51,6 +51,18 @@ func (q *Queries) CountAuditLogsByDateRange(ctx context.Context, arg CountAuditL
 	return count, err
 }
 
+const countChainedAuditLogs = `-- name: CountChainedAuditLogs :one
+SELECT COUNT(*) FROM admin_audit_logs
+WHERE hash != '' AND id <= ?
+`
+
+func (q *Queries) CountChainedAuditLogs(ctx context.Context, id int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChainedAuditLogs, id)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createAuditLog = `-- name: CreateAuditLog :one
 INSERT INTO admin_audit_logs (
     admin_user_id,
@@ -67,28 +79,36 @@ INSERT INTO admin_audit_logs (
     status_code,
     response_time_ms,
     timestamp,
-    request_id
+    request_id,
+    impersonated_user_id,
+    prev_hash,
+    hash,
+    request_headers
 ) VALUES (
-    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
-) RETURNING id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+) RETURNING id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers
 `
 
 type CreateAuditLogParams struct {
-	AdminUserID    string
-	AdminEmail     string
-	TargetUserID   string
-	Action         string
-	Resource       string
-	Method         string
-	Path           string
-	QueryParams    string
-	RequestBody    string
-	IpAddress      string
-	UserAgent      string
-	StatusCode     int64
-	ResponseTimeMs int64
-	Timestamp      interface{}
-	RequestID      string
+	AdminUserID        string
+	AdminEmail         string
+	TargetUserID       string
+	Action             string
+	Resource           string
+	Method             string
+	Path               string
+	QueryParams        string
+	RequestBody        string
+	IpAddress          string
+	UserAgent          string
+	StatusCode         int64
+	ResponseTimeMs     int64
+	Timestamp          interface{}
+	RequestID          string
+	ImpersonatedUserID string
+	PrevHash           string
+	Hash               string
+	RequestHeaders     string
 }
 
 func (q *Queries) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams) (AdminAuditLog, error) {
@@ -108,6 +128,10 @@ func (q *Queries) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams)
 		arg.ResponseTimeMs,
 		arg.Timestamp,
 		arg.RequestID,
+		arg.ImpersonatedUserID,
+		arg.PrevHash,
+		arg.Hash,
+		arg.RequestHeaders,
 	)
 	var i AdminAuditLog
 	err := row.Scan(
@@ -127,10 +151,28 @@ func (q *Queries) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams)
 		&i.ResponseTimeMs,
 		&i.Timestamp,
 		&i.RequestID,
+		&i.ImpersonatedUserID,
+		&i.PrevHash,
+		&i.Hash,
+		&i.RequestHeaders,
 	)
 	return i, err
 }
 
+const deleteAuditLogsThrough = `-- name: DeleteAuditLogsThrough :execrows
+DELETE FROM admin_audit_logs
+WHERE id <= ?
+`
+
+// Deletes the oldest logs up to an id, so the rest of the chain stays verifiable
+func (q *Queries) DeleteAuditLogsThrough(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAuditLogsThrough, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteOldAuditLogs = `-- name: DeleteOldAuditLogs :exec
 DELETE FROM admin_audit_logs 
 WHERE timestamp < ?
@@ -142,7 +184,7 @@ func (q *Queries) DeleteOldAuditLogs(ctx context.Context, timestamp interface{})
 }
 
 const getAuditLogByID = `-- name: GetAuditLogByID :one
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE id = ?
 `
 
@@ -166,6 +208,10 @@ func (q *Queries) GetAuditLogByID(ctx context.Context, id int64) (AdminAuditLog,
 		&i.ResponseTimeMs,
 		&i.Timestamp,
 		&i.RequestID,
+		&i.ImpersonatedUserID,
+		&i.PrevHash,
+		&i.Hash,
+		&i.RequestHeaders,
 	)
 	return i, err
 }
@@ -324,7 +370,7 @@ func (q *Queries) GetAuditLogStatsByResource(ctx context.Context) ([]GetAuditLog
 }
 
 const getAuditLogsByAction = `-- name: GetAuditLogsByAction :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE action = ?
 ORDER BY timestamp DESC
 LIMIT ?
@@ -361,6 +407,10 @@ func (q *Queries) GetAuditLogsByAction(ctx context.Context, arg GetAuditLogsByAc
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -376,7 +426,7 @@ func (q *Queries) GetAuditLogsByAction(ctx context.Context, arg GetAuditLogsByAc
 }
 
 const getAuditLogsByAdminAndDateRange = `-- name: GetAuditLogsByAdminAndDateRange :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE admin_user_id = ? 
   AND timestamp BETWEEN ? AND ?
 ORDER BY timestamp DESC
@@ -414,6 +464,10 @@ func (q *Queries) GetAuditLogsByAdminAndDateRange(ctx context.Context, arg GetAu
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -429,7 +483,7 @@ func (q *Queries) GetAuditLogsByAdminAndDateRange(ctx context.Context, arg GetAu
 }
 
 const getAuditLogsByAdminUser = `-- name: GetAuditLogsByAdminUser :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE admin_user_id = ?
 ORDER BY timestamp DESC
 LIMIT ?
@@ -466,6 +520,10 @@ func (q *Queries) GetAuditLogsByAdminUser(ctx context.Context, arg GetAuditLogsB
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -481,7 +539,7 @@ func (q *Queries) GetAuditLogsByAdminUser(ctx context.Context, arg GetAuditLogsB
 }
 
 const getAuditLogsByDateRange = `-- name: GetAuditLogsByDateRange :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE timestamp BETWEEN ? AND ?
 ORDER BY timestamp DESC
 LIMIT ?
@@ -519,6 +577,10 @@ func (q *Queries) GetAuditLogsByDateRange(ctx context.Context, arg GetAuditLogsB
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -534,7 +596,7 @@ func (q *Queries) GetAuditLogsByDateRange(ctx context.Context, arg GetAuditLogsB
 }
 
 const getAuditLogsByIPAddress = `-- name: GetAuditLogsByIPAddress :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE ip_address = ?
 ORDER BY timestamp DESC
 LIMIT ?
@@ -571,6 +633,10 @@ func (q *Queries) GetAuditLogsByIPAddress(ctx context.Context, arg GetAuditLogsB
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -586,7 +652,7 @@ func (q *Queries) GetAuditLogsByIPAddress(ctx context.Context, arg GetAuditLogsB
 }
 
 const getAuditLogsByMultipleCriteria = `-- name: GetAuditLogsByMultipleCriteria :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE 
     (? = '' OR admin_user_id = ?) AND
     (? = '' OR target_user_id = ?) AND
@@ -650,6 +716,10 @@ func (q *Queries) GetAuditLogsByMultipleCriteria(ctx context.Context, arg GetAud
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -665,7 +735,7 @@ func (q *Queries) GetAuditLogsByMultipleCriteria(ctx context.Context, arg GetAud
 }
 
 const getAuditLogsByRequestID = `-- name: GetAuditLogsByRequestID :one
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE request_id = ?
 `
 
@@ -689,12 +759,16 @@ func (q *Queries) GetAuditLogsByRequestID(ctx context.Context, requestID string)
 		&i.ResponseTimeMs,
 		&i.Timestamp,
 		&i.RequestID,
+		&i.ImpersonatedUserID,
+		&i.PrevHash,
+		&i.Hash,
+		&i.RequestHeaders,
 	)
 	return i, err
 }
 
 const getAuditLogsByResource = `-- name: GetAuditLogsByResource :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE resource = ?
 ORDER BY timestamp DESC
 LIMIT ?
@@ -731,6 +805,10 @@ func (q *Queries) GetAuditLogsByResource(ctx context.Context, arg GetAuditLogsBy
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -746,7 +824,7 @@ func (q *Queries) GetAuditLogsByResource(ctx context.Context, arg GetAuditLogsBy
 }
 
 const getAuditLogsByTargetUser = `-- name: GetAuditLogsByTargetUser :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE target_user_id = ?
 ORDER BY timestamp DESC
 LIMIT ?
@@ -783,6 +861,10 @@ func (q *Queries) GetAuditLogsByTargetUser(ctx context.Context, arg GetAuditLogs
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -798,7 +880,7 @@ func (q *Queries) GetAuditLogsByTargetUser(ctx context.Context, arg GetAuditLogs
 }
 
 const getAuditLogsByTargetUserAndAction = `-- name: GetAuditLogsByTargetUserAndAction :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE target_user_id = ? 
   AND action = ?
 ORDER BY timestamp DESC
@@ -837,6 +919,10 @@ func (q *Queries) GetAuditLogsByTargetUserAndAction(ctx context.Context, arg Get
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -852,7 +938,7 @@ func (q *Queries) GetAuditLogsByTargetUserAndAction(ctx context.Context, arg Get
 }
 
 const getAuditLogsWithPagination = `-- name: GetAuditLogsWithPagination :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 ORDER BY timestamp DESC
 LIMIT ? OFFSET ?
 `
@@ -888,6 +974,10 @@ func (q *Queries) GetAuditLogsWithPagination(ctx context.Context, arg GetAuditLo
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -903,7 +993,7 @@ func (q *Queries) GetAuditLogsWithPagination(ctx context.Context, arg GetAuditLo
 }
 
 const getDataAccessAuditLogs = `-- name: GetDataAccessAuditLogs :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE action = 'VIEW' 
   AND resource IN ('users', 'orders', 'payments', 'personal_data')
   AND timestamp BETWEEN ? AND ?
@@ -938,6 +1028,10 @@ func (q *Queries) GetDataAccessAuditLogs(ctx context.Context, limit int64) ([]Ad
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -953,7 +1047,7 @@ func (q *Queries) GetDataAccessAuditLogs(ctx context.Context, limit int64) ([]Ad
 }
 
 const getFailedAuditLogs = `-- name: GetFailedAuditLogs :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE status_code >= 400
 ORDER BY timestamp DESC
 LIMIT ?
@@ -985,6 +1079,10 @@ func (q *Queries) GetFailedAuditLogs(ctx context.Context, limit int64) ([]AdminA
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -999,8 +1097,26 @@ func (q *Queries) GetFailedAuditLogs(ctx context.Context, limit int64) ([]AdminA
 	return items, nil
 }
 
+const getLastAuditLogHash = `-- name: GetLastAuditLogHash :one
+SELECT id, hash FROM admin_audit_logs
+ORDER BY id DESC
+LIMIT 1
+`
+
+type GetLastAuditLogHashRow struct {
+	ID   int64
+	Hash string
+}
+
+func (q *Queries) GetLastAuditLogHash(ctx context.Context) (GetLastAuditLogHashRow, error) {
+	row := q.db.QueryRowContext(ctx, getLastAuditLogHash)
+	var i GetLastAuditLogHashRow
+	err := row.Scan(&i.ID, &i.Hash)
+	return i, err
+}
+
 const getRecentAuditLogs = `-- name: GetRecentAuditLogs :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 ORDER BY timestamp DESC
 LIMIT ?
 `
@@ -1031,6 +1147,10 @@ func (q *Queries) GetRecentAuditLogs(ctx context.Context, limit int64) ([]AdminA
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -1046,7 +1166,7 @@ func (q *Queries) GetRecentAuditLogs(ctx context.Context, limit int64) ([]AdminA
 }
 
 const getSlowAuditLogs = `-- name: GetSlowAuditLogs :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE response_time_ms > ?
 ORDER BY response_time_ms DESC
 LIMIT ?
@@ -1083,6 +1203,10 @@ func (q *Queries) GetSlowAuditLogs(ctx context.Context, arg GetSlowAuditLogsPara
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -1098,7 +1222,7 @@ func (q *Queries) GetSlowAuditLogs(ctx context.Context, arg GetSlowAuditLogsPara
 }
 
 const getSuspiciousAuditLogs = `-- name: GetSuspiciousAuditLogs :many
-SELECT a.id, a.admin_user_id, a.admin_email, a.target_user_id, a."action", a.resource, a.method, a.path, a.query_params, a.request_body, a.ip_address, a.user_agent, a.status_code, a.response_time_ms, a.timestamp, a.request_id FROM admin_audit_logs a
+SELECT a.id, a.admin_user_id, a.admin_email, a.target_user_id, a."action", a.resource, a.method, a.path, a.query_params, a.request_body, a.ip_address, a.user_agent, a.status_code, a.response_time_ms, a.timestamp, a.request_id, a.impersonated_user_id, a.prev_hash, a.hash, a.request_headers FROM admin_audit_logs a
 WHERE (a.admin_user_id, a.ip_address) IN (
     SELECT b.admin_user_id, b.ip_address 
     FROM admin_audit_logs b
@@ -1142,6 +1266,162 @@ func (q *Queries) GetSuspiciousAuditLogs(ctx context.Context, arg GetSuspiciousA
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditLogs = `-- name: ListAuditLogs :many
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs
+WHERE (?1 = 0 OR id < ?1)
+  AND (?2 = '' OR admin_user_id = ?2)
+  AND (?3 = '' OR target_user_id = ?3)
+  AND (?4 = '' OR action = ?4)
+  AND (?5 = '' OR resource = ?5)
+  AND (?6 = 0 OR status_code = ?6)
+  AND timestamp >= ?7
+  AND timestamp < ?8
+  AND (
+    ?9 = '' OR
+    admin_email LIKE '%' || ?9 || '%' ESCAPE '\' OR
+    admin_user_id LIKE '%' || ?9 || '%' ESCAPE '\' OR
+    target_user_id LIKE '%' || ?9 || '%' ESCAPE '\' OR
+    impersonated_user_id LIKE '%' || ?9 || '%' ESCAPE '\' OR
+    action LIKE '%' || ?9 || '%' ESCAPE '\' OR
+    resource LIKE '%' || ?9 || '%' ESCAPE '\' OR
+    path LIKE '%' || ?9 || '%' ESCAPE '\'
+  )
+ORDER BY id DESC
+LIMIT ?10
+`
+
+type ListAuditLogsParams struct {
+	Cursor       int64
+	AdminUserID  string
+	TargetUserID string
+	Action       string
+	Resource     string
+	StatusCode   int64
+	Since        interface{}
+	Until        interface{}
+	Search       string
+	PageSize     int64
+}
+
+// Newest first. cursor is the id of the last log of the previous page, 0 for the first page.
+// Empty filters match everything, search matches parts of the email, ids, action, resource and path.
+// search is a LIKE pattern, the caller escapes % and _ with a backslash to match them literally.
+func (q *Queries) ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([]AdminAuditLog, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditLogs,
+		arg.Cursor,
+		arg.AdminUserID,
+		arg.TargetUserID,
+		arg.Action,
+		arg.Resource,
+		arg.StatusCode,
+		arg.Since,
+		arg.Until,
+		arg.Search,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AdminAuditLog
+	for rows.Next() {
+		var i AdminAuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.AdminUserID,
+			&i.AdminEmail,
+			&i.TargetUserID,
+			&i.Action,
+			&i.Resource,
+			&i.Method,
+			&i.Path,
+			&i.QueryParams,
+			&i.RequestBody,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.StatusCode,
+			&i.ResponseTimeMs,
+			&i.Timestamp,
+			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditLogsAfter = `-- name: ListAuditLogsAfter :many
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs
+WHERE id > ?
+ORDER BY id
+LIMIT ?
+`
+
+type ListAuditLogsAfterParams struct {
+	ID    int64
+	Limit int64
+}
+
+// The chain in write order, for verification
+func (q *Queries) ListAuditLogsAfter(ctx context.Context, arg ListAuditLogsAfterParams) ([]AdminAuditLog, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditLogsAfter, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AdminAuditLog
+	for rows.Next() {
+		var i AdminAuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.AdminUserID,
+			&i.AdminEmail,
+			&i.TargetUserID,
+			&i.Action,
+			&i.Resource,
+			&i.Method,
+			&i.Path,
+			&i.QueryParams,
+			&i.RequestBody,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.StatusCode,
+			&i.ResponseTimeMs,
+			&i.Timestamp,
+			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
@@ -1157,7 +1437,7 @@ func (q *Queries) GetSuspiciousAuditLogs(ctx context.Context, arg GetSuspiciousA
 }
 
 const searchAuditLogs = `-- name: SearchAuditLogs :many
-SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id FROM admin_audit_logs 
+SELECT id, admin_user_id, admin_email, target_user_id, "action", resource, method, path, query_params, request_body, ip_address, user_agent, status_code, response_time_ms, timestamp, request_id, impersonated_user_id, prev_hash, hash, request_headers FROM admin_audit_logs 
 WHERE (
     admin_email LIKE '%' || ? || '%' OR
     target_user_id LIKE '%' || ? || '%' OR
@@ -1211,6 +1491,10 @@ func (q *Queries) SearchAuditLogs(ctx context.Context, arg SearchAuditLogsParams
 			&i.ResponseTimeMs,
 			&i.Timestamp,
 			&i.RequestID,
+			&i.ImpersonatedUserID,
+			&i.PrevHash,
+			&i.Hash,
+			&i.RequestHeaders,
 		); err != nil {
 			return nil, err
 		}
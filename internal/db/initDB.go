@@ -22,7 +22,10 @@ type Config struct {
 	Password string
 }
 
-var dbInstance *Queries
+var (
+	dbInstance *Queries
+	connection *sql.DB
+)
 
 // InitDefault initializes the DB with hardcoded defaults (used in main for now)
 func InitDefault() {
@@ -34,14 +37,20 @@ func InitDefault() {
 
 // Init sets up the database connection using a custom config
 func Init(cfg Config) {
-	connection, err := sql.Open(cfg.Driver, cfg.Name)
+	conn, err := sql.Open(cfg.Driver, cfg.Name)
 	if err != nil {
 		log.Fatal(err)
 	}
-	dbInstance = New(connection)
+	connection = conn
+	dbInstance = New(conn)
 }
 
 // Get returns the instantiated DB instance.
 func Get() *Queries {
 	return dbInstance
 }
+
+// Conn returns the connection behind Get, for starting transactions used with Queries.WithTx.
+func Conn() *sql.DB {
+	return connection
+}
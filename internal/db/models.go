@@ -10,22 +10,70 @@ import (
 )
 
 type AdminAuditLog struct {
-	ID             int64
-	AdminUserID    string
-	AdminEmail     string
-	TargetUserID   string
-	Action         string
-	Resource       string
-	Method         string
-	Path           string
-	QueryParams    string
-	RequestBody    string
-	IpAddress      string
-	UserAgent      string
-	StatusCode     int64
-	ResponseTimeMs int64
-	Timestamp      interface{}
-	RequestID      string
+	ID                 int64
+	AdminUserID        string
+	AdminEmail         string
+	TargetUserID       string
+	Action             string
+	Resource           string
+	Method             string
+	Path               string
+	QueryParams        string
+	RequestBody        string
+	IpAddress          string
+	UserAgent          string
+	StatusCode         int64
+	ResponseTimeMs     int64
+	Timestamp          interface{}
+	RequestID          string
+	ImpersonatedUserID string
+	PrevHash           string
+	Hash               string
+	RequestHeaders     string
+}
+
+type AuditArchive struct {
+	ID           int64
+	File         string
+	Manifest     string
+	Sha256       string
+	LogCount     int64
+	ChainedCount int64
+	FirstLogID   int64
+	LastLogID    int64
+	LastHash     string
+	Cutoff       time.Time
+	CreatedAt    time.Time
+}
+
+type AuditArchiveRun struct {
+	ID         int64
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Cutoff     time.Time
+	Archived   int64
+	File       string
+	Manifest   string
+	Error      string
+}
+
+type AuditCheckpoint struct {
+	ID        int64
+	LastLogID int64
+	LastHash  string
+	LogCount  int64
+	KeyID     string
+	Signature string
+	CreatedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
 }
 
 type Foo struct {
@@ -36,19 +84,178 @@ type Foo struct {
 	DeletedAt sql.NullTime
 }
 
-type User struct {
-	ID            string
-	LookupID      string
-	Email         string
-	PasswordHash  string
-	Secret        string
-	Name          string
-	Role          string
-	AvatarUrl     string
-	Provider      string
-	ProviderID    string
-	EmailVerified bool
-	Disabled      bool
+type LoginAttempt struct {
+	Scope          string
+	Subject        string
+	FailedAttempts int64
+	LastFailedAt   sql.NullTime
+	LockedUntil    sql.NullTime
+	UpdatedAt      time.Time
+}
+
+type OauthAccessToken struct {
+	TokenHash string
+	ClientID  string
+	UserID    string
+	Scope     string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        string
+	RedirectUri   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	Amr           string
+	ExpiresAt     time.Time
 	CreatedAt     time.Time
-	UpdatedAt     time.Time
+}
+
+type OauthClient struct {
+	ID           string
+	Name         string
+	SecretHash   string
+	RedirectUris string
+	Scopes       string
+	CreatedBy    string
+	CreatedAt    time.Time
+}
+
+type OauthConsent struct {
+	UserID    string
+	ClientID  string
+	Scope     string
+	CreatedAt time.Time
+}
+
+type PasswordResetToken struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type PersonalAccessToken struct {
+	ID          string
+	UserID      string
+	Name        string
+	TokenPrefix string
+	TokenHash   string
+	Scopes      string
+	ExpiresAt   time.Time
+	LastUsedAt  sql.NullTime
+	RevokedAt   sql.NullTime
+	CreatedAt   time.Time
+}
+
+type RecoveryCode struct {
+	ID        string
+	UserID    string
+	CodeHash  string
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type RefreshToken struct {
+	ID         string
+	UserID     string
+	FamilyID   string
+	TokenHash  string
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	ReplacedBy string
+	CreatedAt  time.Time
+	Amr        string
+}
+
+type RevokedToken struct {
+	Jti       string
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
+type Role struct {
+	Name        string
+	Description string
+	ParentRole  string
+	CreatedAt   time.Time
+}
+
+type RolePermission struct {
+	Role       string
+	Permission string
+}
+
+type Session struct {
+	ID         string
+	UserID     string
+	CurrentJti string
+	UserAgent  string
+	IpAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+}
+
+type User struct {
+	ID             string
+	LookupID       string
+	Email          string
+	PasswordHash   string
+	Secret         string
+	Name           string
+	Role           string
+	AvatarUrl      string
+	Provider       string
+	ProviderID     string
+	EmailVerified  bool
+	Disabled       bool
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DisabledReason string
+	SuspendedUntil sql.NullTime
+}
+
+type UserIdentity struct {
+	ID             string
+	UserID         string
+	Provider       string
+	ProviderUserID string
+	Email          string
+	CreatedAt      time.Time
+	LastLoginAt    sql.NullTime
+}
+
+type UserOtpState struct {
+	UserID         string
+	LastUsedStep   int64
+	FailedAttempts int64
+	LockedUntil    sql.NullTime
+	UpdatedAt      time.Time
+}
+
+type WebauthnCredential struct {
+	ID           string
+	UserID       string
+	CredentialID string
+	Credential   string
+	Name         string
+	CreatedAt    time.Time
+	LastUsedAt   sql.NullTime
+}
+
+type WebauthnSession struct {
+	ID        string
+	UserID    string
+	Purpose   string
+	Data      string
+	ExpiresAt time.Time
+	CreatedAt time.Time
 }
@@ -7,6 +7,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"time"
 )
 
@@ -25,7 +26,7 @@ INSERT INTO users (
   updated_at
 ) VALUES (
   ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
-) RETURNING id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at
+) RETURNING id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at, disabled_reason, suspended_until
 `
 
 type CreateUserParams struct {
@@ -72,6 +73,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Disabled,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DisabledReason,
+		&i.SuspendedUntil,
 	)
 	return i, err
 }
@@ -87,7 +90,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id string) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at FROM users
+SELECT id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at, disabled_reason, suspended_until FROM users
 WHERE email = ?
 `
 
@@ -109,12 +112,14 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Disabled,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DisabledReason,
+		&i.SuspendedUntil,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at FROM users
+SELECT id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at, disabled_reason, suspended_until FROM users
 WHERE id = ?
 `
 
@@ -136,12 +141,14 @@ func (q *Queries) GetUserByID(ctx context.Context, id string) (User, error) {
 		&i.Disabled,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DisabledReason,
+		&i.SuspendedUntil,
 	)
 	return i, err
 }
 
 const getUserByProviderID = `-- name: GetUserByProviderID :one
-SELECT id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at FROM users
+SELECT id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at, disabled_reason, suspended_until FROM users
 WHERE provider = ? AND provider_id = ?
 `
 
@@ -168,12 +175,14 @@ func (q *Queries) GetUserByProviderID(ctx context.Context, arg GetUserByProvider
 		&i.Disabled,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DisabledReason,
+		&i.SuspendedUntil,
 	)
 	return i, err
 }
 
 const getUserBylookupID = `-- name: GetUserBylookupID :one
-SELECT id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at FROM users
+SELECT id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at, disabled_reason, suspended_until FROM users
 WHERE lookup_id = ?
 `
 
@@ -195,10 +204,118 @@ func (q *Queries) GetUserBylookupID(ctx context.Context, lookupID string) (User,
 		&i.Disabled,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DisabledReason,
+		&i.SuspendedUntil,
 	)
 	return i, err
 }
 
+const listUserSecrets = `-- name: ListUserSecrets :many
+SELECT id, secret FROM users
+WHERE secret != ''
+`
+
+type ListUserSecretsRow struct {
+	ID     string
+	Secret string
+}
+
+func (q *Queries) ListUserSecrets(ctx context.Context) ([]ListUserSecretsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserSecrets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserSecretsRow
+	for rows.Next() {
+		var i ListUserSecretsRow
+		if err := rows.Scan(&i.ID, &i.Secret); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const replaceUserSecret = `-- name: ReplaceUserSecret :execrows
+UPDATE users SET secret = ? WHERE id = ? AND secret = ?
+`
+
+type ReplaceUserSecretParams struct {
+	Secret   string
+	ID       string
+	Secret_2 string
+}
+
+// only replaces the value that was read, so a concurrent enrollment isn't overwritten
+func (q *Queries) ReplaceUserSecret(ctx context.Context, arg ReplaceUserSecretParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, replaceUserSecret, arg.Secret, arg.ID, arg.Secret_2)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserEmailVerified = `-- name: SetUserEmailVerified :exec
+UPDATE users SET email_verified = ?, updated_at = ? WHERE id = ?
+`
+
+type SetUserEmailVerifiedParams struct {
+	EmailVerified bool
+	UpdatedAt     time.Time
+	ID            string
+}
+
+func (q *Queries) SetUserEmailVerified(ctx context.Context, arg SetUserEmailVerifiedParams) error {
+	_, err := q.db.ExecContext(ctx, setUserEmailVerified, arg.EmailVerified, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const suspendUser = `-- name: SuspendUser :exec
+UPDATE users
+SET disabled = TRUE, disabled_reason = ?, suspended_until = ?, updated_at = ?
+WHERE id = ?
+`
+
+type SuspendUserParams struct {
+	DisabledReason string
+	SuspendedUntil sql.NullTime
+	UpdatedAt      time.Time
+	ID             string
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) error {
+	_, err := q.db.ExecContext(ctx, suspendUser,
+		arg.DisabledReason,
+		arg.SuspendedUntil,
+		arg.UpdatedAt,
+		arg.ID,
+	)
+	return err
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :exec
+UPDATE users
+SET disabled = FALSE, disabled_reason = '', suspended_until = NULL, updated_at = ?
+WHERE id = ?
+`
+
+type UnsuspendUserParams struct {
+	UpdatedAt time.Time
+	ID        string
+}
+
+func (q *Queries) UnsuspendUser(ctx context.Context, arg UnsuspendUserParams) error {
+	_, err := q.db.ExecContext(ctx, unsuspendUser, arg.UpdatedAt, arg.ID)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET
@@ -212,7 +329,7 @@ SET
   created_at = ?,
   updated_at = ?
 WHERE id = ?
-RETURNING id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at
+RETURNING id, lookup_id, email, password_hash, secret, name, role, avatar_url, provider, provider_id, email_verified, disabled, created_at, updated_at, disabled_reason, suspended_until
 `
 
 type UpdateUserParams struct {
@@ -257,10 +374,42 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Disabled,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DisabledReason,
+		&i.SuspendedUntil,
 	)
 	return i, err
 }
 
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?
+`
+
+type UpdateUserPasswordParams struct {
+	PasswordHash string
+	UpdatedAt    time.Time
+	ID           string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.PasswordHash, arg.UpdatedAt, arg.ID)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :exec
+UPDATE users SET role = ?, updated_at = ? WHERE id = ?
+`
+
+type UpdateUserRoleParams struct {
+	Role      string
+	UpdatedAt time.Time
+	ID        string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserRole, arg.Role, arg.UpdatedAt, arg.ID)
+	return err
+}
+
 const updateUserSecret = `-- name: UpdateUserSecret :exec
 UPDATE users SET secret = ? WHERE id = ?
 `
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+)
+
+// AccessTokenRequest creates a personal access token. ExpiresInDays defaults to 30, at most 365.
+type AccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+// AccessTokenResponse is a personal access token as shown to its owner. Token is only set right after creation.
+type AccessTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAccessTokenResponse(pat db.PersonalAccessToken) AccessTokenResponse {
+	resp := AccessTokenResponse{
+		ID:        pat.ID,
+		Name:      pat.Name,
+		Prefix:    pat.TokenPrefix,
+		Scopes:    strings.Fields(pat.Scopes),
+		ExpiresAt: pat.ExpiresAt,
+		CreatedAt: pat.CreatedAt,
+	}
+	if pat.LastUsedAt.Valid {
+		resp.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return resp
+}
+
+// PostAccessTokenHandler creates a personal access token for scripts and CI jobs
+func PostAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	var req AccessTokenRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	pat, token, err := auth.CreatePersonalAccessToken(ctx, user, req.Name, req.Scopes, ttl)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAccessTokenParams) {
+			RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to create token", err)
+		return
+	}
+	resp := newAccessTokenResponse(pat)
+	resp.Token = token
+	RespondWithJSON(ctx, w, http.StatusCreated, resp)
+}
+
+// GetAccessTokensHandler lists the logged in user's personal access tokens
+func GetAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	pats, err := auth.ListPersonalAccessTokens(ctx, user.ID)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to list tokens", err)
+		return
+	}
+	resp := make([]AccessTokenResponse, 0, len(pats))
+	for _, pat := range pats {
+		resp = append(resp, newAccessTokenResponse(pat))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// DeleteAccessTokenHandler revokes one of the logged in user's personal access tokens
+func DeleteAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	if err := auth.RevokePersonalAccessToken(ctx, user.ID, chi.URLParam(r, "tokenID")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			RespondWithError(ctx, w, http.StatusNotFound, "Token not found", err)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to revoke token", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Token revoked",
+	})
+}
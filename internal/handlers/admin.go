@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
 	"github.com/nikojunttila/community/internal/logger"
 	"github.com/nikojunttila/community/internal/services/email"
 	userS "github.com/nikojunttila/community/internal/services/user"
@@ -51,3 +56,105 @@ func GetProfileAdmin(w http.ResponseWriter, r *http.Request) {
 	logger.Info(r.Context(), fmt.Sprintf("Profile accessed %s by %s", user.ID, admin.ID))
 	RespondWithJSON(ctx, w, http.StatusOK, user)
 }
+
+// SuspendUserRequest represents the JSON payload for suspending a user.
+// A missing Until suspends the user indefinitely.
+type SuspendUserRequest struct {
+	Reason string     `json:"reason"`
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// userStatusResponse is the suspension state of a user returned to admins
+type userStatusResponse struct {
+	ID               string     `json:"id"`
+	Email            string     `json:"email"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	Disabled         bool       `json:"disabled"`
+	DisabledReason   string     `json:"disabled_reason,omitempty"`
+	SuspendedUntil   *time.Time `json:"suspended_until,omitempty"`
+}
+
+func newUserStatusResponse(user db.User) userStatusResponse {
+	resp := userStatusResponse{
+		ID:               user.ID,
+		Email:            user.Email,
+		TwoFactorEnabled: user.Secret != "",
+		Disabled:         user.Disabled,
+		DisabledReason:   user.DisabledReason,
+	}
+	if user.SuspendedUntil.Valid {
+		resp.SuspendedUntil = &user.SuspendedUntil.Time
+	}
+	return resp
+}
+
+// PostSuspendUserHandler disables the user in the URL and revokes all of their sessions
+func PostSuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	var req SuspendUserRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	if req.Until != nil && req.Until.Before(time.Now()) {
+		RespondWithError(ctx, w, http.StatusBadRequest, "until must be in the future", userS.ErrParamsMismatch)
+		return
+	}
+
+	user, err := userS.SuspendUser(ctx, admin.ID, chi.URLParam(r, "userID"), req.Reason, req.Until)
+	if err != nil {
+		respondUserAdminError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, newUserStatusResponse(user))
+}
+
+// PostUnsuspendUserHandler re-enables the user in the URL
+func PostUnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	user, err := userS.UnsuspendUser(ctx, admin.ID, chi.URLParam(r, "userID"))
+	if err != nil {
+		respondUserAdminError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, newUserStatusResponse(user))
+}
+
+// PostResetTwoFactorHandler removes the TOTP secret and recovery codes of the user in the URL
+func PostResetTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	user, err := userS.ResetTwoFactor(ctx, admin.ID, chi.URLParam(r, "userID"))
+	if err != nil {
+		respondUserAdminError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, newUserStatusResponse(user))
+}
+
+// respondUserAdminError maps errors from admin user management to responses
+func respondUserAdminError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		RespondWithError(ctx, w, http.StatusNotFound, "User not found", err)
+	case errors.Is(err, userS.ErrCannotSuspendSelf), errors.Is(err, userS.ErrCannotChangeOwnRole), errors.Is(err, userS.ErrInvalidRole):
+		RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, userS.ErrCannotSuspendStaff), errors.Is(err, userS.ErrCannotChangeStaffRole), errors.Is(err, userS.ErrRoleAboveOwn):
+		RespondWithError(ctx, w, http.StatusForbidden, err.Error(), err)
+	default:
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to update user", err)
+	}
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikojunttila/community/internal/services/audit"
+)
+
+// AuditLogResponse is an admin action as shown to auditors
+type AuditLogResponse struct {
+	ID                 int64     `json:"id"`
+	RequestID          string    `json:"request_id"`
+	Timestamp          time.Time `json:"timestamp"`
+	AdminUserID        string    `json:"admin_user_id"`
+	AdminEmail         string    `json:"admin_email"`
+	TargetUserID       string    `json:"target_user_id"`
+	ImpersonatedUserID string    `json:"impersonated_user_id,omitempty"`
+	Action             string    `json:"action"`
+	Resource           string    `json:"resource"`
+	Method             string    `json:"method"`
+	Path               string    `json:"path"`
+	QueryParams        string    `json:"query_params,omitempty"`
+	RequestBody        string    `json:"request_body,omitempty"`
+	RequestHeaders     string    `json:"request_headers,omitempty"` // JSON object, sensitive values redacted
+	IPAddress          string    `json:"ip_address"`
+	UserAgent          string    `json:"user_agent"`
+	StatusCode         int64     `json:"status_code"`
+	ResponseTimeMs     int64     `json:"response_time_ms"`
+}
+
+// AuditLogPageResponse is a page of audit logs, pass next_cursor as cursor to get the next one
+type AuditLogPageResponse struct {
+	Logs       []AuditLogResponse `json:"logs"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// AuditAdminStatsResponse is the activity of one admin
+type AuditAdminStatsResponse struct {
+	AdminUserID       string    `json:"admin_user_id"`
+	AdminEmail        string    `json:"admin_email"`
+	TotalActions      int64     `json:"total_actions"`
+	UniqueTargets     int64     `json:"unique_targets"`
+	UniqueActions     int64     `json:"unique_actions"`
+	AvgResponseTimeMs float64   `json:"avg_response_time_ms"`
+	LastActivity      time.Time `json:"last_activity"`
+}
+
+// AuditResourceStatsResponse is the activity on one resource
+type AuditResourceStatsResponse struct {
+	Resource          string  `json:"resource"`
+	TotalActions      int64   `json:"total_actions"`
+	UniqueAdmins      int64   `json:"unique_admins"`
+	AvgResponseTimeMs float64 `json:"avg_response_time_ms"`
+	ErrorCount        int64   `json:"error_count"`
+}
+
+// AuditActionStatsResponse is the activity of one action
+type AuditActionStatsResponse struct {
+	Action            string  `json:"action"`
+	TotalCount        int64   `json:"total_count"`
+	UniqueAdmins      int64   `json:"unique_admins"`
+	UniqueTargets     int64   `json:"unique_targets"`
+	AvgResponseTimeMs float64 `json:"avg_response_time_ms"`
+}
+
+func newAuditLogResponse(log audit.Log) AuditLogResponse {
+	return AuditLogResponse{
+		ID:                 log.ID,
+		RequestID:          log.RequestID,
+		Timestamp:          log.Timestamp,
+		AdminUserID:        log.AdminUserID,
+		AdminEmail:         log.AdminEmail,
+		TargetUserID:       log.TargetUserID,
+		ImpersonatedUserID: log.ImpersonatedUserID,
+		Action:             log.Action,
+		Resource:           log.Resource,
+		Method:             log.Method,
+		Path:               log.Path,
+		QueryParams:        log.QueryParams,
+		RequestBody:        log.RequestBody,
+		RequestHeaders:     log.RequestHeaders,
+		IPAddress:          log.IPAddress,
+		UserAgent:          log.UserAgent,
+		StatusCode:         log.StatusCode,
+		ResponseTimeMs:     log.ResponseTimeMs,
+	}
+}
+
+// GetAuditLogsHandler lists audit logs newest first. Query parameters: admin, target, action,
+// resource, status, from and to (RFC 3339, to is exclusive), q to search, cursor and limit.
+// q matches part of the admin email, the admin, target or impersonated user id, the action,
+// the resource or the path. It is matched literally, % and _ are not wildcards.
+func GetAuditLogsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	page, err := audit.List(ctx, filter)
+	if err != nil {
+		respondAuditError(ctx, w, err)
+		return
+	}
+	resp := AuditLogPageResponse{
+		Logs:       make([]AuditLogResponse, 0, len(page.Logs)),
+		NextCursor: page.NextCursor,
+	}
+	for _, log := range page.Logs {
+		resp.Logs = append(resp.Logs, newAuditLogResponse(log))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// GetAuditLogHandler returns the audit log of the request id in the URL
+func GetAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log, err := audit.GetByRequestID(ctx, chi.URLParam(r, "requestID"))
+	if err != nil {
+		respondAuditError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, newAuditLogResponse(log))
+}
+
+// GetAuditAdminStatsHandler returns the activity of every admin, most active first
+func GetAuditAdminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats, err := audit.StatsByAdmin(ctx)
+	if err != nil {
+		respondAuditError(ctx, w, err)
+		return
+	}
+	resp := make([]AuditAdminStatsResponse, 0, len(stats))
+	for _, s := range stats {
+		resp = append(resp, AuditAdminStatsResponse(s))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// GetAuditResourceStatsHandler returns the activity of every resource, busiest first
+func GetAuditResourceStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats, err := audit.StatsByResource(ctx)
+	if err != nil {
+		respondAuditError(ctx, w, err)
+		return
+	}
+	resp := make([]AuditResourceStatsResponse, 0, len(stats))
+	for _, s := range stats {
+		resp = append(resp, AuditResourceStatsResponse(s))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// GetAuditActionStatsHandler returns the activity of every action, most common first
+func GetAuditActionStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats, err := audit.StatsByAction(ctx)
+	if err != nil {
+		respondAuditError(ctx, w, err)
+		return
+	}
+	resp := make([]AuditActionStatsResponse, 0, len(stats))
+	for _, s := range stats {
+		resp = append(resp, AuditActionStatsResponse(s))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// AuditSinkStatsResponse counts what happened to audit logs since the server started
+type AuditSinkStatsResponse struct {
+	Queued   int   `json:"queued"`
+	Capacity int   `json:"capacity"`
+	Enqueued int64 `json:"enqueued"`
+	Blocked  int64 `json:"blocked"`
+	Dropped  int64 `json:"dropped"`
+	Written  int64 `json:"written"`
+	Batches  int64 `json:"batches"`
+	Spilled  int64 `json:"spilled"`
+	Replayed int64 `json:"replayed"`
+	Lost     int64 `json:"lost"`
+}
+
+// GetAuditSinkStatsHandler returns the queue and drop counters of the audit log writer
+func GetAuditSinkStatsHandler(w http.ResponseWriter, r *http.Request) {
+	RespondWithJSON(r.Context(), w, http.StatusOK, AuditSinkStatsResponse(audit.Stats()))
+}
+
+// auditArchiveListLimit is the number of archives listed by GetAuditRetentionHandler
+const auditArchiveListLimit = 20
+
+// AuditArchiveResponse is an archive file of deleted audit logs
+type AuditArchiveResponse struct {
+	ID         int64     `json:"id"`
+	File       string    `json:"file"`
+	Manifest   string    `json:"manifest"`
+	SHA256     string    `json:"sha256"`
+	LogCount   int64     `json:"log_count"`
+	FirstLogID int64     `json:"first_log_id"`
+	LastLogID  int64     `json:"last_log_id"`
+	Cutoff     time.Time `json:"cutoff"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AuditArchiveRunResponse is the outcome of the latest retention run
+type AuditArchiveRunResponse struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Cutoff     time.Time `json:"cutoff"`
+	Archived   int64     `json:"archived"`
+	File       string    `json:"file,omitempty"`
+	Manifest   string    `json:"manifest,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AuditRetentionResponse is the retention policy, its latest run and the newest archives
+type AuditRetentionResponse struct {
+	Enabled       bool                     `json:"enabled"`
+	RetentionDays int                      `json:"retention_days"`
+	ArchiveDir    string                   `json:"archive_dir"`
+	LastRun       *AuditArchiveRunResponse `json:"last_run,omitempty"` // by the server or cmd/auditchain
+	Archives      []AuditArchiveResponse   `json:"archives"`
+}
+
+// GetAuditRetentionHandler reports the retention policy, the latest archival run and where
+// the archives are
+func GetAuditRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	archives, err := audit.ListArchives(ctx, auditArchiveListLimit)
+	if err != nil {
+		respondAuditError(ctx, w, err)
+		return
+	}
+	cfg := audit.Retention()
+	resp := AuditRetentionResponse{
+		Enabled:       audit.RetentionEnabled(),
+		RetentionDays: int(cfg.Period / (24 * time.Hour)),
+		ArchiveDir:    cfg.Dir,
+		Archives:      make([]AuditArchiveResponse, 0, len(archives)),
+	}
+	run, ok, err := audit.LastArchiveRun(ctx)
+	if err != nil {
+		respondAuditError(ctx, w, err)
+		return
+	}
+	if ok {
+		lastRun := AuditArchiveRunResponse(run)
+		resp.LastRun = &lastRun
+	}
+	for _, a := range archives {
+		resp.Archives = append(resp.Archives, AuditArchiveResponse{
+			ID:         a.ID,
+			File:       a.File,
+			Manifest:   a.Manifest,
+			SHA256:     a.Sha256,
+			LogCount:   a.LogCount,
+			FirstLogID: a.FirstLogID,
+			LastLogID:  a.LastLogID,
+			Cutoff:     a.Cutoff,
+			CreatedAt:  a.CreatedAt,
+		})
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// parseAuditFilter reads the filter of GetAuditLogsHandler from the query string
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		AdminUserID:  query.Get("admin"),
+		TargetUserID: query.Get("target"),
+		Action:       query.Get("action"),
+		Resource:     query.Get("resource"),
+		Search:       query.Get("q"),
+		Cursor:       query.Get("cursor"),
+	}
+	var err error
+	if raw := query.Get("status"); raw != "" {
+		if filter.StatusCode, err = strconv.Atoi(raw); err != nil {
+			return audit.Filter{}, audit.ErrInvalidFilter
+		}
+	}
+	if raw := query.Get("limit"); raw != "" {
+		if filter.PageSize, err = strconv.Atoi(raw); err != nil || filter.PageSize < 1 {
+			return audit.Filter{}, audit.ErrInvalidFilter
+		}
+	}
+	if raw := query.Get("from"); raw != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, raw); err != nil {
+			return audit.Filter{}, audit.ErrInvalidFilter
+		}
+	}
+	if raw := query.Get("to"); raw != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, raw); err != nil {
+			return audit.Filter{}, audit.ErrInvalidFilter
+		}
+	}
+	return filter, nil
+}
+
+// respondAuditError maps errors from reading the audit log to responses
+func respondAuditError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		RespondWithError(ctx, w, http.StatusNotFound, "Audit log not found", err)
+	case errors.Is(err, audit.ErrInvalidCursor), errors.Is(err, audit.ErrInvalidFilter):
+		RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), err)
+	default:
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to read audit logs", err)
+	}
+}
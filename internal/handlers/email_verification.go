@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/nikojunttila/community/internal/logger"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+// errMissingVerificationToken indicates the verification link had no token.
+var errMissingVerificationToken = errors.New("verification token is required")
+
+// GetVerifyEmailHandler confirms the user's email address using the token from the emailed link.
+func GetVerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		RespondWithError(ctx, w, http.StatusBadRequest, errMissingVerificationToken.Error(), userService.ErrParamsMismatch)
+		return
+	}
+
+	if _, err := userService.VerifyEmail(ctx, token); err != nil {
+		if errors.Is(err, userService.ErrVerificationTokenInvalid) {
+			RespondWithError(ctx, w, http.StatusBadRequest, "Verification link is invalid or expired", err)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to verify email", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Email address verified",
+	})
+}
+
+// PostResendVerificationHandler sends a new verification link. The response is the same
+// whether or not the account exists, is already verified or was throttled.
+func PostResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		RespondWithError(ctx, w, http.StatusBadRequest, "invalid form data", err)
+		return
+	}
+
+	address := strings.TrimSpace(strings.ToLower(r.FormValue("email")))
+	if !emailRegex.MatchString(address) {
+		RespondWithError(ctx, w, http.StatusBadRequest, ErrInvalidEmail.Error(), userService.ErrParamsMismatch)
+		return
+	}
+
+	if err := userService.ResendVerificationEmail(ctx, address); err != nil {
+		if !errors.Is(err, userService.ErrVerificationThrottled) {
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+			return
+		}
+		logger.Warn(ctx, err, "verification email resend throttled")
+	}
+	RespondWithJSON(ctx, w, http.StatusAccepted, map[string]string{
+		"message": "If the address needs verification a new link has been sent",
+	})
+}
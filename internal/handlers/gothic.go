@@ -1,82 +1,171 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
 	"github.com/nikojunttila/community/internal/auth"
-	"github.com/nikojunttila/community/internal/db"
 	"github.com/nikojunttila/community/internal/logger"
 	userService "github.com/nikojunttila/community/internal/services/user"
+	"github.com/nikojunttila/community/internal/utility"
 )
 
+// identityLinkCookie marks an OAuth flow started from the account page to link the provider
+// instead of logging in. It holds the provider name and is only set for logged in users.
+const identityLinkCookie = "identity_link"
+
 // GetAuthCallBack handles the OAuth callback after the user authenticates with a third-party provider.
-// It completes the auth process, creates the user if they don't exist, sets a JWT cookie, and redirects to the frontend.
+// It finds or creates the user for the provider identity, sets a JWT cookie, and redirects to the frontend.
+// Flows started by GetLinkIdentityHandler link the identity to the logged in user instead.
 func GetAuthCallBack(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	if !requireOAuthProvider(w, r) {
+		return
+	}
 	userInfo, err := gothic.CompleteUserAuth(w, r)
 	if err != nil {
-		// Print session values to help debug missing cookies or invalid session state
-		session, _ := gothic.Store.Get(r, "gothic_session")
-		fmt.Printf("Session values: %+v\n", session.Values)
+		// Usually a missing or expired gothic session cookie
+		logger.Warn(ctx, err, "failed to complete oauth callback")
 		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to complete user auth", err)
 		return
 	}
+	identity := userService.ExternalIdentity{
+		Provider:       userInfo.Provider,
+		ProviderUserID: userInfo.UserID,
+		Email:          userInfo.Email,
+		EmailVerified:  providerEmailVerified(userInfo),
+		Name:           userInfo.Name,
+		AvatarURL:      userInfo.AvatarURL,
+	}
 
-	// Check if the user already exists in the database
-	exists, err := userService.CheckUserExists(r.Context(), userInfo.Email)
-	if err != nil {
-		RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+	if cookie, err := r.Cookie(identityLinkCookie); err == nil && cookie.Value == userInfo.Provider {
+		clearIdentityLinkCookie(w)
+		linkIdentity(w, r, identity)
 		return
 	}
 
-	var user db.User
-	if exists {
-		user, err = db.Get().GetUserByEmail(r.Context(), userInfo.Email)
-		if err != nil {
-			RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
-			return
-		}
-	} else {
-		// Register new user
-		user, err = userService.CreateUser(r.Context(), "", userService.CreateUserParams{
-			Email:     userInfo.Email,
-			Name:      userInfo.Name,
-			AvatarURL: userInfo.AvatarURL,
-		}, userService.OauthCreate{
-			IsOAuth:       true,
-			EmailVerified: true,
-			Provider:      userInfo.Provider,
-			ProviderID:    userInfo.UserID,
-		})
-		if err != nil {
-			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to create user", err)
+	user, err := userService.LoginWithIdentity(ctx, identity)
+	if err != nil {
+		if errors.Is(err, userService.ErrIdentityNotLinked) {
+			RespondWithError(ctx, w, http.StatusConflict, err.Error(), err)
 			return
 		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to log in", err)
+		return
 	}
 
-	// Create and set JWT cookie
-	jwtToken := auth.MakeToken(user.LookupID, user.Role)
-	http.SetCookie(w, &http.Cookie{
-		Name:     "jwt", // Must be "jwt" to be recognized by jwtauth.Verifier
-		Value:    jwtToken,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-		// Secure: true, // Uncomment in production over HTTPS
-	})
+	if auth.IsSuspended(user) {
+		RespondWithError(ctx, w, http.StatusForbidden, "Account is suspended", auth.ErrUserSuspended)
+		return
+	}
+	if auth.LoginBlockedByVerification(user) {
+		RespondWithError(ctx, w, http.StatusForbidden, "Please verify your email address before logging in", userService.ErrEmailNotVerified)
+		return
+	}
+
+	// Start a session and set the token cookies
+	pair, err := issueLoginTokens(ctx, w, user, auth.AMRFederated)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to issue tokens", err)
+		return
+	}
 
-	logger.Info(ctx, fmt.Sprintf("User authenticated: %+v\n", user))
+	logger.Info(ctx, fmt.Sprintf("user %s authenticated with %s", user.ID, identity.Provider))
+
+	if pair.MFAPending {
+		http.Redirect(w, r, secondFactorPath(user), http.StatusFound)
+		return
+	}
 
 	// Redirect user to frontend
-	http.Redirect(w, r, "http://localhost:3000/", http.StatusFound)
+	http.Redirect(w, r, popLoginReturn(w, r, strings.TrimSuffix(utility.GetEnvDefault("APP_URL", ""), "/")+"/"), http.StatusFound)
 }
 
 // GetBeginAuth starts the OAuth authentication process for a given provider.
 // The frontend should call this endpoint to begin the login flow (e.g., /public/google/begin).
+// Providers that aren't configured in OAUTH_PROVIDERS are not found.
 func GetBeginAuth(w http.ResponseWriter, r *http.Request) {
+	if !requireOAuthProvider(w, r) {
+		return
+	}
 	gothic.BeginAuthHandler(w, r)
 }
+
+// requireOAuthProvider responds with 404 unless the provider in the path is configured
+func requireOAuthProvider(w http.ResponseWriter, r *http.Request) bool {
+	provider := chi.URLParam(r, "provider")
+	if !auth.OAuthProviderEnabled(provider) {
+		RespondWithError(r.Context(), w, http.StatusNotFound, "Unknown provider", fmt.Errorf("oauth provider %q is not configured", provider))
+		return false
+	}
+	return true
+}
+
+// GetLinkIdentityHandler starts an OAuth flow that links the provider to the logged in user
+func GetLinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireOAuthProvider(w, r) {
+		return
+	}
+	provider := chi.URLParam(r, "provider")
+	http.SetCookie(w, &http.Cookie{
+		Name:     identityLinkCookie,
+		Value:    provider,
+		Path:     "/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		// Lax so the cookie comes back on the redirect from the provider
+		SameSite: http.SameSiteLaxMode,
+		// Secure: true, // Enable in production with HTTPS
+	})
+	http.Redirect(w, r, "/public/"+provider+"/begin", http.StatusFound)
+}
+
+// linkIdentity finishes a link flow for the user of the browser session
+func linkIdentity(w http.ResponseWriter, r *http.Request, identity userService.ExternalIdentity) {
+	ctx := r.Context()
+	user, _, err := browserSessionUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusUnauthorized, "Log in before linking a provider", err)
+		return
+	}
+	if err := userService.LinkIdentity(ctx, user, identity); err != nil {
+		switch {
+		case errors.Is(err, userService.ErrIdentityInUse), errors.Is(err, userService.ErrProviderAlreadyLinked):
+			RespondWithError(ctx, w, http.StatusConflict, err.Error(), err)
+		default:
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to link provider", err)
+		}
+		return
+	}
+	http.Redirect(w, r, "/twoauth/dashboard", http.StatusFound)
+}
+
+// clearIdentityLinkCookie ends the link intent so the next provider login is a normal login
+func clearIdentityLinkCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     identityLinkCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// providerEmailVerified reports whether the provider confirmed the user owns the email address.
+// Google's userinfo calls it verified_email, OpenID Connect providers email_verified and
+// Discord verified. GitHub doesn't say, so its addresses are treated as unverified.
+func providerEmailVerified(user goth.User) bool {
+	for _, key := range []string{"verified_email", "email_verified", "verified"} {
+		if verified, ok := user.RawData[key].(bool); ok {
+			return verified
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+// IdentityResponse is a login provider linked to the user
+type IdentityResponse struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// IdentitiesResponse lists the ways the user can log in
+type IdentitiesResponse struct {
+	HasPassword bool               `json:"has_password"`
+	Identities  []IdentityResponse `json:"identities"`
+}
+
+// SetPasswordRequest sets or changes the password. CurrentPassword can be left out while the account has none.
+type SetPasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func newIdentityResponse(identity db.UserIdentity) IdentityResponse {
+	resp := IdentityResponse{
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+	if identity.LastLoginAt.Valid {
+		resp.LastLoginAt = &identity.LastLoginAt.Time
+	}
+	return resp
+}
+
+// GetIdentitiesHandler lists the login providers linked to the logged in user
+func GetIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	identities, err := userService.ListIdentities(ctx, user.ID)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to list identities", err)
+		return
+	}
+	resp := IdentitiesResponse{
+		HasPassword: user.PasswordHash != "",
+		Identities:  make([]IdentityResponse, 0, len(identities)),
+	}
+	for _, identity := range identities {
+		resp.Identities = append(resp.Identities, newIdentityResponse(identity))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// DeleteIdentityHandler unlinks a login provider from the logged in user
+func DeleteIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	if err := userService.UnlinkIdentity(ctx, user, chi.URLParam(r, "provider")); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			RespondWithError(ctx, w, http.StatusNotFound, "Provider not linked", err)
+		case errors.Is(err, userService.ErrLastLoginMethod):
+			RespondWithError(ctx, w, http.StatusConflict, err.Error(), err)
+		default:
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to unlink provider", err)
+		}
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Provider unlinked",
+	})
+}
+
+// PostPasswordHandler sets a password on an account created with a provider, or changes the
+// existing one. The user's other sessions are signed out.
+func PostPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	var req SetPasswordRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	if err := userService.SetPassword(ctx, user, currentSessionID(r), req.CurrentPassword, req.NewPassword); err != nil {
+		if errors.Is(err, userService.ErrWrongPassword) {
+			RespondWithError(ctx, w, http.StatusBadRequest, "Current password is incorrect", err)
+			return
+		}
+		if errors.Is(err, auth.ErrPasswordPolicy) {
+			RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), userService.ErrTooWeakPassword)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to set password", err)
+		return
+	}
+	// The cached user still has the old hash
+	cache.RemoveUser(user.LookupID)
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Password updated",
+	})
+}
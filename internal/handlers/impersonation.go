@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	userS "github.com/nikojunttila/community/internal/services/user"
+)
+
+// errNotImpersonating indicates the request wasn't made with an impersonation token.
+var errNotImpersonating = errors.New("not impersonating a user")
+
+// ImpersonateRequest starts acting as the user, the reason ends up in the audit log
+type ImpersonateRequest struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// ImpersonationResponse is the token used to act as the user. It is also set as the jwt cookie.
+type ImpersonationResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int64  `json:"expires_in"` // seconds, impersonation tokens can't be refreshed
+	User      User   `json:"user"`
+}
+
+// ImpersonationBanner tells templates and frontends that an admin is acting as the user.
+// Templates show it with {{template "impersonationBanner" .Impersonation}}.
+type ImpersonationBanner struct {
+	AdminEmail string    `json:"admin_email"`
+	UserEmail  string    `json:"user_email"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// PostImpersonateHandler issues a short-lived token for the user in the body. The admin's own
+// refresh token is left alone so ending the impersonation returns to the admin's session.
+func PostImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	var req ImpersonateRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	if req.UserID == "" || req.Reason == "" {
+		RespondWithError(ctx, w, http.StatusBadRequest, "user_id and reason are required", userS.ErrParamsMismatch)
+		return
+	}
+
+	_, claims, _ := jwtauth.FromContext(ctx)
+	sessionID, _ := claims[auth.ClaimSessionID].(string)
+	impersonation, err := userS.StartImpersonation(ctx, admin, req.UserID, sessionID, auth.AMRFromClaims(claims), req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			RespondWithError(ctx, w, http.StatusNotFound, "User not found", err)
+		case errors.Is(err, auth.ErrImpersonationNotAllowed):
+			RespondWithError(ctx, w, http.StatusForbidden, err.Error(), err)
+		case errors.Is(err, auth.ErrUserSuspended):
+			RespondWithError(ctx, w, http.StatusConflict, "User is suspended", err)
+		default:
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to impersonate user", err)
+		}
+		return
+	}
+	setAccessTokenCookie(w, impersonation.Token, impersonation.ExpiresAt)
+	RespondWithJSON(ctx, w, http.StatusOK, ImpersonationResponse{
+		Token:     impersonation.Token,
+		ExpiresIn: int64(time.Until(impersonation.ExpiresAt).Seconds()),
+		User: User{
+			ID:       impersonation.User.LookupID,
+			Email:    impersonation.User.Email,
+			Name:     impersonation.User.Name,
+			Provider: impersonation.User.Provider,
+		},
+	})
+}
+
+// GetImpersonationHandler returns the banner to show while impersonating, or impersonating false
+func GetImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	banner, err := impersonationBanner(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find impersonating admin", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, struct {
+		Impersonating bool                 `json:"impersonating"`
+		Banner        *ImpersonationBanner `json:"banner,omitempty"`
+	}{Impersonating: banner != nil, Banner: banner})
+}
+
+// PostEndImpersonationHandler revokes the impersonation token. Browsers still holding the
+// admin's refresh cookie get a fresh token of the admin's own session back.
+func PostEndImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token, claims, err := jwtauth.FromContext(ctx)
+	if err != nil || !auth.IsImpersonating(claims) {
+		RespondWithError(ctx, w, http.StatusBadRequest, "Not impersonating a user", errNotImpersonating)
+		return
+	}
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	if err := userS.EndImpersonation(ctx, auth.ActorFromClaims(claims), user, token.JwtID(), token.Expiration()); err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to end impersonation", err)
+		return
+	}
+
+	if cookie, err := r.Cookie(refreshCookieName); err == nil && cookie.Value != "" {
+		if pair, err := auth.RotateRefreshToken(ctx, cookie.Value); err == nil {
+			setTokenCookies(w, pair)
+			RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+				"message": "Impersonation ended",
+			})
+			return
+		}
+	}
+	clearAccessTokenCookie(w)
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Impersonation ended, log in again to continue as yourself",
+	})
+}
+
+// impersonationBanner describes the impersonation of the request, nil for the user's own sessions
+func impersonationBanner(ctx context.Context) (*ImpersonationBanner, error) {
+	token, claims, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil || !auth.IsImpersonating(claims) {
+		return nil, nil
+	}
+	admin, err := db.Get().GetUserBylookupID(ctx, auth.ActorFromClaims(claims))
+	if err != nil {
+		return nil, err
+	}
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ImpersonationBanner{
+		AdminEmail: admin.Email,
+		UserEmail:  user.Email,
+		ExpiresAt:  token.Expiration(),
+	}, nil
+}
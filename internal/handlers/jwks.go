@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/nikojunttila/community/internal/auth"
+)
+
+// GetJWKSHandler publishes the public token verification keys so other services can verify
+// access tokens without a shared secret. Keys are matched to tokens by their kid header.
+func GetJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	// Short enough that verifiers pick up a rotated key soon after it is deployed
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	RespondWithJSON(r.Context(), w, http.StatusOK, auth.PublicJWKS())
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	userS "github.com/nikojunttila/community/internal/services/user"
+)
+
+// LoginLockoutResponse is a locked account or ip shown to admins
+type LoginLockoutResponse struct {
+	Scope          string     `json:"scope"`
+	Subject        string     `json:"subject"`
+	FailedAttempts int64      `json:"failed_attempts"`
+	LastFailedAt   *time.Time `json:"last_failed_at,omitempty"`
+	LockedUntil    time.Time  `json:"locked_until"`
+}
+
+func newLoginLockoutResponse(attempt db.LoginAttempt) LoginLockoutResponse {
+	resp := LoginLockoutResponse{
+		Scope:          attempt.Scope,
+		Subject:        attempt.Subject,
+		FailedAttempts: attempt.FailedAttempts,
+		LockedUntil:    attempt.LockedUntil.Time,
+	}
+	if attempt.LastFailedAt.Valid {
+		resp.LastFailedAt = &attempt.LastFailedAt.Time
+	}
+	return resp
+}
+
+// clientIP is the address failed logins are counted for. chi's RealIP middleware has already
+// replaced RemoteAddr with the forwarded address when there is one.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// loginThrottled rejects the password login with 429 while the account or ip is backing off
+func loginThrottled(w http.ResponseWriter, r *http.Request, email string) bool {
+	ctx := r.Context()
+	wait, err := userS.LoginRetryAfter(ctx, email, clientIP(r))
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+		return true
+	}
+	if wait == 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	RespondWithError(ctx, w, http.StatusTooManyRequests, "Too many failed login attempts, try again later", userS.ErrLoginThrottled)
+	return true
+}
+
+// recordFailedLogin counts a wrong email or password, a failure to record it doesn't change the response
+func recordFailedLogin(r *http.Request, email string) {
+	if err := userS.RecordLoginFailure(r.Context(), email, clientIP(r)); err != nil {
+		logger.Error(r.Context(), err, "failed to record failed login")
+	}
+}
+
+// recordSuccessfulLogin resets the account's failures once the password matched and the account may log in
+func recordSuccessfulLogin(r *http.Request, email string) {
+	if err := userS.RecordLoginSuccess(r.Context(), email); err != nil {
+		logger.Error(r.Context(), err, "failed to reset login attempts")
+	}
+}
+
+// GetLoginLockoutsHandler lists the accounts and ips that currently can't log in
+func GetLoginLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	attempts, err := userS.ListLoginLockouts(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to list lockouts", err)
+		return
+	}
+	resp := make([]LoginLockoutResponse, 0, len(attempts))
+	for _, attempt := range attempts {
+		resp = append(resp, newLoginLockoutResponse(attempt))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// DeleteLoginLockoutHandler clears the lockout given by the scope and subject query parameters
+func DeleteLoginLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	query := r.URL.Query()
+	if err := userS.ClearLoginLockout(ctx, admin.ID, query.Get("scope"), query.Get("subject")); err != nil {
+		switch {
+		case errors.Is(err, userS.ErrParamsMismatch):
+			RespondWithError(ctx, w, http.StatusBadRequest, "scope must be account or ip and subject is required", err)
+		case errors.Is(err, sql.ErrNoRows):
+			RespondWithError(ctx, w, http.StatusNotFound, "No failed logins recorded", err)
+		default:
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to clear lockout", err)
+		}
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Lockout cleared",
+	})
+}
+
+// PostUnlockUserHandler clears the login lockout of the user in the URL
+func PostUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	user, err := userS.UnlockUserLogin(ctx, admin.ID, chi.URLParam(r, "userID"))
+	if err != nil {
+		respondUserAdminError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, newUserStatusResponse(user))
+}
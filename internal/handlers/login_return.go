@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// loginReturnCookie remembers where to send the user once a login that was interrupted,
+// e.g. by an app asking to sign in through us, has finished all of its steps
+const loginReturnCookie = "login_return"
+
+// setLoginReturn stores a local path to continue at after login
+func setLoginReturn(w http.ResponseWriter, path string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginReturnCookie,
+		Value:    path,
+		Path:     "/",
+		MaxAge:   int((15 * time.Minute).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		// Secure: true, // Enable in production with HTTPS
+	})
+}
+
+// popLoginReturn returns and clears the stored return path, or fallback when there is none.
+// Only local paths are followed so the cookie can't be used as an open redirect.
+func popLoginReturn(w http.ResponseWriter, r *http.Request, fallback string) string {
+	cookie, err := r.Cookie(loginReturnCookie)
+	if err != nil {
+		return fallback
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginReturnCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	path := cookie.Value
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return fallback
+	}
+	return path
+}
+
+// ContinueLoginHandler sends the user on after a login finished in the browser with javascript, e.g. with a passkey
+func ContinueLoginHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, popLoginReturn(w, r, "/twoauth/dashboard"), http.StatusSeeOther)
+}
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/services/oidc"
+)
+
+// consentPage is the data of the consent template
+type consentPage struct {
+	ClientName string
+	Email      string
+	Scopes     []string
+	Params     map[string]string // the authorization request, posted back with the decision
+}
+
+// OAuthClientRequest registers an app that logs its users in through this service
+type OAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes,omitempty"`
+	Confidential bool     `json:"confidential"`
+}
+
+// OAuthClientResponse is a registered client shown to admins. The secret is only set right after registration.
+type OAuthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newOAuthClientResponse(client db.OauthClient) OAuthClientResponse {
+	return OAuthClientResponse{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: oidc.RedirectURIs(client),
+		Scopes:       strings.Fields(client.Scopes),
+		Confidential: oidc.IsConfidential(client),
+		CreatedBy:    client.CreatedBy,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// GetOpenIDConfigurationHandler serves the OIDC discovery document
+func GetOpenIDConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	RespondWithJSON(r.Context(), w, http.StatusOK, oidc.Metadata())
+}
+
+// AuthorizeHandler is the OIDC authorization endpoint. GET starts the flow: users that aren't
+// logged in are sent to the login page and come back here afterwards, then they are asked for
+// consent unless they already gave it. POST receives the decision from the consent page,
+// the Lax jwt cookie is not sent on cross site posts so other sites can't approve for the user.
+func AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		renderOAuthError(w, r, http.StatusBadRequest, "The authorization request is malformed.")
+		return
+	}
+	params := r.URL.Query()
+	if r.Method == http.MethodPost {
+		params = r.PostForm
+	}
+
+	req, err := oidc.ParseAuthorizationRequest(ctx, params)
+	var oauthErr *oidc.Error
+	switch {
+	case errors.As(err, &oauthErr):
+		http.Redirect(w, r, req.ErrorRedirectURL(oauthErr), http.StatusFound)
+		return
+	case errors.Is(err, oidc.ErrClientNotFound), errors.Is(err, oidc.ErrRedirectURIMismatch):
+		logger.Warn(ctx, err, "rejected authorization request")
+		renderOAuthError(w, r, http.StatusBadRequest, "The application that sent you here is not registered correctly.")
+		return
+	case err != nil:
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+		return
+	}
+
+	user, amr, err := browserSessionUser(ctx)
+	if err != nil || req.Prompt == "login" {
+		if req.Prompt == "none" {
+			http.Redirect(w, r, req.ErrorRedirectURL(&oidc.Error{Code: "login_required"}), http.StatusFound)
+			return
+		}
+		// Come back without prompt=login, otherwise the user would be sent to log in forever
+		params.Del("prompt")
+		setLoginReturn(w, "/oauth/authorize?"+params.Encode())
+		if errors.Is(err, errMFAPending) {
+			http.Redirect(w, r, secondFactorPath(user), http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/two/login", http.StatusFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if r.PostForm.Get("decision") != "allow" {
+			http.Redirect(w, r, req.ErrorRedirectURL(&oidc.Error{Code: "access_denied", Description: "the user denied the request"}), http.StatusFound)
+			return
+		}
+		if err := oidc.GrantConsent(ctx, user.ID, req); err != nil {
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to store consent", err)
+			return
+		}
+	} else {
+		needsConsent, err := oidc.NeedsConsent(ctx, user.ID, req)
+		if err != nil {
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+			return
+		}
+		if needsConsent {
+			if req.Prompt == "none" {
+				http.Redirect(w, r, req.ErrorRedirectURL(&oidc.Error{Code: "consent_required"}), http.StatusFound)
+				return
+			}
+			renderConsent(w, r, user, req, params)
+			return
+		}
+	}
+
+	code, err := oidc.IssueAuthorizationCode(ctx, user, req, amr)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to issue authorization code", err)
+		return
+	}
+	http.Redirect(w, r, req.RedirectURL(url.Values{"code": {code}}), http.StatusFound)
+}
+
+// PostTokenHandler is the OIDC token endpoint, it exchanges an authorization code for tokens
+func PostTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Cache-Control", "no-store")
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(ctx, w, &oidc.Error{Code: "invalid_request", Description: "malformed form body"})
+		return
+	}
+	req := oidc.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	}
+	if id, secret, ok := r.BasicAuth(); ok {
+		// client_secret_basic encodes the credentials as form values
+		req.ClientID, _ = url.QueryUnescape(id)
+		req.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	resp, err := oidc.ExchangeCode(ctx, req)
+	if err != nil {
+		respondOAuthError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// UserInfoHandler returns the claims of the user an OIDC access token was issued for
+func UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Cache-Control", "no-store")
+	claims, err := oidc.UserInfo(ctx, jwtauth.TokenFromHeader(r))
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		respondOAuthError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, claims)
+}
+
+// PostOAuthClientHandler registers a client, its secret is only returned in this response
+func PostOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	var req OAuthClientRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	client, secret, err := oidc.RegisterClient(ctx, admin.ID, oidc.RegisterClientParams{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		Confidential: req.Confidential,
+	})
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidClientParams) {
+			RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to register client", err)
+		return
+	}
+	resp := newOAuthClientResponse(client)
+	resp.ClientSecret = secret
+	RespondWithJSON(ctx, w, http.StatusCreated, resp)
+}
+
+// GetOAuthClientsHandler lists the registered clients
+func GetOAuthClientsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	clients, err := oidc.ListClients(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to list clients", err)
+		return
+	}
+	resp := make([]OAuthClientResponse, 0, len(clients))
+	for _, client := range clients {
+		resp = append(resp, newOAuthClientResponse(client))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// DeleteOAuthClientHandler removes a client, its outstanding codes and tokens stop working
+func DeleteOAuthClientHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	if err := oidc.DeleteClient(ctx, admin.ID, chi.URLParam(r, "clientID")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			RespondWithError(ctx, w, http.StatusNotFound, "Client not found", err)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to delete client", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Client deleted",
+	})
+}
+
+// errMFAPending indicates the browser session still waits for its second factor
+var errMFAPending = errors.New("second factor pending")
+
+// browserSessionUser returns the user of the browser session and how they authenticated, for
+// routes that only run the Verifier because they handle logged out visitors themselves.
+// Revocation, the second factor and suspension are checked here like requireAuth does,
+// impersonation tokens are not a browser session of the user.
+func browserSessionUser(ctx context.Context) (db.User, []string, error) {
+	token, claims, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil {
+		return db.User{}, nil, jwtauth.ErrUnauthorized
+	}
+	jti, _ := claims[auth.ClaimTokenID].(string)
+	sessionID, _ := claims[auth.ClaimSessionID].(string)
+	if jti == "" || sessionID == "" {
+		return db.User{}, nil, jwtauth.ErrUnauthorized
+	}
+	revoked, err := auth.IsTokenRevoked(ctx, jti, sessionID)
+	if err != nil {
+		return db.User{}, nil, err
+	}
+	if revoked {
+		return db.User{}, nil, jwtauth.ErrUnauthorized
+	}
+	// An admin impersonating the user can't grant consent or link providers in their name
+	if auth.IsImpersonating(claims) {
+		return db.User{}, nil, jwtauth.ErrUnauthorized
+	}
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return db.User{}, nil, err
+	}
+	if auth.IsMFAPending(claims) {
+		return user, nil, errMFAPending
+	}
+	return user, auth.AMRFromClaims(claims), nil
+}
+
+// renderConsent asks the user to approve the requested scopes
+func renderConsent(w http.ResponseWriter, r *http.Request, user db.User, req oidc.AuthorizationRequest, params url.Values) {
+	page := consentPage{
+		ClientName: req.Client.Name,
+		Email:      user.Email,
+		Scopes:     req.Scopes,
+		Params:     map[string]string{},
+	}
+	for _, key := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+		if value := params.Get(key); value != "" {
+			page.Params[key] = value
+		}
+	}
+	if err := templates.ExecuteTemplate(w, "consent.html", page); err != nil {
+		RespondWithError(r.Context(), w, http.StatusInternalServerError, "Internal server error", err)
+	}
+}
+
+// renderOAuthError shows an authorization error to the user when the client can't be trusted with it
+func renderOAuthError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	w.WriteHeader(code)
+	if err := templates.ExecuteTemplate(w, "oauthError.html", struct{ Message string }{Message: message}); err != nil {
+		logger.Error(r.Context(), err, "failed to render oauth error page")
+	}
+}
+
+// respondOAuthError writes an OAuth error as JSON, invalid_client and invalid_token are 401s
+func respondOAuthError(ctx context.Context, w http.ResponseWriter, err error) {
+	var oauthErr *oidc.Error
+	if !errors.As(err, &oauthErr) {
+		logger.Error(ctx, err, "oauth request failed")
+		RespondWithJSON(ctx, w, http.StatusInternalServerError, oidc.Error{Code: "server_error"})
+		return
+	}
+	status := http.StatusBadRequest
+	if oauthErr.Code == "invalid_client" || oauthErr.Code == "invalid_token" {
+		status = http.StatusUnauthorized
+	}
+	logger.Warn(ctx, err, "oauth request rejected")
+	RespondWithJSON(ctx, w, status, oauthErr)
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+// passkeySessionCookie links the finish step of a passkey ceremony to the challenge from its begin step
+const passkeySessionCookie = "webauthn_session"
+
+// PasskeyResponse is a registered passkey as shown to its owner
+type PasskeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// PasskeyChangeRequest re-authenticates the user before a passkey is added or removed.
+// Passkey is an assertion for the challenge from /passkeys/reauth/begin and replaces the password and code.
+type PasskeyChangeRequest struct {
+	Password string          `json:"password"`
+	OTPCode  string          `json:"otp_code"`
+	Passkey  json.RawMessage `json:"passkey,omitempty"`
+}
+
+func newPasskeyResponse(cred db.WebauthnCredential) PasskeyResponse {
+	resp := PasskeyResponse{
+		ID:        cred.ID,
+		Name:      cred.Name,
+		CreatedAt: cred.CreatedAt,
+	}
+	if cred.LastUsedAt.Valid {
+		resp.LastUsedAt = &cred.LastUsedAt.Time
+	}
+	return resp
+}
+
+// GetPasskeyLoginPage renders the passwordless passkey login page
+func GetPasskeyLoginPage(w http.ResponseWriter, r *http.Request) {
+	renderPasskeyPage(w, r, "passkeyLogin.html")
+}
+
+// PostPasskeyLoginBeginHandler returns the options for navigator.credentials.get for a passwordless login
+func PostPasskeyLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	assertion, token, err := userService.BeginPasskeyLogin(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to start passkey login", err)
+		return
+	}
+	setPasskeySessionCookie(w, token)
+	RespondWithJSON(ctx, w, http.StatusOK, assertion)
+}
+
+// PostPasskeyLoginFinishHandler verifies the passkey assertion and logs the user in.
+// A passkey with user verification counts as both factors, so no OTP is asked afterwards.
+func PostPasskeyLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := passkeySessionToken(w, r)
+	user, err := userService.FinishPasskeyLogin(ctx, token, r.Body)
+	if err != nil {
+		respondPasskeyError(ctx, w, err)
+		return
+	}
+	if auth.IsSuspended(user) {
+		RespondWithError(ctx, w, http.StatusForbidden, "Account is suspended", auth.ErrUserSuspended)
+		return
+	}
+	if auth.LoginBlockedByVerification(user) {
+		RespondWithError(ctx, w, http.StatusForbidden, "Please verify your email address before logging in", userService.ErrEmailNotVerified)
+		return
+	}
+
+	pair, err := issueLoginTokens(ctx, w, user, auth.AMRPasskey)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to issue tokens", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, newLoginResponse(user, pair))
+}
+
+// GetPasskeyVerifyPage renders the page that uses a passkey as the second factor
+func GetPasskeyVerifyPage(w http.ResponseWriter, r *http.Request) {
+	renderPasskeyPage(w, r, "passkeyVerify.html")
+}
+
+// PostPasskeyMFABeginHandler challenges the passkeys of a user whose session waits for the second factor
+func PostPasskeyMFABeginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	assertion, token, err := userService.BeginPasskeySecondFactor(ctx, user)
+	if err != nil {
+		respondPasskeyError(ctx, w, err)
+		return
+	}
+	setPasskeySessionCookie(w, token)
+	RespondWithJSON(ctx, w, http.StatusOK, assertion)
+}
+
+// PostPasskeyMFAFinishHandler verifies the passkey and upgrades the session like a valid OTP does
+func PostPasskeyMFAFinishHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	token := passkeySessionToken(w, r)
+	if err := userService.FinishPasskeySecondFactor(ctx, user, token, r.Body); err != nil {
+		respondPasskeyError(ctx, w, err)
+		return
+	}
+
+	_, claims, _ := jwtauth.FromContext(ctx)
+	sessionID, _ := claims[auth.ClaimSessionID].(string)
+	pair, err := auth.CompleteMFA(ctx, user, sessionID, auth.AMRFromClaims(claims), auth.AMRPasskey)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to issue tokens", err)
+		return
+	}
+	setTokenCookies(w, pair)
+	RespondWithJSON(ctx, w, http.StatusOK, newLoginResponse(user, pair))
+}
+
+// GetPasskeyRegisterPage renders the page for adding a passkey to the logged in account
+func GetPasskeyRegisterPage(w http.ResponseWriter, r *http.Request) {
+	renderPasskeyPage(w, r, "passkeyRegister.html")
+}
+
+// PostPasskeyReauthBeginHandler challenges the user's passkeys so one of them can confirm adding or removing a passkey
+func PostPasskeyReauthBeginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	assertion, token, err := userService.BeginPasskeyReauth(ctx, user)
+	if err != nil {
+		respondPasskeyError(ctx, w, err)
+		return
+	}
+	setPasskeySessionCookie(w, token)
+	RespondWithJSON(ctx, w, http.StatusOK, assertion)
+}
+
+// PostPasskeyRegisterBeginHandler re-authenticates the user and returns the options for navigator.credentials.create
+func PostPasskeyRegisterBeginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	if !reauthenticatePasskeyChange(w, r, user) {
+		return
+	}
+	creation, token, err := userService.BeginPasskeyRegistration(ctx, user)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to start passkey registration", err)
+		return
+	}
+	setPasskeySessionCookie(w, token)
+	RespondWithJSON(ctx, w, http.StatusOK, creation)
+}
+
+// PostPasskeyRegisterFinishHandler stores the new passkey, its label comes from the name query parameter.
+// It needs no re-authentication of its own, the challenge it answers is only issued after one.
+func PostPasskeyRegisterFinishHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	token := passkeySessionToken(w, r)
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	cred, err := userService.FinishPasskeyRegistration(ctx, user, token, name, r.Body)
+	if err != nil {
+		respondPasskeyError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusCreated, newPasskeyResponse(cred))
+}
+
+// GetPasskeysHandler lists the passkeys of the logged in user
+func GetPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	creds, err := userService.ListPasskeys(ctx, user.ID)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to list passkeys", err)
+		return
+	}
+	resp := make([]PasskeyResponse, 0, len(creds))
+	for _, cred := range creds {
+		resp = append(resp, newPasskeyResponse(cred))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// DeletePasskeyHandler removes one of the logged in user's passkeys after re-authentication
+func DeletePasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	if !reauthenticatePasskeyChange(w, r, user) {
+		return
+	}
+	if err := userService.DeletePasskey(ctx, user.ID, chi.URLParam(r, "passkeyID")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			RespondWithError(ctx, w, http.StatusNotFound, "Passkey not found", err)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to delete passkey", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Passkey deleted",
+	})
+}
+
+// reauthenticatePasskeyChange checks the PasskeyChangeRequest in the body, it responds and returns false on failure
+func reauthenticatePasskeyChange(w http.ResponseWriter, r *http.Request, user db.User) bool {
+	ctx := r.Context()
+	var req PasskeyChangeRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return false
+	}
+	reauth := userService.PasskeyReauth{Password: req.Password, OTPCode: req.OTPCode}
+	if len(req.Passkey) > 0 {
+		reauth.Token = passkeySessionToken(w, r)
+		reauth.Assertion = req.Passkey
+	}
+	err := userService.ReauthenticatePasskeyChange(ctx, user, reauth)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, userService.ErrPasskeyReauthRequired):
+		RespondWithError(ctx, w, http.StatusUnauthorized, err.Error(), err)
+	case errors.Is(err, userService.ErrPasskeyInvalid), errors.Is(err, userService.ErrPasskeySessionInvalid):
+		respondPasskeyError(ctx, w, err)
+	default:
+		if isSecondFactorFailure(err) {
+			auditSecondFactorFailure(r, user, err)
+		}
+		respondReauthError(ctx, w, err)
+	}
+	return false
+}
+
+// renderPasskeyPage executes one of the passkey templates
+func renderPasskeyPage(w http.ResponseWriter, r *http.Request, name string) {
+	if err := templates.ExecuteTemplate(w, name, nil); err != nil {
+		RespondWithError(r.Context(), w, http.StatusInternalServerError, "Internal server error", err)
+	}
+}
+
+// setPasskeySessionCookie stores the challenge token until the browser answers it
+func setPasskeySessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeySessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int((5 * time.Minute).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		// Secure: true, // Enable in production with HTTPS
+	})
+}
+
+// passkeySessionToken reads the challenge token and clears its cookie, every challenge is single use
+func passkeySessionToken(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(passkeySessionCookie)
+	if err != nil {
+		return ""
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeySessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return cookie.Value
+}
+
+// respondPasskeyError maps passkey ceremony errors to responses
+func respondPasskeyError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, userService.ErrPasskeySessionInvalid):
+		RespondWithError(ctx, w, http.StatusBadRequest, "Passkey challenge expired, please try again", err)
+	case errors.Is(err, userService.ErrNoPasskeys):
+		RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, userService.ErrPasskeyInvalid), errors.Is(err, sql.ErrNoRows):
+		RespondWithError(ctx, w, http.StatusUnauthorized, "Passkey verification failed", err)
+	default:
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/nikojunttila/community/internal/auth"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+// errMissingResetToken indicates the reset form was submitted without its token.
+var errMissingResetToken = errors.New("reset token is required")
+
+// GetForgotPasswordPage renders the form for requesting a password reset email.
+func GetForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	if err := templates.ExecuteTemplate(w, "forgotPassword.html", nil); err != nil {
+		RespondWithError(r.Context(), w, http.StatusInternalServerError, "internal server error", err)
+	}
+}
+
+// PostForgotPasswordHandler emails a reset link if the address belongs to an email/password account.
+// The response is the same whether or not the account exists.
+func PostForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		RespondWithError(ctx, w, http.StatusBadRequest, "invalid form data", err)
+		return
+	}
+
+	address := strings.TrimSpace(strings.ToLower(r.FormValue("email")))
+	if !emailRegex.MatchString(address) {
+		RespondWithError(ctx, w, http.StatusBadRequest, ErrInvalidEmail.Error(), userService.ErrParamsMismatch)
+		return
+	}
+
+	if err := userService.RequestPasswordReset(ctx, address); err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusAccepted, map[string]string{
+		"message": "If an account exists for this email a reset link has been sent",
+	})
+}
+
+// GetResetPasswordPage renders the new password form for the token in the emailed link.
+func GetResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	data := struct{ Token string }{Token: r.URL.Query().Get("token")}
+	if err := templates.ExecuteTemplate(w, "resetPassword.html", data); err != nil {
+		RespondWithError(r.Context(), w, http.StatusInternalServerError, "internal server error", err)
+	}
+}
+
+// PostResetPasswordHandler sets a new password using a single-use reset token.
+// All existing sessions of the user are revoked.
+func PostResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		RespondWithError(ctx, w, http.StatusBadRequest, "invalid form data", err)
+		return
+	}
+
+	token := r.FormValue("token")
+	password := r.FormValue("password")
+	if token == "" {
+		RespondWithError(ctx, w, http.StatusBadRequest, errMissingResetToken.Error(), userService.ErrParamsMismatch)
+		return
+	}
+	if _, err := userService.ResetPassword(ctx, token, password); err != nil {
+		if errors.Is(err, userService.ErrResetTokenInvalid) {
+			RespondWithError(ctx, w, http.StatusBadRequest, "Reset link is invalid or expired", err)
+			return
+		}
+		if errors.Is(err, auth.ErrPasswordPolicy) {
+			RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), userService.ErrTooWeakPassword)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to reset password", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Password has been reset, please log in again",
+	})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/middleware"
+	userService "github.com/nikojunttila/community/internal/services/user"
+	"github.com/rs/zerolog/log"
+)
+
+// TwoFactorReauthRequest re-authenticates the user before changing their second factor.
+// Password is ignored for OAuth accounts without one.
+type TwoFactorReauthRequest struct {
+	Password string `json:"password"`
+	OTPCode  string `json:"otp_code"`
+}
+
+// RecoveryCodesResponse holds freshly generated recovery codes. They are only shown once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// RecoveryCodeHandler lets an mfa pending session finish login with a recovery code instead of an OTP
+func RecoveryCodeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		data := struct{ Error string }{Error: r.URL.Query().Get("error")}
+		if err := templates.ExecuteTemplate(w, "recovery.html", data); err != nil {
+			log.Error().Msgf("Template error: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+
+	case "POST":
+		ctx := r.Context()
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+		user, err := cache.GetUser(ctx)
+		if err != nil || user.Secret == "" {
+			http.Redirect(w, r, "/two/login", http.StatusFound)
+			return
+		}
+
+		if err := userService.RedeemRecoveryCode(ctx, user.ID, r.FormValue("recoveryCode")); err != nil {
+			if !isSecondFactorFailure(err) {
+				RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+				return
+			}
+			logger.Warn(ctx, err, "invalid recovery code for user "+user.ID)
+			auditSecondFactorFailure(r, user, err)
+			http.Redirect(w, r, "/twoauth/recovery?error="+secondFactorErrorCode(err), http.StatusSeeOther)
+			return
+		}
+
+		_, claims, _ := jwtauth.FromContext(ctx)
+		sessionID, _ := claims[auth.ClaimSessionID].(string)
+		pair, err := auth.CompleteMFA(ctx, user, sessionID, auth.AMRFromClaims(claims), auth.AMRRecovery)
+		if err != nil {
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to issue tokens", err)
+			return
+		}
+		setTokenCookies(w, pair)
+		http.Redirect(w, r, popLoginReturn(w, r, "/twoauth/dashboard"), http.StatusSeeOther)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// PostRegenerateRecoveryCodesHandler replaces the user's recovery codes after re-authentication
+func PostRegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	var req TwoFactorReauthRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	if err := userService.ReauthenticateTwoFactor(ctx, user, req.Password, req.OTPCode); err != nil {
+		if isSecondFactorFailure(err) {
+			auditSecondFactorFailure(r, user, err)
+		}
+		respondReauthError(ctx, w, err)
+		return
+	}
+
+	codes, err := userService.GenerateRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to generate recovery codes", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// PostDisableTwoFactorHandler removes the user's TOTP secret and recovery codes after re-authentication
+func PostDisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	var req TwoFactorReauthRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	if err := userService.ReauthenticateTwoFactor(ctx, user, req.Password, req.OTPCode); err != nil {
+		if isSecondFactorFailure(err) {
+			auditSecondFactorFailure(r, user, err)
+		}
+		respondReauthError(ctx, w, err)
+		return
+	}
+
+	if err := userService.DisableTwoFactor(ctx, user); err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to disable two-factor authentication", err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// respondReauthError maps re-authentication failures to responses
+func respondReauthError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, userService.ErrTwoFactorNotEnabled):
+		RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, userService.ErrOTPLocked):
+		RespondWithError(ctx, w, http.StatusTooManyRequests, err.Error(), err)
+	case errors.Is(err, userService.ErrWrongPassword), isSecondFactorFailure(err):
+		RespondWithError(ctx, w, http.StatusUnauthorized, "Invalid password or code", err)
+	default:
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+	}
+}
+
+// isSecondFactorFailure reports whether err is a rejected OTP or recovery code rather than an internal error
+func isSecondFactorFailure(err error) bool {
+	return errors.Is(err, userService.ErrOTPInvalid) ||
+		errors.Is(err, userService.ErrOTPReplayed) ||
+		errors.Is(err, userService.ErrOTPLocked) ||
+		errors.Is(err, userService.ErrRecoveryCodeInvalid)
+}
+
+// secondFactorErrorCode is the error query parameter shown by the OTP and recovery templates
+func secondFactorErrorCode(err error) string {
+	if errors.Is(err, userService.ErrOTPLocked) {
+		return "locked"
+	}
+	return "invalid"
+}
+
+// auditSecondFactorFailure records a failed second factor attempt in the audit log
+func auditSecondFactorFailure(r *http.Request, user db.User, err error) {
+	action := "OTP_INVALID"
+	status := http.StatusUnauthorized
+	switch {
+	case errors.Is(err, userService.ErrOTPLocked):
+		action = "OTP_LOCKED"
+		status = http.StatusTooManyRequests
+	case errors.Is(err, userService.ErrOTPReplayed):
+		action = "OTP_REPLAYED"
+	case errors.Is(err, userService.ErrRecoveryCodeInvalid):
+		action = "RECOVERY_CODE_INVALID"
+	}
+	middleware.LogUserSecurityEvent(r, user, action, status)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	userS "github.com/nikojunttila/community/internal/services/user"
+)
+
+// RoleResponse is a role with its own and inherited permissions
+type RoleResponse struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	ParentRole  string    `json:"parent_role,omitempty"`
+	Permissions []string  `json:"permissions"` // inherited ones included
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateRoleRequest adds a role, parent_role is the role it inherits permissions from
+type CreateRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	ParentRole  string   `json:"parent_role"`
+	Permissions []string `json:"permissions"`
+}
+
+// RolePermissionsRequest replaces the permissions granted directly to a role
+type RolePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+// AssignRoleRequest changes the role of a user
+type AssignRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// GetRolesHandler lists the roles and what each of them is allowed to do
+func GetRolesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roles, err := userS.ListRoles(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to list roles", err)
+		return
+	}
+	graph, err := auth.Roles(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to list roles", err)
+		return
+	}
+	resp := make([]RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		resp = append(resp, RoleResponse{
+			Name:        role.Name,
+			Description: role.Description,
+			ParentRole:  role.ParentRole,
+			Permissions: nonNil(graph.Permissions(role.Name)),
+			CreatedAt:   role.CreatedAt,
+		})
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// PostRoleHandler creates a role, optionally with permissions of its own
+func PostRoleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req CreateRoleRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	role, err := userS.CreateRole(ctx, req.Name, req.Description, req.ParentRole)
+	if err != nil {
+		respondRoleError(ctx, w, err)
+		return
+	}
+	permissions, err := userS.SetRolePermissions(ctx, role.Name, req.Permissions)
+	if err != nil {
+		respondRoleError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusCreated, RoleResponse{
+		Name:        role.Name,
+		Description: role.Description,
+		ParentRole:  role.ParentRole,
+		Permissions: nonNil(permissions),
+		CreatedAt:   role.CreatedAt,
+	})
+}
+
+// PutRolePermissionsHandler replaces the permissions of the role in the URL.
+// Tokens keep working, RequirePermission picks the change up on the next request.
+func PutRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req RolePermissionsRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	role := chi.URLParam(r, "role")
+	permissions, err := userS.SetRolePermissions(ctx, role, req.Permissions)
+	if err != nil {
+		respondRoleError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]any{
+		"role":        role,
+		"permissions": nonNil(permissions),
+	})
+}
+
+// PutUserRoleHandler assigns the role in the body to the user in the URL
+func PutUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	admin, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	var req AssignRoleRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return
+	}
+	user, err := userS.AssignRole(ctx, admin.ID, chi.URLParam(r, "userID"), req.Role)
+	if err != nil {
+		respondUserAdminError(ctx, w, err)
+		return
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"id":    user.ID,
+		"email": user.Email,
+		"role":  user.Role,
+	})
+}
+
+// respondRoleError maps errors from role management to responses
+func respondRoleError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, userS.ErrInvalidRole), errors.Is(err, userS.ErrInvalidPermission):
+		RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), err)
+	case errors.Is(err, userS.ErrRoleExists):
+		RespondWithError(ctx, w, http.StatusConflict, err.Error(), err)
+	default:
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to update role", err)
+	}
+}
+
+// nonNil keeps empty permission lists as [] instead of null in responses
+func nonNil(permissions []string) []string {
+	if permissions == nil {
+		return []string{}
+	}
+	return permissions
+}
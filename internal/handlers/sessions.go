@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+)
+
+// SessionResponse is a device the user is signed in on
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // the session making this request
+}
+
+func newSessionResponse(session db.Session, currentID string) SessionResponse {
+	return SessionResponse{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IpAddress,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.ID == currentID,
+	}
+}
+
+// currentSessionID returns the sid claim of the request's access token
+func currentSessionID(r *http.Request) string {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	sessionID, _ := claims[auth.ClaimSessionID].(string)
+	return sessionID
+}
+
+// GetSessionsHandler lists the devices the logged in user is signed in on
+func GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	sessions, err := auth.ListSessions(ctx, user.ID)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to list sessions", err)
+		return
+	}
+	currentID := currentSessionID(r)
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, newSessionResponse(session, currentID))
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, resp)
+}
+
+// DeleteSessionHandler signs one device out. Revoking the current session logs this browser out too.
+func DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	sessionID := chi.URLParam(r, "sessionID")
+	if err := auth.RevokeUserSession(ctx, user.ID, sessionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			RespondWithError(ctx, w, http.StatusNotFound, "Session not found", err)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to revoke session", err)
+		return
+	}
+	if sessionID == currentSessionID(r) {
+		clearTokenCookies(w)
+	}
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Session revoked",
+	})
+}
+
+// DeleteSessionsHandler signs the user out everywhere and revokes their personal access tokens.
+// With ?keep_current=true only the other sessions are signed out and the tokens are kept.
+func DeleteSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := cache.GetUser(ctx)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
+		return
+	}
+	if r.URL.Query().Get("keep_current") == "true" {
+		if err := auth.RevokeOtherSessions(ctx, user.ID, currentSessionID(r)); err != nil {
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to revoke sessions", err)
+			return
+		}
+		RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+			"message": "Signed out of all other sessions",
+		})
+		return
+	}
+	if err := auth.RevokeAllUserSessions(ctx, user.ID); err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to revoke sessions", err)
+		return
+	}
+	clearTokenCookies(w)
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Signed out everywhere",
+	})
+}
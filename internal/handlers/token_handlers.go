@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+)
+
+// refreshCookieName is scoped to /auth so the refresh token is only sent to the endpoints that consume it
+const refreshCookieName = "refresh_token"
+
+// errMissingRefreshToken indicates neither a cookie nor a body carried a refresh token.
+var errMissingRefreshToken = errors.New("refresh token is required")
+
+// RefreshRequest represents the optional JSON payload for API clients that do not use cookies.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueLoginTokens starts a new session for the user and sets the token cookies.
+// methods are the authentication methods the user just passed, e.g. auth.AMRPassword.
+func issueLoginTokens(ctx context.Context, w http.ResponseWriter, user db.User, methods ...string) (auth.TokenPair, error) {
+	pair, err := auth.IssueTokenPair(ctx, user, methods...)
+	if err != nil {
+		return auth.TokenPair{}, err
+	}
+	setTokenCookies(w, pair)
+	return pair, nil
+}
+
+// setTokenCookies stores the access token in the "jwt" cookie read by jwtauth.Verifier
+// and the refresh token in a cookie only sent to /auth.
+func setTokenCookies(w http.ResponseWriter, pair auth.TokenPair) {
+	setAccessTokenCookie(w, pair.AccessToken, pair.AccessExpiresAt)
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    pair.RefreshToken,
+		Path:     "/auth",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Expires:  pair.RefreshExpiresAt,
+		// Secure: true, // Enable in production with HTTPS
+	})
+}
+
+// setAccessTokenCookie stores only the access token, e.g. for impersonation which has no refresh token
+func setAccessTokenCookie(w http.ResponseWriter, accessToken string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "jwt", // Must be "jwt" to be recognized by jwtauth.Verifier
+		Value:    accessToken,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  expiresAt,
+		// Secure: true, // Enable in production with HTTPS
+	})
+}
+
+// clearAccessTokenCookie expires the access token cookie and leaves the refresh cookie alone
+func clearAccessTokenCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "jwt",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+}
+
+// clearTokenCookies expires both token cookies in the browser
+func clearTokenCookies(w http.ResponseWriter) {
+	clearAccessTokenCookie(w)
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    "",
+		Path:     "/auth",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+}
+
+// refreshTokenFromRequest reads the refresh token from its cookie or from a JSON body.
+// It returns false if a body was present but could not be decoded (response already sent).
+func refreshTokenFromRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if cookie, err := r.Cookie(refreshCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+	if r.ContentLength == 0 {
+		return "", true
+	}
+	var req RefreshRequest
+	if !DecodeJSONBody(w, r, &req, 0) {
+		return "", false
+	}
+	return req.RefreshToken, true
+}
+
+// PostRefreshTokenHandler exchanges a refresh token for a new access and refresh token pair.
+func PostRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	refreshToken, ok := refreshTokenFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if refreshToken == "" {
+		RespondWithError(ctx, w, http.StatusUnauthorized, "Refresh token is required", errMissingRefreshToken)
+		return
+	}
+
+	pair, err := auth.RotateRefreshToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshTokenInvalid) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			clearTokenCookies(w)
+			RespondWithError(ctx, w, http.StatusUnauthorized, "Invalid refresh token", err)
+			return
+		}
+		if errors.Is(err, auth.ErrUserSuspended) {
+			clearTokenCookies(w)
+			RespondWithError(ctx, w, http.StatusForbidden, "Account is suspended", err)
+			return
+		}
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to refresh token", err)
+		return
+	}
+	setTokenCookies(w, pair)
+
+	RespondWithJSON(ctx, w, http.StatusOK, LoginResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    int64(time.Until(pair.AccessExpiresAt).Seconds()),
+	})
+}
+
+// PostLogoutHandler revokes the current access token and its session, then clears the cookies.
+// It works with an expired access token as long as the refresh token is still presented.
+func PostLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// The Verifier sets the token even when it is expired, only trust it if it fully validated.
+	// Personal access tokens are revoked through /auth/tokens, not by logging out.
+	if token, claims, err := jwtauth.FromContext(ctx); err == nil && token != nil && token.JwtID() != "" && !auth.IsPersonalAccessToken(claims) {
+		if err := auth.RevokeAccessToken(ctx, token.JwtID(), token.Expiration()); err != nil {
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to revoke token", err)
+			return
+		}
+		if sessionID, _ := claims[auth.ClaimSessionID].(string); sessionID != "" {
+			if err := auth.RevokeSession(ctx, sessionID); err != nil {
+				RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to revoke session", err)
+				return
+			}
+		}
+	}
+
+	refreshToken, ok := refreshTokenFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if refreshToken != "" {
+		if err := auth.RevokeRefreshToken(ctx, refreshToken); err != nil {
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to revoke session", err)
+			return
+		}
+	}
+
+	clearTokenCookies(w)
+	RespondWithJSON(ctx, w, http.StatusOK, map[string]string{
+		"message": "Logged out",
+	})
+}
@@ -11,8 +11,8 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 
+	"github.com/go-chi/jwtauth/v5"
 	"github.com/nikojunttila/community/internal/auth"
 	"github.com/nikojunttila/community/internal/cache"
 	"github.com/nikojunttila/community/internal/db"
@@ -60,9 +60,13 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/two/login", http.StatusFound)
 		return
 	}
+	if loginThrottled(w, r, email) {
+		return
+	}
 	user, err := db.Get().GetUserByEmail(r.Context(), email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			recordFailedLogin(r, email)
 			// Don't reveal whether user exists or password is wrong for security
 			RespondWithError(r.Context(), w, http.StatusUnauthorized, "Invalid email or password", userService.ErrWrongPassword)
 			return
@@ -72,41 +76,54 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		RespondWithError(r.Context(), w, http.StatusInternalServerError, "Internal server error", err)
 		return
 	}
-	if user.Provider != string(userService.GetServiceEnumName(userService.Email)) {
-		RespondWithError(r.Context(), w, http.StatusBadRequest,
-			"Please use the authentication method you originally signed up with",
-			userService.ErrIncorrectAuthType)
+	// Passwordless accounts fail like a wrong password, see PostLoginHandler
+	if user.PasswordHash == "" || !auth.CheckPasswordHash(password, user.PasswordHash) {
+		recordFailedLogin(r, email)
+		RespondWithError(r.Context(), w, http.StatusUnauthorized, "Invalid email or password", userService.ErrWrongPassword)
 		return
 	}
-	if !auth.CheckPasswordHash(password, user.PasswordHash) {
-		RespondWithError(r.Context(), w, http.StatusUnauthorized, "Invalid email or password", userService.ErrWrongPassword)
+	if auth.IsSuspended(user) {
+		RespondWithError(r.Context(), w, http.StatusForbidden, "Account is suspended", auth.ErrUserSuspended)
 		return
 	}
-	// Generate JWT token
-	token := auth.MakeToken(user.LookupID, user.Role)
-	// Set secure cookie
-	cookie := &http.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-		// Secure: true, // Enable in production with HTTPS
+	if auth.LoginBlockedByVerification(user) {
+		RespondWithError(r.Context(), w, http.StatusForbidden, "Please verify your email address before logging in", userService.ErrEmailNotVerified)
+		return
+	}
+	recordSuccessfulLogin(r, email)
+	userService.UpgradePasswordHash(r.Context(), user, password)
+	// Start a session and set the token cookies
+	pair, err := issueLoginTokens(r.Context(), w, user, auth.AMRPassword)
+	if err != nil {
+		RespondWithError(r.Context(), w, http.StatusInternalServerError, "Failed to issue tokens", err)
+		return
 	}
-	http.SetCookie(w, cookie)
 
+	if !pair.MFAPending {
+		// No second factor enrolled, continue where the login started or offer to set one up
+		http.Redirect(w, r, popLoginReturn(w, r, "/twoauth/generate-otp"), http.StatusFound)
+		return
+	}
 	if user.Secret == "" {
-		http.Redirect(w, r, "/two/generate-otp?email="+url.QueryEscape(email), http.StatusFound)
+		// Passkeys are the only second factor
+		http.Redirect(w, r, secondFactorPath(user), http.StatusFound)
 		return
 	}
-	err = templates.ExecuteTemplate(w, "validate.html", struct{ Email string }{Email: email})
+	err = templates.ExecuteTemplate(w, "validate.html", struct{ Error string }{})
 	if err != nil {
 		log.Error().Msgf("Template error: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
+// secondFactorPath is the page that finishes login for a user with an mfa pending session
+func secondFactorPath(user db.User) string {
+	if user.Secret == "" {
+		return "/twoauth/passkey"
+	}
+	return "/twoauth/validate-otp"
+}
+
 // GetGenerateOTPHandler page for generating 2 factor auth code
 func GetGenerateOTPHandler(w http.ResponseWriter, r *http.Request) {
 	user, err := cache.GetUser(r.Context())
@@ -114,8 +131,10 @@ func GetGenerateOTPHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/two/login", http.StatusFound)
 		return
 	}
+	var secret string
+	var recoveryCodes []string
 	if user.Secret == "" {
-		secret, err := totp.Generate(totp.GenerateOpts{
+		key, err := totp.Generate(totp.GenerateOpts{
 			Issuer:      "Go2FADemo",
 			AccountName: user.Email,
 		})
@@ -124,21 +143,45 @@ func GetGenerateOTPHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Failed to generate TOTP secret.", http.StatusInternalServerError)
 			return
 		}
-		log.Info().Msgf("Generated TOTP secret for user %s: %s", user.Email, secret.Secret())
-		user.Secret = secret.Secret()
+		log.Info().Msgf("Generated TOTP secret for user %s", user.Email)
+		secret = key.Secret()
+		// Only the sealed secret is stored
+		sealed, err := auth.SealSecret(user.ID, secret)
+		if err != nil {
+			log.Error().Msgf("Failed to encrypt secret for %s: %v", user.Email, err)
+			http.Error(w, "Failed to update secret.", http.StatusInternalServerError)
+			return
+		}
 		if err := db.Get().UpdateUserSecret(r.Context(), db.UpdateUserSecretParams{
-			Secret: secret.Secret(),
+			Secret: sealed,
 			ID:     user.ID,
 		}); err != nil {
 			log.Error().Msgf("Failed to update secret for %s: %v", user.Email, err)
 			http.Error(w, "Failed to update secret.", http.StatusInternalServerError)
+			return
+		}
+		cache.RemoveUser(user.LookupID)
+
+		// Shown once together with the secret so a lost device doesn't lock the user out
+		recoveryCodes, err = userService.GenerateRecoveryCodes(r.Context(), user.ID)
+		if err != nil {
+			log.Error().Msgf("Failed to generate recovery codes for %s: %v", user.Email, err)
+			http.Error(w, "Failed to generate recovery codes.", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		secret, err = auth.OpenSecret(user.ID, user.Secret)
+		if err != nil {
+			log.Error().Msgf("Failed to decrypt secret for %s: %v", user.Email, err)
+			http.Error(w, "Failed to read secret.", http.StatusInternalServerError)
+			return
 		}
 	}
 
 	// Build the OTP URL
 	otpURL := fmt.Sprintf("otpauth://totp/Go2FADemo:%s?secret=%s&issuer=Go2FADemo",
 		url.QueryEscape(user.Email),
-		user.Secret)
+		secret)
 
 	qrCodeBase64, err := generateQRCodeBase64(otpURL)
 	if err != nil {
@@ -148,15 +191,17 @@ func GetGenerateOTPHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		OTPURL     string
-		Email      string
-		Secret     string
-		QRCodeData string
+		OTPURL        string
+		Email         string
+		Secret        string
+		QRCodeData    string
+		RecoveryCodes []string
 	}{
-		OTPURL:     otpURL,
-		Email:      user.Email,
-		Secret:     user.Secret,
-		QRCodeData: qrCodeBase64,
+		OTPURL:        otpURL,
+		Email:         user.Email,
+		Secret:        secret,
+		QRCodeData:    qrCodeBase64,
+		RecoveryCodes: recoveryCodes,
 	}
 
 	err = templates.ExecuteTemplate(w, "qrcode.html", data)
@@ -166,81 +211,88 @@ func GetGenerateOTPHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// ValidateOTPHandler is for 2 factor auth validation
+// ValidateOTPHandler is for 2 factor auth validation. A valid code upgrades the
+// session so its tokens carry the otp method and are no longer mfa pending.
 func ValidateOTPHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
-		user, err := cache.GetUser(r.Context())
-		if err != nil {
-			http.Redirect(w, r, "/two/login", http.StatusFound)
-			return
-		}
-		err = templates.ExecuteTemplate(w, "validate.html", struct{ Email string }{Email: user.Email})
-		if err != nil {
+		data := struct{ Error string }{Error: r.URL.Query().Get("error")}
+		if err := templates.ExecuteTemplate(w, "validate.html", data); err != nil {
 			log.Error().Msgf("Template error: %v", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
 
 	case "POST":
+		ctx := r.Context()
 		if err := r.ParseForm(); err != nil {
 			log.Error().Msgf("Form parse error: %v", err)
 			http.Error(w, "Error parsing form", http.StatusBadRequest)
 			return
 		}
 
-		email := strings.TrimSpace(r.FormValue("email"))
 		otpCode := strings.TrimSpace(r.FormValue("otpCode"))
 		otpCode = strings.ReplaceAll(otpCode, " ", "")
 
 		// Validate input
-		if email == "" || otpCode == "" {
-			http.Redirect(w, r, "/two/login", http.StatusFound)
+		if otpCode == "" {
+			http.Redirect(w, r, "/twoauth/validate-otp?error=missing", http.StatusSeeOther)
 			return
 		}
 
-		user, err := cache.GetUser(r.Context())
+		user, err := cache.GetUser(ctx)
 		if err != nil || user.Secret == "" {
 			log.Error().Msgf("User %s does not exist or has no secret", user.Email)
 			http.Redirect(w, r, "/two/login", http.StatusFound)
 			return
 		}
-		// CRITICAL: Debug logging to help troubleshoot
-		log.Info().Msgf("Validating TOTP for user %s with code %s and secret %s", email, otpCode, user.Secret)
-		// Validate the TOTP code
-		isValid := totp.Validate(otpCode, user.Secret)
-		if !isValid {
-			log.Warn().Msgf("Invalid TOTP code for user %s: provided=%s", email, otpCode)
+		// Validate the TOTP code, rejects replays and throttles repeated failures
+		if err := userService.ValidateTOTP(ctx, user, otpCode); err != nil {
+			if !isSecondFactorFailure(err) {
+				RespondWithError(ctx, w, http.StatusInternalServerError, "Internal server error", err)
+				return
+			}
+			log.Warn().Msgf("Invalid TOTP code for user %s: %v", user.Email, err)
+			auditSecondFactorFailure(r, user, err)
 
 			// Redirect back to validation page with error
-			http.Redirect(w, r, fmt.Sprintf("/two/validate-otp?username=%s&error=invalid", url.QueryEscape(email)), http.StatusTemporaryRedirect)
+			http.Redirect(w, r, "/twoauth/validate-otp?error="+secondFactorErrorCode(err), http.StatusSeeOther)
 			return
 		}
-		log.Info().Msgf("TOTP validation successful for user %s", email)
-		// Set session cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "authenticatedUser",
-			Value:    email, // Store username instead of just "true"
-			Path:     "/",
-			MaxAge:   3600,
-			HttpOnly: true,  // Security improvement
-			Secure:   false, // Set to true in production with HTTPS
-		})
-		http.Redirect(w, r, "/two/dashboard", http.StatusSeeOther)
+		log.Info().Msgf("TOTP validation successful for user %s", user.Email)
+
+		// Swap the password-only session for one that records the second factor
+		_, claims, _ := jwtauth.FromContext(ctx)
+		sessionID, _ := claims[auth.ClaimSessionID].(string)
+		pair, err := auth.CompleteMFA(ctx, user, sessionID, auth.AMRFromClaims(claims), auth.AMROTP)
+		if err != nil {
+			RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to issue tokens", err)
+			return
+		}
+		setTokenCookies(w, pair)
+		http.Redirect(w, r, popLoginReturn(w, r, "/twoauth/dashboard"), http.StatusSeeOther)
 
 	default:
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-// GetDashboardHandler returns dashboard for authenticatedUser
+// GetDashboardHandler returns dashboard for a user that passed two-factor authentication
 func GetDashboardHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("authenticatedUser")
-	if err != nil || cookie.Value == "" {
-		http.Redirect(w, r, "/", http.StatusFound)
+	user, err := cache.GetUser(r.Context())
+	if err != nil {
+		http.Redirect(w, r, "/two/login", http.StatusFound)
+		return
+	}
+	banner, err := impersonationBanner(r.Context())
+	if err != nil {
+		log.Error().Msgf("Failed to find impersonating admin: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	// You can now use cookie.Value as the username if needed
-	err = templates.ExecuteTemplate(w, "dashboard.html", struct{ Username string }{Username: cookie.Value})
+	err = templates.ExecuteTemplate(w, "dashboard.html", struct {
+		Username      string
+		Impersonation *ImpersonationBanner
+	}{Username: user.Email, Impersonation: banner})
 	if err != nil {
 		log.Error().Msgf("Template error: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
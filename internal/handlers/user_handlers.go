@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"net/http"
@@ -22,16 +23,13 @@ var (
 	// ErrInvalidEmail indicates an email did not match the required format.
 	ErrInvalidEmail = errors.New("invalid email format")
 
-	// ErrWeakPassword indicates a password does not meet minimum strength requirements.
-	ErrWeakPassword = errors.New("password must be at least 8 characters")
-
 	// ErrMissingFields indicates required fields were not provided in the request.
 	ErrMissingFields = errors.New("email and password are required")
 )
 
 // CreateUserRequest represents the JSON payload for registering a user via email.
 type CreateUserRequest struct {
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"` // length and strength follow auth.PasswordPolicy
 	Email    string `json:"email" validate:"required,email"`
 }
 
@@ -41,10 +39,13 @@ type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 }
 
-// LoginResponse represents the successful login response containing token and user.
+// LoginResponse represents the successful login response containing tokens and user.
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  *User  `json:"user,omitempty"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`   // access token lifetime in seconds
+	MFARequired  bool   `json:"mfa_required,omitempty"` // token only works for /twoauth/validate-otp until the OTP is passed
+	User         *User  `json:"user,omitempty"`
 }
 
 // User represents the essential user data returned in responses.
@@ -55,8 +56,23 @@ type User struct {
 	Provider string `json:"provider"`
 }
 
+// ProfileResponse is the authenticated user's own profile. It leaves out the password hash,
+// the sealed TOTP secret and the suspension fields of db.User.
+type ProfileResponse struct {
+	ID               string    `json:"id"`
+	Email            string    `json:"email"`
+	Name             string    `json:"name"`
+	Role             string    `json:"role"`
+	AvatarURL        string    `json:"avatar_url,omitempty"`
+	Provider         string    `json:"provider"`
+	EmailVerified    bool      `json:"email_verified"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
 // validateCreateUserRequest validates and sanitizes input for user creation.
-func validateCreateUserRequest(req *CreateUserRequest) error {
+// Password problems are returned as *auth.PasswordPolicyError.
+func validateCreateUserRequest(ctx context.Context, req *CreateUserRequest) error {
 	if req.Email == "" || req.Password == "" {
 		return ErrMissingFields
 	}
@@ -66,10 +82,7 @@ func validateCreateUserRequest(req *CreateUserRequest) error {
 		return ErrInvalidEmail
 	}
 
-	if len(req.Password) < 8 {
-		return ErrWeakPassword
-	}
-	return nil
+	return auth.CheckPassword(ctx, req.Password, req.Email)
 }
 
 // validateLoginRequest validates input fields for user login.
@@ -99,15 +112,15 @@ func PostCreateUserHandlerEmail(w http.ResponseWriter, r *http.Request) {
 	req.Password = r.FormValue("password")
 
 	// Validate input
-	if err := validateCreateUserRequest(&req); err != nil {
+	if err := validateCreateUserRequest(ctx, &req); err != nil {
 		var statusCode int
 		var serviceErr error
 
-		switch err {
-		case ErrMissingFields, ErrInvalidEmail:
+		switch {
+		case errors.Is(err, ErrMissingFields), errors.Is(err, ErrInvalidEmail):
 			statusCode = http.StatusBadRequest
 			serviceErr = userService.ErrParamsMismatch
-		case ErrWeakPassword:
+		case errors.Is(err, auth.ErrPasswordPolicy):
 			statusCode = http.StatusBadRequest
 			serviceErr = userService.ErrTooWeakPassword
 		default:
@@ -143,8 +156,12 @@ func PostCreateUserHandlerEmail(w http.ResponseWriter, r *http.Request) {
 		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to create user", err)
 		return
 	}
+	// The account is usable without the email, the user can ask for a new link later
+	if err := userService.SendVerificationEmail(ctx, user); err != nil {
+		logger.Error(ctx, err, "failed to send verification email")
+	}
 	RespondWithJSON(ctx, w, http.StatusCreated, map[string]string{
-		"message": "User created successfully",
+		"message": "User created successfully, check your email to verify your address",
 		"userID":  user.ID,
 	})
 }
@@ -162,10 +179,14 @@ func PostLoginHandler(w http.ResponseWriter, r *http.Request) {
 		RespondWithError(ctx, w, http.StatusBadRequest, err.Error(), userService.ErrParamsMismatch)
 		return
 	}
+	if loginThrottled(w, r, req.Email) {
+		return
+	}
 
 	dbUser, err := db.Get().GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			recordFailedLogin(r, req.Email)
 			RespondWithError(ctx, w, http.StatusBadRequest, "Invalid email or password", userService.ErrWrongPassword)
 			return
 		}
@@ -173,45 +194,50 @@ func PostLoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if dbUser.Provider != string(userService.GetServiceEnumName(userService.Email)) {
-		RespondWithError(ctx, w, http.StatusBadRequest,
-			"Please use the authentication method you originally signed up with",
-			userService.ErrIncorrectAuthType)
+	// Accounts created with a provider have no password until the user sets one, they fail
+	// like a wrong password so the response doesn't reveal the account or how it signs in
+	if dbUser.PasswordHash == "" || !auth.CheckPasswordHash(req.Password, dbUser.PasswordHash) {
+		recordFailedLogin(r, req.Email)
+		RespondWithError(ctx, w, http.StatusBadRequest, "Invalid email or password", userService.ErrWrongPassword)
 		return
 	}
 
-	if !auth.CheckPasswordHash(req.Password, dbUser.PasswordHash) {
-		RespondWithError(ctx, w, http.StatusBadRequest, "Invalid email or password", userService.ErrWrongPassword)
+	if auth.IsSuspended(dbUser) {
+		RespondWithError(ctx, w, http.StatusForbidden, "Account is suspended", auth.ErrUserSuspended)
 		return
 	}
-
-	// Generate JWT token
-	token := auth.MakeToken(dbUser.LookupID, dbUser.Role)
-
-	// Set secure cookie with JWT
-	cookie := &http.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-		// Secure: true, // Enable in production with HTTPS
+	if auth.LoginBlockedByVerification(dbUser) {
+		RespondWithError(ctx, w, http.StatusForbidden, "Please verify your email address before logging in", userService.ErrEmailNotVerified)
+		return
 	}
-	http.SetCookie(w, cookie)
+	// Only a login that is let through clears the throttle and rewrites the hash
+	recordSuccessfulLogin(r, req.Email)
+	userService.UpgradePasswordHash(ctx, dbUser, req.Password)
 
-	user := &User{
-		ID:       dbUser.LookupID,
-		Email:    dbUser.Email,
-		Name:     dbUser.Name,
-		Provider: dbUser.Provider,
+	// Start a session and set the token cookies
+	pair, err := issueLoginTokens(ctx, w, dbUser, auth.AMRPassword)
+	if err != nil {
+		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to issue tokens", err)
+		return
 	}
 
-	response := LoginResponse{
-		Token: token,
-		User:  user,
+	RespondWithJSON(ctx, w, http.StatusOK, newLoginResponse(dbUser, pair))
+}
+
+// newLoginResponse builds the response of a successful login
+func newLoginResponse(dbUser db.User, pair auth.TokenPair) LoginResponse {
+	return LoginResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    int64(time.Until(pair.AccessExpiresAt).Seconds()),
+		MFARequired:  pair.MFAPending,
+		User: &User{
+			ID:       dbUser.LookupID,
+			Email:    dbUser.Email,
+			Name:     dbUser.Name,
+			Provider: dbUser.Provider,
+		},
 	}
-	RespondWithJSON(ctx, w, http.StatusOK, response)
 }
 
 // GetProfileHandler returns the authenticated user's profile based on the context.
@@ -222,7 +248,21 @@ func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
 		RespondWithError(ctx, w, http.StatusInternalServerError, "Failed to find active user", err)
 		return
 	}
-	RespondWithJSON(ctx, w, http.StatusOK, user)
+	RespondWithJSON(ctx, w, http.StatusOK, newProfileResponse(user))
+}
+
+func newProfileResponse(user db.User) ProfileResponse {
+	return ProfileResponse{
+		ID:               user.LookupID,
+		Email:            user.Email,
+		Name:             user.Name,
+		Role:             user.Role,
+		AvatarURL:        user.AvatarUrl,
+		Provider:         user.Provider,
+		EmailVerified:    user.EmailVerified,
+		TwoFactorEnabled: user.Secret != "",
+		CreatedAt:        user.CreatedAt,
+	}
 }
 
 // GetCreatePage renders the HTML page for creating a new user via form.
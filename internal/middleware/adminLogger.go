@@ -12,9 +12,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
 	"github.com/nikojunttila/community/internal/cache"
 	"github.com/nikojunttila/community/internal/db"
 	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/services/audit"
 )
 
 type contextKey string
@@ -44,7 +47,9 @@ func (w *auditResponseWriter) Write(data []byte) (int, error) {
 	return w.ResponseWriter.Write(data)
 }
 
-// AdminAuditMiddleware logs all admin actions to the database
+// AdminAuditMiddleware logs all admin actions to the database. Requests made with an
+// impersonation token are logged with the admin as the actor and the impersonated user as
+// the target, and are refused when the admin can't be recorded.
 func AdminAuditMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -57,16 +62,8 @@ func AdminAuditMiddleware() func(http.Handler) http.Handler {
 			ctx := context.WithValue(r.Context(), requestIDKey, requestID)
 			r = r.WithContext(ctx)
 
-			// Capture request body (if present)
-			var requestBody string
-			if r.Body != nil && r.ContentLength > 0 {
-				bodyBytes, err := io.ReadAll(r.Body)
-				if err == nil {
-					requestBody = string(bodyBytes)
-					// Restore the body for the actual handler
-					r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-				}
-			}
+			// Capture request body (if present), redacted before it is stored
+			rawBody, requestBody := captureAuditBody(r)
 
 			// Wrap response writer to capture status code
 			auditWriter := &auditResponseWriter{
@@ -74,16 +71,39 @@ func AdminAuditMiddleware() func(http.Handler) http.Handler {
 				statusCode:     http.StatusOK,
 			}
 
+			_, claims, _ := jwtauth.FromContext(ctx)
+			actorLookupID := auth.ActorFromClaims(claims)
+
 			// Get admin user from context (should be available after JWT middleware)
 			admin, err := cache.GetUser(ctx)
 			if err != nil {
 				logger.Error(r.Context(), err, "Failed to get admin user for audit log")
+				if actorLookupID != "" {
+					http.Error(w, "Impersonation could not be audited", http.StatusInternalServerError)
+					return
+				}
 				next.ServeHTTP(w, r)
 				return
 			}
 
+			// While impersonating the token's user is the target and the admin is in the act claim
+			var impersonatedUserID string
+			if actorLookupID != "" {
+				actor, err := impersonatingAdmin(ctx, actorLookupID)
+				if err != nil {
+					logger.Warn(ctx, err, "rejected impersonation token")
+					http.Error(w, "Impersonation is no longer allowed", http.StatusForbidden)
+					return
+				}
+				impersonatedUserID = admin.ID
+				admin = actor
+			}
+
 			// Extract target user ID from request (this will vary based on your routes)
-			targetUserID := extractTargetUserID(r, requestBody)
+			targetUserID := extractTargetUserID(r, string(rawBody))
+			if impersonatedUserID != "" && targetUserID == "unknown" {
+				targetUserID = impersonatedUserID
+			}
 
 			// Determine action based on HTTP method
 			action := mapHTTPMethodToAction(r.Method)
@@ -97,33 +117,82 @@ func AdminAuditMiddleware() func(http.Handler) http.Handler {
 			// Calculate response time
 			responseTime := time.Since(startTime)
 
-			// Log to database asynchronously to avoid blocking the response
-			go func() {
-				err := logAdminAction(context.Background(), adminAuditParams{
-					AdminUserID:    admin.ID,
-					AdminEmail:     admin.Email,
-					TargetUserID:   targetUserID,
-					Action:         action,
-					Resource:       resource,
-					Method:         r.Method,
-					Path:           r.URL.Path,
-					QueryParams:    r.URL.RawQuery,
-					RequestBody:    requestBody,
-					IPAddress:      r.RemoteAddr,
-					UserAgent:      r.UserAgent(),
-					StatusCode:     auditWriter.statusCode,
-					ResponseTimeMs: responseTime.Milliseconds(),
-					Timestamp:      startTime,
-					RequestID:      requestID,
-				})
-				if err != nil {
-					logger.Error(ctx, err, "Failed to log admin audit")
-				}
-			}()
+			// Queue the log, the audit sink writes it in the background
+			logAdminAction(ctx, adminAuditParams{
+				AdminUserID:    admin.ID,
+				AdminEmail:     admin.Email,
+				TargetUserID:   targetUserID,
+				Action:         action,
+				Resource:       resource,
+				Method:         r.Method,
+				Path:           r.URL.Path,
+				QueryParams:    audit.RedactQuery(r.URL.RawQuery),
+				RequestBody:    requestBody,
+				RequestHeaders: audit.RedactHeaders(r.Header),
+				IPAddress:      r.RemoteAddr,
+				UserAgent:      r.UserAgent(),
+				StatusCode:     auditWriter.statusCode,
+				ResponseTimeMs: responseTime.Milliseconds(),
+				Timestamp:      startTime,
+				RequestID:      requestID,
+
+				ImpersonatedUserID: impersonatedUserID,
+			})
 		})
 	}
 }
 
+// LogUserSecurityEvent writes a security relevant action of a regular user, such as a
+// failed second factor, to the audit log with the user as both actor and target.
+// The request body is never stored since it holds the submitted credentials.
+func LogUserSecurityEvent(r *http.Request, user db.User, action string, statusCode int) {
+	ctx := r.Context()
+	startTime := time.Now()
+	requestID := fmt.Sprintf("req_%d_%s", startTime.UnixNano(), generateShortID())
+	logAdminAction(ctx, adminAuditParams{
+		AdminUserID:    user.ID,
+		AdminEmail:     user.Email,
+		TargetUserID:   user.ID,
+		Action:         action,
+		Resource:       extractResourceFromPath(r.URL.Path),
+		Method:         r.Method,
+		Path:           r.URL.Path,
+		QueryParams:    audit.RedactQuery(r.URL.RawQuery),
+		RequestHeaders: audit.RedactHeaders(r.Header),
+		IPAddress:      r.RemoteAddr,
+		UserAgent:      r.UserAgent(),
+		StatusCode:     statusCode,
+		Timestamp:      startTime,
+		RequestID:      requestID,
+	})
+}
+
+// captureAuditBody returns the raw body for extracting the target user and the redacted
+// body to store. Multipart and binary bodies aren't read, and bodies too large to redact
+// are only read up to audit.MaxRedactableBody, the handler still gets the whole body.
+func captureAuditBody(r *http.Request) ([]byte, string) {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil, ""
+	}
+	contentType := r.Header.Get("Content-Type")
+	if !audit.IsTextBody(contentType) {
+		return nil, audit.SummarizeBody(contentType, r.ContentLength)
+	}
+	prefix, err := io.ReadAll(io.LimitReader(r.Body, audit.MaxRedactableBody+1))
+	if err != nil {
+		return nil, ""
+	}
+	// Restore the body for the actual handler
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+	if len(prefix) > audit.MaxRedactableBody {
+		return nil, audit.SummarizeBody(contentType, r.ContentLength)
+	}
+	return prefix, audit.RedactBody(contentType, prefix)
+}
+
 type adminAuditParams struct {
 	AdminUserID    string
 	AdminEmail     string
@@ -134,34 +203,38 @@ type adminAuditParams struct {
 	Path           string
 	QueryParams    string
 	RequestBody    string
+	RequestHeaders string
 	IPAddress      string
 	UserAgent      string
 	StatusCode     int
 	ResponseTimeMs int64
 	Timestamp      time.Time
 	RequestID      string
+
+	ImpersonatedUserID string // set when an admin made the request as this user
 }
 
-// logAdminAction saves the audit log to database
-func logAdminAction(ctx context.Context, params adminAuditParams) error {
-	_, err := db.Get().CreateAuditLog(ctx, db.CreateAuditLogParams{
-		AdminUserID:    params.AdminUserID,
-		AdminEmail:     params.AdminEmail,
-		TargetUserID:   params.TargetUserID,
-		Action:         params.Action,
-		Resource:       params.Resource,
-		Method:         params.Method,
-		Path:           params.Path,
-		QueryParams:    params.QueryParams,
-		RequestBody:    params.RequestBody,
-		IpAddress:      params.IPAddress,
-		UserAgent:      params.UserAgent,
-		StatusCode:     int64(params.StatusCode),
-		ResponseTimeMs: params.ResponseTimeMs,
-		Timestamp:      params.Timestamp,
-		RequestID:      params.RequestID,
+// logAdminAction hands the audit log to the audit sink, which appends it to the hash chain
+func logAdminAction(ctx context.Context, params adminAuditParams) {
+	audit.Record(ctx, audit.Entry{
+		AdminUserID:        params.AdminUserID,
+		AdminEmail:         params.AdminEmail,
+		TargetUserID:       params.TargetUserID,
+		ImpersonatedUserID: params.ImpersonatedUserID,
+		Action:             params.Action,
+		Resource:           params.Resource,
+		Method:             params.Method,
+		Path:               params.Path,
+		QueryParams:        params.QueryParams,
+		RequestBody:        params.RequestBody,
+		RequestHeaders:     params.RequestHeaders,
+		IPAddress:          params.IPAddress,
+		UserAgent:          params.UserAgent,
+		StatusCode:         int64(params.StatusCode),
+		ResponseTimeMs:     params.ResponseTimeMs,
+		Timestamp:          params.Timestamp,
+		RequestID:          params.RequestID,
 	})
-	return err
 }
 
 // mapHTTPMethodToAction converts HTTP methods to audit actions
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/nikojunttila/community/internal/auth"
+)
+
+// ClientInfo stores the user agent and address of the request for the session list.
+// It has to run after chi's RealIP so the address is the one of the client, not the proxy.
+func ClientInfo() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := r.RemoteAddr
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				ip = host
+			}
+			ctx := auth.NewClientContext(r.Context(), auth.ClientInfo{
+				UserAgent: r.UserAgent(),
+				IP:        ip,
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+)
+
+// errImpersonatorNotAdmin indicates the admin in an impersonation token lost the users:impersonate permission or was suspended.
+var errImpersonatorNotAdmin = errors.New("impersonating user is no longer an admin")
+
+// AuditImpersonation must run after jwtauth.Authenticator. Every request made with an
+// impersonation token goes through AdminAuditMiddleware, whatever the route.
+func AuditImpersonation() func(http.Handler) http.Handler {
+	audit := AdminAuditMiddleware()
+	return func(next http.Handler) http.Handler {
+		audited := audit(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, claims, _ := jwtauth.FromContext(r.Context())
+			if auth.IsImpersonating(claims) {
+				audited.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectImpersonation keeps admins acting as a user away from routes that change the
+// user's credentials or use admin powers.
+func RejectImpersonation() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, claims, _ := jwtauth.FromContext(r.Context())
+			if auth.IsImpersonating(claims) {
+				http.Error(w, "Not available while impersonating a user", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// impersonatingAdmin loads the admin of an impersonation token, who has to still be active
+// and allowed to impersonate users
+func impersonatingAdmin(ctx context.Context, lookupID string) (db.User, error) {
+	admin, err := db.Get().GetUserBylookupID(ctx, lookupID)
+	if err != nil {
+		return db.User{}, err
+	}
+	allowed, err := auth.RoleHasPermission(ctx, admin.Role, auth.PermUsersImpersonate)
+	if err != nil {
+		return db.User{}, err
+	}
+	if !allowed || auth.IsSuspended(admin) {
+		return db.User{}, errImpersonatorNotAdmin
+	}
+	return admin, nil
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+)
+
+// RejectMFAPending refuses tokens of sessions that passed the password but not the
+// second factor yet. Only the OTP validation routes should be reachable without it.
+func RejectMFAPending() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, claims, _ := jwtauth.FromContext(r.Context())
+			if auth.IsMFAPending(claims) {
+				http.Error(w, "Two-factor authentication required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireMFA allows access only if the session passed a second factor.
+// Combine with RequireRoles to protect sensitive routes.
+func RequireMFA() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, claims, _ := jwtauth.FromContext(r.Context())
+			if !auth.HasSecondFactor(auth.AMRFromClaims(claims)) {
+				http.Error(w, "Two-factor authentication required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
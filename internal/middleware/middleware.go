@@ -20,6 +20,7 @@ func InitializeMiddleware(r *chi.Mux, logger zerolog.Logger) {
 	lmt.SetBurst(50)
 
 	r.Use(chimiddleware.RealIP)
+	r.Use(ClientInfo())
 	r.Use(chimiddleware.RequestID)
 	r.Use(RequestLogger(logger))
 	r.Use(tollbooth_chi.LimitHandler(lmt))
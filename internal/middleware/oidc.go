@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/nikojunttila/community/internal/services/oidc"
+)
+
+// RequireOIDCProvider hides the OpenID Connect endpoints while tokens are signed with the
+// shared JWT_SECRET, the provider would have to hand out HS256 ID tokens signed with it.
+func RequireOIDCProvider() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !oidc.Enabled() {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
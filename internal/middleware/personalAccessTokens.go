@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+)
+
+// EnforceTokenScopes must run after jwtauth.Authenticator. Requests made with a personal
+// access token need the read scope for GET and HEAD and the write scope for everything else.
+// Browser sessions are not limited by scopes.
+func EnforceTokenScopes() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, claims, _ := jwtauth.FromContext(r.Context())
+			if auth.IsPersonalAccessToken(claims) {
+				scope := auth.ScopeWrite
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					scope = auth.ScopeRead
+				}
+				if !auth.HasScope(claims, scope) {
+					http.Error(w, "Token lacks the "+scope+" scope", http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectPersonalAccessTokens keeps routes that manage credentials, like creating more tokens
+// or enrolling a second factor, limited to interactive sessions.
+func RejectPersonalAccessTokens() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, claims, _ := jwtauth.FromContext(r.Context())
+			if auth.IsPersonalAccessToken(claims) {
+				http.Error(w, "Not available with a personal access token", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,19 +1,22 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/logger"
 )
 
-// RequireRoles allows access only if the user's role is one of the allowed roles.
-func RequireRoles(allowedRoles ...string) func(http.Handler) http.Handler {
-	// Create a fast lookup map
-	roleSet := make(map[string]struct{}, len(allowedRoles))
-	for _, role := range allowedRoles {
-		roleSet[role] = struct{}{}
-	}
+// errMissingPermission indicates the role of the token or the user's current role lacks the permission.
+var errMissingPermission = errors.New("missing permission")
 
+// RequireRoles allows access only if the user's role is one of the allowed roles
+// or inherits one of them, e.g. admin passes RequireRoles(auth.Moderator).
+func RequireRoles(allowedRoles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			_, claims, _ := jwtauth.FromContext(r.Context())
@@ -36,7 +39,19 @@ func RequireRoles(allowedRoles ...string) func(http.Handler) http.Handler {
 				return
 			}
 
-			if _, found := roleSet[roleStr]; !found {
+			roles, err := auth.Roles(r.Context())
+			if err != nil {
+				http.Error(w, "Failed to load roles", http.StatusInternalServerError)
+				return
+			}
+			allowed := false
+			for _, role := range allowedRoles {
+				if roles.Inherits(roleStr, role) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
 				http.Error(w, "Insufficient role privileges", http.StatusForbidden)
 				return
 			}
@@ -46,6 +61,37 @@ func RequireRoles(allowedRoles ...string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequirePermission must run after the JWT middleware. The permission has to be granted both
+// to the role in the token and to the user's current role, so demoting a user takes effect
+// on their next request and a token with a restricted role can't use the user's full role.
+// The perms claim is not trusted, changes to role_permissions apply without new tokens.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			_, claims, _ := jwtauth.FromContext(ctx)
+			tokenRole, _ := claims[auth.ClaimRole].(string)
+			user, err := cache.GetUser(ctx)
+			if err != nil {
+				http.Error(w, "User not found", http.StatusUnauthorized)
+				return
+			}
+			roles, err := auth.Roles(ctx)
+			if err != nil {
+				logger.Error(ctx, err, "Failed to load roles")
+				http.Error(w, "Failed to load roles", http.StatusInternalServerError)
+				return
+			}
+			if !roles.Has(tokenRole, permission) || !roles.Has(user.Role, permission) {
+				logger.Warn(ctx, errMissingPermission, fmt.Sprintf("user %s lacks %s", user.ID, permission))
+				http.Error(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Optional: translate numeric roles if needed (fallback)
 func formatRoleNumber(n int) string {
 	switch n {
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+// RejectRevokedTokens must run after jwtauth.Authenticator. It rejects access tokens
+// that were revoked on logout, whose session was killed by refresh token reuse, or
+// that were issued before tokens carried a jti and session id. Personal access tokens
+// have no session, the Verifier already checked them against the database.
+func RejectRevokedTokens() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			_, claims, _ := jwtauth.FromContext(ctx)
+			if auth.IsPersonalAccessToken(claims) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			jti, _ := claims[auth.ClaimTokenID].(string)
+			sessionID, _ := claims[auth.ClaimSessionID].(string)
+			if jti == "" || sessionID == "" {
+				http.Error(w, "Token missing session claims", http.StatusUnauthorized)
+				return
+			}
+
+			revoked, err := auth.IsTokenRevoked(ctx, jti, sessionID)
+			if err != nil {
+				logger.Error(ctx, err, "Failed to check token revocation")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+				return
+			}
+			// Keep the "last seen" of the device list current
+			if err := auth.TouchSession(ctx, sessionID); err != nil {
+				logger.Warn(ctx, err, "failed to record session activity")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
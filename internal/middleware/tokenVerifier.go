@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/nikojunttila/community/internal/auth"
+)
+
+// Verifier takes the place of jwtauth.Verifier. It reads the token from the Authorization
+// header or the jwt cookie and verifies it against the key its kid names, so tokens signed
+// by any of the active keys are accepted. Bearer tokens starting with pat_ are personal
+// access tokens and are looked up in the database instead. The result is stored for
+// jwtauth.Authenticator.
+func Verifier() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token jwt.Token
+			err := jwtauth.ErrNoTokenFound
+			tokenString := jwtauth.TokenFromHeader(r)
+			if tokenString == "" {
+				tokenString = jwtauth.TokenFromCookie(r)
+			}
+			switch {
+			case strings.HasPrefix(tokenString, auth.PersonalAccessTokenPrefix):
+				token, err = auth.VerifyPersonalAccessToken(r.Context(), tokenString)
+			case tokenString != "":
+				token, err = auth.VerifyToken(tokenString)
+			}
+			next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), token, err)))
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+)
+
+// RejectSuspendedUsers must run after the JWT middleware. Suspended users are refused
+// on every request even while their access token is otherwise still valid.
+func RejectSuspendedUsers() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := cache.GetUser(r.Context()); err != nil {
+				if errors.Is(err, auth.ErrUserSuspended) {
+					http.Error(w, "Account is suspended", http.StatusForbidden)
+					return
+				}
+				http.Error(w, "User not found", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,10 +2,57 @@ package routes
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/nikojunttila/community/internal/auth"
 	"github.com/nikojunttila/community/internal/handlers"
+	"github.com/nikojunttila/community/internal/middleware"
 )
 
+// registerAdminRoutes expects the group to require auth.PermAdminAccess already
 func registerAdminRoutes(r chi.Router) {
 	r.Get("/profile", handlers.GetProfileAdmin)
 	r.Get("/profile2", handlers.GetProfileHandlerAdmin)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequirePermission(auth.PermUsersSuspend))
+		r.Post("/users/{userID}/suspend", handlers.PostSuspendUserHandler)
+		r.Post("/users/{userID}/unsuspend", handlers.PostUnsuspendUserHandler)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequirePermission(auth.PermUsersWrite))
+		r.Post("/users/{userID}/reset_2fa", handlers.PostResetTwoFactorHandler)
+		r.Post("/users/{userID}/unlock", handlers.PostUnlockUserHandler)
+		r.Delete("/lockouts", handlers.DeleteLoginLockoutHandler)
+	})
+	r.With(middleware.RequirePermission(auth.PermUsersRead)).Get("/lockouts", handlers.GetLoginLockoutsHandler)
+
+	r.With(
+		middleware.RequirePermission(auth.PermUsersImpersonate),
+		middleware.RejectPersonalAccessTokens(),
+	).Post("/impersonate", handlers.PostImpersonateHandler)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequirePermission(auth.PermOAuthClientsWrite))
+		r.Get("/oauth/clients", handlers.GetOAuthClientsHandler)
+		r.Post("/oauth/clients", handlers.PostOAuthClientHandler)
+		r.Delete("/oauth/clients/{clientID}", handlers.DeleteOAuthClientHandler)
+	})
+
+	r.With(middleware.RequirePermission(auth.PermRolesRead)).Get("/roles", handlers.GetRolesHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequirePermission(auth.PermRolesWrite))
+		r.Post("/roles", handlers.PostRoleHandler)
+		r.Put("/roles/{role}/permissions", handlers.PutRolePermissionsHandler)
+		r.Put("/users/{userID}/role", handlers.PutUserRoleHandler)
+	})
+
+	r.Route("/audit", func(r chi.Router) {
+		r.Use(middleware.RequirePermission(auth.PermAuditRead))
+		r.Get("/", handlers.GetAuditLogsHandler)
+		r.Get("/stats/admins", handlers.GetAuditAdminStatsHandler)
+		r.Get("/stats/resources", handlers.GetAuditResourceStatsHandler)
+		r.Get("/stats/actions", handlers.GetAuditActionStatsHandler)
+		r.Get("/sink", handlers.GetAuditSinkStatsHandler)
+		r.Get("/retention", handlers.GetAuditRetentionHandler)
+		r.Get("/{requestID}", handlers.GetAuditLogHandler)
+	})
 }
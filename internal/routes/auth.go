@@ -7,12 +7,47 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/jwtauth/v5"
 	"github.com/nikojunttila/community/internal/handlers"
+	"github.com/nikojunttila/community/internal/middleware"
 )
 
+func registerTokenRoutes(r chi.Router) {
+	r.Post("/refresh", handlers.PostRefreshTokenHandler)
+	r.Post("/logout", handlers.PostLogoutHandler)
+}
+
 func registerAuthRoutes(r chi.Router) {
 	r.Get("/foo", handlers.GetFooHandler)
 	r.Get("/profile", handlers.GetProfileHandler)
 
+	r.Get("/impersonation", handlers.GetImpersonationHandler)
+	r.Post("/impersonation/end", handlers.PostEndImpersonationHandler)
+
+	// Credentials can only be managed from an interactive session of the user
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RejectPersonalAccessTokens())
+		r.Use(middleware.RejectImpersonation())
+
+		r.Get("/passkeys", handlers.GetPasskeysHandler)
+		r.Delete("/passkeys/{passkeyID}", handlers.DeletePasskeyHandler)
+		r.Post("/passkeys/reauth/begin", handlers.PostPasskeyReauthBeginHandler)
+		r.Get("/passkeys/register", handlers.GetPasskeyRegisterPage)
+		r.Post("/passkeys/register/begin", handlers.PostPasskeyRegisterBeginHandler)
+		r.Post("/passkeys/register/finish", handlers.PostPasskeyRegisterFinishHandler)
+
+		r.Get("/tokens", handlers.GetAccessTokensHandler)
+		r.Post("/tokens", handlers.PostAccessTokenHandler)
+		r.Delete("/tokens/{tokenID}", handlers.DeleteAccessTokenHandler)
+
+		r.Get("/sessions", handlers.GetSessionsHandler)
+		r.Delete("/sessions", handlers.DeleteSessionsHandler)
+		r.Delete("/sessions/{sessionID}", handlers.DeleteSessionHandler)
+
+		r.Get("/identities", handlers.GetIdentitiesHandler)
+		r.Get("/identities/{provider}/link", handlers.GetLinkIdentityHandler)
+		r.Delete("/identities/{provider}", handlers.DeleteIdentityHandler)
+		r.Post("/password", handlers.PostPasswordHandler)
+	})
+
 	r.Get("/dashboard", func(w http.ResponseWriter, r *http.Request) {
 		_, claims, _ := jwtauth.FromContext(r.Context())
 		_, _ = w.Write(fmt.Appendf(nil, "Welcome to admin dashboard, %v", claims["username"]))
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/nikojunttila/community/internal/handlers"
+	"github.com/nikojunttila/community/internal/middleware"
+)
+
+// registerOAuthRoutes are the endpoints other apps use to log their users in with OpenID Connect
+func registerOAuthRoutes(r chi.Router) {
+	// The authorize endpoint sends users without a session to the login page itself
+	r.With(middleware.Verifier()).HandleFunc("/authorize", handlers.AuthorizeHandler)
+	r.Post("/token", handlers.PostTokenHandler)
+	r.Get("/userinfo", handlers.UserInfoHandler)
+	r.Post("/userinfo", handlers.UserInfoHandler)
+}
@@ -19,6 +19,9 @@ func InitializeRoutes(r *chi.Mux) {
 	r.Get("/health/db", handlers.HealthCheckDB)
 	r.Get("/healthz", handlers.HealthCheck)
 
+	r.Get("/.well-known/jwks.json", handlers.GetJWKSHandler)
+	r.With(middleware.RequireOIDCProvider()).Get("/.well-known/openid-configuration", handlers.GetOpenIDConfigurationHandler)
+
 	r.Get("/upload", handlers.GetUploadPageHandler)
 	r.Post("/upload", handlers.PostFileUploadHandler)
 
@@ -30,15 +33,15 @@ func InitializeRoutes(r *chi.Mux) {
 		http.ServeFile(w, r, "index.html")
 	})
 	r.Route("/user", func(r chi.Router) {
-		r.Use(middleware.RequireRoles(auth.User, auth.Admin))
+		r.Use(middleware.RequireRoles(auth.User))
 		r.Get("/foo", handlers.GetFooHandler)
 	})
 
 	r.Route("/admin", func(r chi.Router) {
 		//log access to database for later identification on important endpoints
-		r.Use(jwtauth.Verifier(auth.GetTokenAuth()))
-		r.Use(jwtauth.Authenticator(auth.GetTokenAuth()))
-		r.Use(middleware.RequireRoles(auth.Admin))
+		requireAuth(r)
+		r.Use(middleware.RequirePermission(auth.PermAdminAccess))
+		r.Use(middleware.RejectImpersonation())
 
 		r.Use(middleware.AdminAuditMiddleware())
 		registerAdminRoutes(r)
@@ -50,20 +53,34 @@ func InitializeRoutes(r *chi.Mux) {
 
 	r.Route("/twoauth", func(r chi.Router) {
 		//without these we cant find jwt from context
-		r.Use(jwtauth.Verifier(auth.GetTokenAuth()))
-		r.Use(jwtauth.Authenticator(auth.GetTokenAuth()))
-		twoFactorRoutesAuth(r)
+		r.Group(func(r chi.Router) {
+			requireToken(r)
+			r.Use(middleware.RejectPersonalAccessTokens())
+			r.Use(middleware.RejectImpersonation())
+			twoFactorRoutesPending(r)
+		})
+		r.Group(func(r chi.Router) {
+			requireAuth(r)
+			r.Use(middleware.RejectPersonalAccessTokens())
+			twoFactorRoutesAuth(r)
+		})
 	})
 
 	r.Route("/auth", func(r chi.Router) {
-		// Seek, verify and validate JWT tokens
-		r.Use(jwtauth.Verifier(auth.GetTokenAuth()))
-		// Handle valid / invalid tokens. In this example, we use
-		// the provided authenticator middleware, but you can write your
-		// own very easily, look at the Authenticator method in jwtauth.go
-		// and tweak it, its not scary.
-		r.Use(jwtauth.Authenticator(auth.GetTokenAuth()))
-		registerAuthRoutes(r)
+		// Token lifecycle endpoints have to work after the access token expired
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Verifier())
+			registerTokenRoutes(r)
+		})
+		r.Group(func(r chi.Router) {
+			requireAuth(r)
+			registerAuthRoutes(r)
+		})
+	})
+
+	r.Route("/oauth", func(r chi.Router) {
+		r.Use(middleware.RequireOIDCProvider())
+		registerOAuthRoutes(r)
 	})
 
 	// Group for public routes
@@ -72,11 +89,51 @@ func InitializeRoutes(r *chi.Mux) {
 	})
 }
 
+// requireAuth rejects requests without a valid, unrevoked access token
+// and tokens that still wait for the second factor
+func requireAuth(r chi.Router) {
+	requireToken(r)
+	// Password-only logins of 2FA users may only finish the OTP step
+	r.Use(middleware.RejectMFAPending())
+}
+
+// requireToken rejects requests without a valid, unrevoked access token
+func requireToken(r chi.Router) {
+	// Seek, verify and validate JWT tokens
+	r.Use(middleware.Verifier())
+	// Handle valid / invalid tokens. In this example, we use
+	// the provided authenticator middleware, but you can write your
+	// own very easily, look at the Authenticator method in jwtauth.go
+	// and tweak it, its not scary.
+	r.Use(jwtauth.Authenticator(auth.GetTokenAuth()))
+	// Reject tokens revoked by logout or refresh token reuse
+	r.Use(middleware.RejectRevokedTokens())
+	// Reject suspended users even while their token is still valid
+	r.Use(middleware.RejectSuspendedUsers())
+	// Limit personal access tokens to the scopes they were created with
+	r.Use(middleware.EnforceTokenScopes())
+	// Audit everything an admin does while impersonating a user
+	r.Use(middleware.AuditImpersonation())
+}
+
 func registerPublicRoutes(r chi.Router) {
 	r.Get("/{provider}/begin", handlers.GetBeginAuth)
-	r.Get("/{provider}/callback", handlers.GetAuthCallBack)
+	// The session is only read when the callback finishes linking a provider to a logged in user
+	r.With(middleware.Verifier()).Get("/{provider}/callback", handlers.GetAuthCallBack)
 
 	r.Get("/email_create", handlers.GetCreatePage)
 	r.Post("/email_create", handlers.PostCreateUserHandlerEmail)
 	r.Post("/email_login", handlers.PostLoginHandler)
+	r.Get("/continue", handlers.ContinueLoginHandler)
+	r.Get("/passkey_login", handlers.GetPasskeyLoginPage)
+	r.Post("/passkey_login/begin", handlers.PostPasskeyLoginBeginHandler)
+	r.Post("/passkey_login/finish", handlers.PostPasskeyLoginFinishHandler)
+
+	r.Get("/verify_email", handlers.GetVerifyEmailHandler)
+	r.Post("/verify_email/resend", handlers.PostResendVerificationHandler)
+
+	r.Get("/forgot_password", handlers.GetForgotPasswordPage)
+	r.Post("/forgot_password", handlers.PostForgotPasswordHandler)
+	r.Get("/reset_password", handlers.GetResetPasswordPage)
+	r.Post("/reset_password", handlers.PostResetPasswordHandler)
 }
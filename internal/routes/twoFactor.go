@@ -3,6 +3,7 @@ package routes
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/nikojunttila/community/internal/handlers"
+	"github.com/nikojunttila/community/internal/middleware"
 )
 
 func twoFactorRoutes(r chi.Router) {
@@ -11,9 +12,25 @@ func twoFactorRoutes(r chi.Router) {
 	r.Post("/login", handlers.LoginHandler)
 }
 
-func twoFactorRoutesAuth(r chi.Router) {
-	r.Get("/dashboard", handlers.GetDashboardHandler)
-	r.Get("/generate-otp", handlers.GetGenerateOTPHandler)
+// twoFactorRoutesPending are reachable with an mfa pending token
+func twoFactorRoutesPending(r chi.Router) {
 	r.Get("/validate-otp", handlers.ValidateOTPHandler)
 	r.Post("/validate-otp", handlers.ValidateOTPHandler)
+	r.Get("/recovery", handlers.RecoveryCodeHandler)
+	r.Post("/recovery", handlers.RecoveryCodeHandler)
+	r.Get("/passkey", handlers.GetPasskeyVerifyPage)
+	r.Post("/passkey/begin", handlers.PostPasskeyMFABeginHandler)
+	r.Post("/passkey/finish", handlers.PostPasskeyMFAFinishHandler)
+}
+
+func twoFactorRoutesAuth(r chi.Router) {
+	r.With(middleware.RequireMFA()).Get("/dashboard", handlers.GetDashboardHandler)
+
+	// Admins impersonating the user can see the dashboard but not change the second factor
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RejectImpersonation())
+		r.Get("/generate-otp", handlers.GetGenerateOTPHandler)
+		r.Post("/recovery-codes", handlers.PostRegenerateRecoveryCodesHandler)
+		r.Post("/disable", handlers.PostDisableTwoFactorHandler)
+	})
 }
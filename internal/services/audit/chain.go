@@ -0,0 +1,327 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/nikojunttila/community/internal/db"
+)
+
+// appendAttempts is how often Append rereads the chain head when another writer got there first
+const appendAttempts = 3
+
+// verifyBatchSize is the number of logs Verify reads at a time
+const verifyBatchSize = 500
+
+// chainMu serialises appends of this process, the unique prev_hash index catches other processes
+var chainMu sync.Mutex
+
+// Entry is an admin action to append to the audit log. The JSON form is used in the spill
+// file and in archives.
+type Entry struct {
+	AdminUserID        string    `json:"admin_user_id"`
+	AdminEmail         string    `json:"admin_email"`
+	TargetUserID       string    `json:"target_user_id"`
+	ImpersonatedUserID string    `json:"impersonated_user_id,omitempty"` // set when an admin made the request as this user
+	Action             string    `json:"action"`
+	Resource           string    `json:"resource"`
+	Method             string    `json:"method"`
+	Path               string    `json:"path"`
+	QueryParams        string    `json:"query_params"`
+	RequestBody        string    `json:"request_body"`
+	RequestHeaders     string    `json:"request_headers,omitempty"`
+	IPAddress          string    `json:"ip_address"`
+	UserAgent          string    `json:"user_agent"`
+	StatusCode         int64     `json:"status_code"`
+	ResponseTimeMs     int64     `json:"response_time_ms"`
+	Timestamp          time.Time `json:"timestamp"`
+	RequestID          string    `json:"request_id"`
+}
+
+// Verification is the result of walking the chain
+type Verification struct {
+	Checked     int64  // chained logs whose hashes matched
+	Archived    int64  // chained logs moved to archives, checked before they were archived
+	Unchained   int64  // logs written before the chain existed
+	Checkpoints int    // checkpoints whose signature and position matched
+	BrokenAt    int64  // id of the first log that doesn't match, 0 when the problem isn't a log
+	Problem     string // empty when the chain is intact
+}
+
+// OK reports whether the chain and every checkpoint matched
+func (v Verification) OK() bool {
+	return v.Problem == ""
+}
+
+// Append writes the entry linked to the current head of the chain
+func Append(ctx context.Context, entry Entry) (db.AdminAuditLog, error) {
+	chainMu.Lock()
+	defer chainMu.Unlock()
+	for attempt := 1; ; attempt++ {
+		prevHash, err := headHash(ctx, db.Get())
+		if err != nil {
+			return db.AdminAuditLog{}, err
+		}
+		row, err := insert(ctx, db.Get(), prevHash, entry)
+		if err == nil {
+			return row, nil
+		}
+		if !isChainConflict(err) || attempt == appendAttempts {
+			return db.AdminAuditLog{}, err
+		}
+	}
+}
+
+// AppendBatch writes the entries in order in one transaction, linked to the current head
+// of the chain. Either every entry is written or none is.
+func AppendBatch(ctx context.Context, entries []Entry) error {
+	chainMu.Lock()
+	defer chainMu.Unlock()
+	for attempt := 1; ; attempt++ {
+		err := appendBatch(ctx, entries)
+		if err == nil || !isChainConflict(err) || attempt == appendAttempts {
+			return err
+		}
+	}
+}
+
+func appendBatch(ctx context.Context, entries []Entry) error {
+	tx, err := db.Conn().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+	q := db.Get().WithTx(tx)
+	prevHash, err := headHash(ctx, q)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		row, err := insert(ctx, q, prevHash, entry)
+		if err != nil {
+			return err
+		}
+		prevHash = row.Hash
+	}
+	return tx.Commit()
+}
+
+// insert writes the entry after the log with prevHash
+func insert(ctx context.Context, q *db.Queries, prevHash string, entry Entry) (db.AdminAuditLog, error) {
+	entry.Timestamp = entry.Timestamp.UTC() // stored as text, one offset keeps range filters comparable
+	return q.CreateAuditLog(ctx, db.CreateAuditLogParams{
+		AdminUserID:        entry.AdminUserID,
+		AdminEmail:         entry.AdminEmail,
+		TargetUserID:       entry.TargetUserID,
+		Action:             entry.Action,
+		Resource:           entry.Resource,
+		Method:             entry.Method,
+		Path:               entry.Path,
+		QueryParams:        entry.QueryParams,
+		RequestBody:        entry.RequestBody,
+		IpAddress:          entry.IPAddress,
+		UserAgent:          entry.UserAgent,
+		StatusCode:         entry.StatusCode,
+		ResponseTimeMs:     entry.ResponseTimeMs,
+		Timestamp:          entry.Timestamp,
+		RequestID:          entry.RequestID,
+		ImpersonatedUserID: entry.ImpersonatedUserID,
+		RequestHeaders:     entry.RequestHeaders,
+		PrevHash:           prevHash,
+		Hash:               HashLog(prevHash, entry),
+	})
+}
+
+// headHash is the hash of the newest log, empty for an empty or unchained log. When every
+// log has been archived the chain continues from the newest archive.
+func headHash(ctx context.Context, q *db.Queries) (string, error) {
+	head, err := q.GetLastAuditLogHash(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		anchor, err := latestArchive(ctx, q)
+		return anchor.LastHash, err
+	}
+	return head.Hash, err
+}
+
+// latestArchive is the archive the remaining logs link to, zero without archives
+func latestArchive(ctx context.Context, q *db.Queries) (db.AuditArchive, error) {
+	anchor, err := q.GetLatestAuditArchive(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.AuditArchive{}, nil
+	}
+	return anchor, err
+}
+
+// isChainConflict reports whether another writer appended to the same head first
+func isChainConflict(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// HashLog is the hex SHA-256 of the previous hash and the JSON of the entry. Changing
+// any field, or removing or reordering logs, changes the hashes of every later log.
+func HashLog(prevHash string, entry Entry) string {
+	// Field order of the struct is fixed, so the JSON is the same on every run
+	contents, _ := json.Marshal(struct {
+		AdminUserID        string `json:"admin_user_id"`
+		AdminEmail         string `json:"admin_email"`
+		TargetUserID       string `json:"target_user_id"`
+		ImpersonatedUserID string `json:"impersonated_user_id"`
+		Action             string `json:"action"`
+		Resource           string `json:"resource"`
+		Method             string `json:"method"`
+		Path               string `json:"path"`
+		QueryParams        string `json:"query_params"`
+		RequestBody        string `json:"request_body"`
+		IPAddress          string `json:"ip_address"`
+		UserAgent          string `json:"user_agent"`
+		StatusCode         int64  `json:"status_code"`
+		ResponseTimeMs     int64  `json:"response_time_ms"`
+		Timestamp          string `json:"timestamp"`
+		RequestID          string `json:"request_id"`
+		RequestHeaders     string `json:"request_headers,omitempty"` // added later, omitted so older logs keep their hash
+	}{
+		AdminUserID:        entry.AdminUserID,
+		AdminEmail:         entry.AdminEmail,
+		TargetUserID:       entry.TargetUserID,
+		ImpersonatedUserID: entry.ImpersonatedUserID,
+		Action:             entry.Action,
+		Resource:           entry.Resource,
+		Method:             entry.Method,
+		Path:               entry.Path,
+		QueryParams:        entry.QueryParams,
+		RequestBody:        entry.RequestBody,
+		IPAddress:          entry.IPAddress,
+		UserAgent:          entry.UserAgent,
+		StatusCode:         entry.StatusCode,
+		ResponseTimeMs:     entry.ResponseTimeMs,
+		Timestamp:          entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		RequestID:          entry.RequestID,
+		RequestHeaders:     entry.RequestHeaders,
+	})
+	sum := sha256.Sum256(append([]byte(prevHash+"\n"), contents...))
+	return hex.EncodeToString(sum[:])
+}
+
+func entryFromLog(row db.AdminAuditLog) Entry {
+	return Entry{
+		AdminUserID:        row.AdminUserID,
+		AdminEmail:         row.AdminEmail,
+		TargetUserID:       row.TargetUserID,
+		ImpersonatedUserID: row.ImpersonatedUserID,
+		Action:             row.Action,
+		Resource:           row.Resource,
+		Method:             row.Method,
+		Path:               row.Path,
+		QueryParams:        row.QueryParams,
+		RequestBody:        row.RequestBody,
+		RequestHeaders:     row.RequestHeaders,
+		IPAddress:          row.IpAddress,
+		UserAgent:          row.UserAgent,
+		StatusCode:         row.StatusCode,
+		ResponseTimeMs:     row.ResponseTimeMs,
+		Timestamp:          ParseTimestamp(row.Timestamp),
+		RequestID:          row.RequestID,
+	}
+}
+
+// Verify walks the chain from the oldest log, or from the newest archive, and stops at the
+// first log whose hashes don't match. Checkpoints are checked against the logs they name, a
+// checkpoint pointing past the last log means logs were deleted from the end. The checkpoints
+// in the database can be deleted along with the logs, external ones kept elsewhere can't, so
+// a chain shorter than any of them is reported even when the database looks consistent.
+func Verify(ctx context.Context, external ...ExportedCheckpoint) (Verification, error) {
+	var v Verification
+	checkpoints, err := db.Get().ListAuditCheckpoints(ctx)
+	if err != nil {
+		return v, err
+	}
+	var longest int64
+	for _, e := range external {
+		checkpoints = append(checkpoints, e.checkpoint())
+		longest = max(longest, e.LogCount)
+	}
+	anchor, err := latestArchive(ctx, db.Get())
+	if err != nil {
+		return v, err
+	}
+	if v.Archived, err = db.Get().SumArchivedChainedAuditLogs(ctx); err != nil {
+		return v, err
+	}
+	byLogID := map[int64][]db.AuditCheckpoint{}
+	for _, cp := range checkpoints {
+		if err := verifyCheckpointSignature(cp); err != nil {
+			v.Problem = fmt.Sprintf("%s: %v", checkpointName(cp), err)
+			return v, nil
+		}
+		if cp.LastLogID > anchor.LastLogID { // older checkpoints name archived logs
+			byLogID[cp.LastLogID] = append(byLogID[cp.LastLogID], cp)
+		}
+	}
+
+	lastID := anchor.LastLogID
+	prevHash := anchor.LastHash
+	chained := prevHash != ""
+	for {
+		rows, err := db.Get().ListAuditLogsAfter(ctx, db.ListAuditLogsAfterParams{ID: lastID, Limit: verifyBatchSize})
+		if err != nil {
+			return v, err
+		}
+		for _, row := range rows {
+			lastID = row.ID
+			if row.Hash == "" && !chained {
+				v.Unchained++
+				continue
+			}
+			chained = true
+			switch {
+			case row.Hash == "":
+				v.BrokenAt, v.Problem = row.ID, "log has no hash"
+			case row.PrevHash != prevHash:
+				v.BrokenAt, v.Problem = row.ID, "previous hash doesn't match, a log before it was deleted or reordered"
+			case row.Hash != HashLog(prevHash, entryFromLog(row)):
+				v.BrokenAt, v.Problem = row.ID, "hash doesn't match, the log was modified"
+			}
+			if !v.OK() {
+				return v, nil
+			}
+			prevHash = row.Hash
+			v.Checked++
+			for _, cp := range byLogID[row.ID] {
+				if cp.LastHash != row.Hash || cp.LogCount != v.Archived+v.Checked {
+					v.BrokenAt, v.Problem = row.ID, "doesn't match "+checkpointName(cp)
+					return v, nil
+				}
+				v.Checkpoints++
+				delete(byLogID, row.ID)
+			}
+		}
+		if len(rows) < verifyBatchSize {
+			break
+		}
+	}
+	for logID, cps := range byLogID {
+		v.Problem = fmt.Sprintf("log %d named by %s is missing, logs were deleted from the end", logID, checkpointName(cps[0]))
+		return v, nil
+	}
+	if longest > v.Archived+v.Checked {
+		v.Problem = fmt.Sprintf("chain has %d logs, an external checkpoint covers %d, logs were deleted from the end", v.Archived+v.Checked, longest)
+	}
+	return v, nil
+}
+
+// checkpointName is how problems refer to a checkpoint, external ones have no id
+func checkpointName(cp db.AuditCheckpoint) string {
+	if cp.ID == 0 {
+		return fmt.Sprintf("the external checkpoint of log %d", cp.LastLogID)
+	}
+	return fmt.Sprintf("checkpoint %d", cp.ID)
+}
@@ -0,0 +1,229 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/utility"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNoCheckpointKey indicates AUDIT_CHECKPOINT_KEYS isn't set, checkpoints are disabled.
+var ErrNoCheckpointKey = errors.New("no audit checkpoint key configured")
+
+// ErrCheckpointSignature indicates a checkpoint wasn't signed by any configured key.
+var ErrCheckpointSignature = errors.New("checkpoint signature is invalid")
+
+// checkpointKeyring holds the Ed25519 keys checkpoints are signed with. Checkpoints are
+// signed with the active key, older keys are kept to verify the checkpoints they signed.
+type checkpointKeyring struct {
+	activeID string
+	keys     map[string]ed25519.PrivateKey
+}
+
+var checkpointKeys checkpointKeyring
+
+// ExportedCheckpoint is a signed checkpoint in the form kept outside the database. Checkpoints
+// in the database go with it when the database is rolled back, a copy elsewhere catches that.
+type ExportedCheckpoint struct {
+	LastLogID int64  `json:"last_log_id"`
+	LastHash  string `json:"last_hash"`
+	LogCount  int64  `json:"log_count"`
+	CreatedAt int64  `json:"created_at"` // unix seconds, part of the signed message
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+}
+
+// ExportCheckpoint converts a stored checkpoint to its exported form
+func ExportCheckpoint(cp db.AuditCheckpoint) ExportedCheckpoint {
+	return ExportedCheckpoint{
+		LastLogID: cp.LastLogID,
+		LastHash:  cp.LastHash,
+		LogCount:  cp.LogCount,
+		CreatedAt: cp.CreatedAt.Unix(),
+		KeyID:     cp.KeyID,
+		Signature: cp.Signature,
+	}
+}
+
+func (e ExportedCheckpoint) checkpoint() db.AuditCheckpoint {
+	return db.AuditCheckpoint{
+		LastLogID: e.LastLogID,
+		LastHash:  e.LastHash,
+		LogCount:  e.LogCount,
+		CreatedAt: time.Unix(e.CreatedAt, 0).UTC(),
+		KeyID:     e.KeyID,
+		Signature: e.Signature,
+	}
+}
+
+// Setup loads the checkpoint keys, redaction and retention settings, exits if they are not usable,
+// and starts the sink Record writes through
+func Setup() {
+	if err := LoadCheckpointKeys(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load audit checkpoint keys")
+	}
+	if err := LoadRedaction(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load audit redaction settings")
+	}
+	if err := LoadRetention(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load audit retention settings")
+	}
+	cfg, err := LoadSinkConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load audit sink settings")
+	}
+	StartSink(cfg)
+}
+
+// LoadCheckpointKeys reads AUDIT_CHECKPOINT_KEYS, a comma separated list of id:base64seed
+// pairs of Ed25519 keys, and AUDIT_CHECKPOINT_KEY_ID, the id used for signing (defaults to
+// the first key). Without keys the chain is still written but no checkpoints are made.
+func LoadCheckpointKeys() error {
+	spec := utility.GetEnvDefault("AUDIT_CHECKPOINT_KEYS", "")
+	keyring := checkpointKeyring{keys: map[string]ed25519.PrivateKey{}}
+	if spec == "" {
+		log.Warn().Msg("AUDIT_CHECKPOINT_KEYS is not set, audit log checkpoints are disabled")
+		checkpointKeys = keyring
+		return nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return fmt.Errorf("invalid key entry %q, expected id:base64seed", entry)
+		}
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("key %s is not valid base64: %w", id, err)
+		}
+		if len(seed) != ed25519.SeedSize {
+			return fmt.Errorf("key %s must be %d bytes, got %d", id, ed25519.SeedSize, len(seed))
+		}
+		keyring.keys[id] = ed25519.NewKeyFromSeed(seed)
+		if keyring.activeID == "" {
+			keyring.activeID = id
+		}
+	}
+	keyring.activeID = utility.GetEnvDefault("AUDIT_CHECKPOINT_KEY_ID", keyring.activeID)
+	if _, ok := keyring.keys[keyring.activeID]; !ok {
+		return fmt.Errorf("active key %s is not in AUDIT_CHECKPOINT_KEYS", keyring.activeID)
+	}
+	checkpointKeys = keyring
+	return nil
+}
+
+// CheckpointsEnabled reports whether a checkpoint key is configured
+func CheckpointsEnabled() bool {
+	return checkpointKeys.activeID != ""
+}
+
+// GenerateCheckpointKey returns a new base64 seed for AUDIT_CHECKPOINT_KEYS and its public key
+func GenerateCheckpointKey() (seed, public string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(priv.Seed()), base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// CheckpointPublicKeys returns the base64 public key of every configured key by id
+func CheckpointPublicKeys() map[string]string {
+	keys := make(map[string]string, len(checkpointKeys.keys))
+	for id, key := range checkpointKeys.keys {
+		keys[id] = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	}
+	return keys
+}
+
+// CreateCheckpoint signs the current head of the chain. It returns false when the head
+// hasn't moved since the last checkpoint. The exported checkpoint is logged too, so a copy
+// exists outside the database.
+func CreateCheckpoint(ctx context.Context) (db.AuditCheckpoint, bool, error) {
+	key, ok := checkpointKeys.keys[checkpointKeys.activeID]
+	if !ok {
+		return db.AuditCheckpoint{}, false, ErrNoCheckpointKey
+	}
+	chainMu.Lock()
+	defer chainMu.Unlock()
+
+	head, err := db.Get().GetLastAuditLogHash(ctx)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && head.Hash == "") {
+		return db.AuditCheckpoint{}, false, nil
+	}
+	if err != nil {
+		return db.AuditCheckpoint{}, false, err
+	}
+	latest, err := db.Get().GetLatestAuditCheckpoint(ctx)
+	if err == nil && latest.LastLogID == head.ID {
+		return db.AuditCheckpoint{}, false, nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return db.AuditCheckpoint{}, false, err
+	}
+	count, err := db.Get().CountChainedAuditLogs(ctx, head.ID)
+	if err != nil {
+		return db.AuditCheckpoint{}, false, err
+	}
+	archived, err := db.Get().SumArchivedChainedAuditLogs(ctx)
+	if err != nil {
+		return db.AuditCheckpoint{}, false, err
+	}
+	count += archived // the count keeps growing when old logs are archived
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	signature := ed25519.Sign(key, checkpointMessage(head.ID, head.Hash, count, createdAt))
+	cp, err := db.Get().CreateAuditCheckpoint(ctx, db.CreateAuditCheckpointParams{
+		LastLogID: head.ID,
+		LastHash:  head.Hash,
+		LogCount:  count,
+		KeyID:     checkpointKeys.activeID,
+		Signature: base64.StdEncoding.EncodeToString(signature),
+		CreatedAt: createdAt,
+	})
+	if err != nil {
+		return db.AuditCheckpoint{}, false, err
+	}
+	exported, err := json.Marshal(ExportCheckpoint(cp))
+	if err != nil {
+		return cp, true, err
+	}
+	logger.Info(ctx, fmt.Sprintf("audit checkpoint %d: %s", cp.ID, exported))
+	return cp, true, nil
+}
+
+// LatestCheckpoint returns the newest checkpoint in the database, sql.ErrNoRows without one
+func LatestCheckpoint(ctx context.Context) (db.AuditCheckpoint, error) {
+	return db.Get().GetLatestAuditCheckpoint(ctx)
+}
+
+// checkpointMessage is what a checkpoint signature covers
+func checkpointMessage(lastLogID int64, lastHash string, count int64, createdAt time.Time) []byte {
+	return fmt.Appendf(nil, "audit-checkpoint:v1\n%d\n%s\n%d\n%d", lastLogID, lastHash, count, createdAt.Unix())
+}
+
+// verifyCheckpointSignature checks the checkpoint was signed by the key it names
+func verifyCheckpointSignature(cp db.AuditCheckpoint) error {
+	key, ok := checkpointKeys.keys[cp.KeyID]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %s", ErrCheckpointSignature, cp.KeyID)
+	}
+	signature, err := base64.StdEncoding.DecodeString(cp.Signature)
+	if err != nil {
+		return ErrCheckpointSignature
+	}
+	message := checkpointMessage(cp.LastLogID, cp.LastHash, cp.LogCount, cp.CreatedAt)
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), message, signature) {
+		return ErrCheckpointSignature
+	}
+	return nil
+}
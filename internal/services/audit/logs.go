@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+)
+
+// timestampLayouts are the formats the sqlite driver writes time.Time values in
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+// endOfTime is the upper bound of filters without Until
+var endOfTime = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// likeEscaper makes the LIKE wildcards of a search match themselves, see ListAuditLogs
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// List returns a page of audit logs matching the filter, newest first
+func List(ctx context.Context, filter Filter) (Page, error) {
+	var cursor int64
+	if filter.Cursor != "" {
+		id, err := strconv.ParseInt(filter.Cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return Page{}, ErrInvalidCursor
+		}
+		cursor = id
+	}
+	if filter.StatusCode < 0 || (filter.StatusCode != 0 && (filter.StatusCode < 100 || filter.StatusCode > 599)) {
+		return Page{}, ErrInvalidFilter
+	}
+	until := endOfTime
+	if !filter.Until.IsZero() {
+		until = filter.Until
+	}
+	if !filter.Since.IsZero() && !filter.Since.Before(until) {
+		return Page{}, ErrInvalidFilter
+	}
+	pageSize := filter.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	pageSize = min(pageSize, MaxPageSize)
+
+	// One extra row tells whether there is a next page
+	rows, err := db.Get().ListAuditLogs(ctx, db.ListAuditLogsParams{
+		Cursor:       cursor,
+		AdminUserID:  filter.AdminUserID,
+		TargetUserID: filter.TargetUserID,
+		Action:       filter.Action,
+		Resource:     filter.Resource,
+		StatusCode:   int64(filter.StatusCode),
+		Since:        filter.Since.UTC(),
+		Until:        until.UTC(),
+		Search:       likeEscaper.Replace(filter.Search),
+		PageSize:     int64(pageSize + 1),
+	})
+	if err != nil {
+		return Page{}, err
+	}
+	var page Page
+	if len(rows) > pageSize {
+		rows = rows[:pageSize]
+		page.NextCursor = strconv.FormatInt(rows[pageSize-1].ID, 10)
+	}
+	page.Logs = make([]Log, 0, len(rows))
+	for _, row := range rows {
+		page.Logs = append(page.Logs, newLog(row))
+	}
+	return page, nil
+}
+
+// GetByRequestID returns the log of the request, sql.ErrNoRows when it wasn't audited
+func GetByRequestID(ctx context.Context, requestID string) (Log, error) {
+	row, err := db.Get().GetAuditLogsByRequestID(ctx, requestID)
+	if err != nil {
+		return Log{}, err
+	}
+	return newLog(row), nil
+}
+
+func newLog(row db.AdminAuditLog) Log {
+	return Log{
+		ID:                 row.ID,
+		AdminUserID:        row.AdminUserID,
+		AdminEmail:         row.AdminEmail,
+		TargetUserID:       row.TargetUserID,
+		ImpersonatedUserID: row.ImpersonatedUserID,
+		Action:             row.Action,
+		Resource:           row.Resource,
+		Method:             row.Method,
+		Path:               row.Path,
+		QueryParams:        row.QueryParams,
+		RequestBody:        row.RequestBody,
+		RequestHeaders:     row.RequestHeaders,
+		IPAddress:          row.IpAddress,
+		UserAgent:          row.UserAgent,
+		StatusCode:         row.StatusCode,
+		ResponseTimeMs:     row.ResponseTimeMs,
+		Timestamp:          ParseTimestamp(row.Timestamp),
+		RequestID:          row.RequestID,
+	}
+}
+
+// ParseTimestamp converts a timestamp column to time.Time. The column type isn't one the
+// sqlite driver recognises, so it comes back as text, zero time when it can't be parsed.
+func ParseTimestamp(value any) time.Time {
+	var text string
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC()
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return time.Time{}
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,299 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nikojunttila/community/internal/utility"
+)
+
+// Redacted replaces the values hidden from the audit log
+const Redacted = "[REDACTED]"
+
+// MaxRedactableBody is the largest body that is parsed for redaction. Larger bodies are
+// summarised, a partial JSON or form body can't be redacted reliably.
+const MaxRedactableBody = 1 << 20
+
+// Redaction decides what of a request ends up in the audit log
+type Redaction struct {
+	Fields       []string         // lowercase parts of JSON, form and query field names whose values are hidden
+	Headers      []string         // header names whose values are hidden
+	Patterns     []*regexp.Regexp // matches are hidden anywhere in the stored body, query and headers
+	MaxBodyBytes int              // stored bodies are truncated to this size, 0 stores none
+}
+
+// DefaultRedaction hides credentials, tokens and one-time codes
+func DefaultRedaction() Redaction {
+	return Redaction{
+		Fields: []string{
+			"password", "passwd", "secret", "token", "otp", "recovery_code",
+			"api_key", "apikey", "authorization", "cookie", "credential", "private_key",
+		},
+		Headers: []string{
+			"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Csrf-Token", "X-Api-Key",
+		},
+		Patterns: []*regexp.Regexp{
+			regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), // JWT
+			regexp.MustCompile(`pat_[A-Za-z0-9_-]{16,}`),                            // personal access token
+			regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`),
+		},
+		MaxBodyBytes: 16 << 10,
+	}
+}
+
+var redaction = DefaultRedaction()
+
+// LoadRedaction adds AUDIT_REDACT_FIELDS and AUDIT_REDACT_HEADERS, comma separated, and the
+// regular expressions in AUDIT_REDACT_PATTERNS_FILE, one per line, to the defaults.
+// AUDIT_MAX_BODY_BYTES caps the stored request body, 0 only stores a summary.
+func LoadRedaction() error {
+	r := DefaultRedaction()
+	for _, field := range strings.Split(utility.GetEnvDefault("AUDIT_REDACT_FIELDS", ""), ",") {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			r.Fields = append(r.Fields, field)
+		}
+	}
+	for _, header := range strings.Split(utility.GetEnvDefault("AUDIT_REDACT_HEADERS", ""), ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			r.Headers = append(r.Headers, header)
+		}
+	}
+	if path := utility.GetEnvDefault("AUDIT_REDACT_PATTERNS_FILE", ""); path != "" {
+		patterns, err := readPatterns(path)
+		if err != nil {
+			return err
+		}
+		r.Patterns = append(r.Patterns, patterns...)
+	}
+	if raw := utility.GetEnvDefault("AUDIT_MAX_BODY_BYTES", ""); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 0 {
+			return fmt.Errorf("AUDIT_MAX_BODY_BYTES must be a size in bytes, got %q", raw)
+		}
+		r.MaxBodyBytes = size
+	}
+	redaction = r
+	return nil
+}
+
+// readPatterns reads one regular expression per line, blank lines and # comments are skipped
+func readPatterns(path string) ([]*regexp.Regexp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		pattern, err := regexp.Compile(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, scanner.Err()
+}
+
+// RedactBody returns the body as stored in the audit log, see Redaction.Body
+func RedactBody(contentType string, body []byte) string {
+	return redaction.Body(contentType, body)
+}
+
+// RedactQuery returns the query string as stored in the audit log
+func RedactQuery(rawQuery string) string {
+	return redaction.Query(rawQuery)
+}
+
+// RedactHeaders returns the headers as stored in the audit log
+func RedactHeaders(header http.Header) string {
+	return redaction.HeaderJSON(header)
+}
+
+// SummarizeBody describes a body that isn't stored, e.g. a file upload
+func SummarizeBody(contentType string, size int64) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = "unknown"
+	}
+	if size < 0 {
+		return fmt.Sprintf("[%s body omitted]", mediaType)
+	}
+	return fmt.Sprintf("[%s body omitted, %d bytes]", mediaType, size)
+}
+
+// IsTextBody reports whether the body of the content type can be stored and redacted.
+// Multipart and binary bodies are only summarised.
+func IsTextBody(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json", strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/x-www-form-urlencoded",
+		mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return false
+}
+
+// Body redacts sensitive fields of JSON and form bodies, then the patterns, and truncates
+// the result to MaxBodyBytes. Binary bodies and bodies too large to parse are summarised.
+func (r Redaction) Body(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if r.MaxBodyBytes == 0 || !IsTextBody(contentType) || !utf8.Valid(body) || len(body) > MaxRedactableBody {
+		return SummarizeBody(contentType, int64(len(body)))
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	text := string(body)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		text = r.Query(text)
+	case json.Valid(body):
+		text = r.json(body)
+	default:
+		text = r.Text(text)
+	}
+	return r.truncate(text)
+}
+
+// json redacts the values of sensitive keys at any depth
+func (r Redaction) json(body []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return r.Text(string(body))
+	}
+	redacted, err := json.Marshal(r.redactValue(value))
+	if err != nil {
+		return r.Text(string(body))
+	}
+	return r.Text(string(redacted))
+}
+
+func (r Redaction) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, inner := range v {
+			if r.sensitiveField(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = r.redactValue(inner)
+			}
+		}
+	case []any:
+		for i, inner := range v {
+			v[i] = r.redactValue(inner)
+		}
+	}
+	return value
+}
+
+// Query redacts the values of sensitive fields of a query string or form body
+func (r Redaction) Query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return r.Text(rawQuery)
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range values[key] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(key))
+			b.WriteByte('=')
+			if r.sensitiveField(key) {
+				b.WriteString(Redacted)
+			} else {
+				b.WriteString(url.QueryEscape(value))
+			}
+		}
+	}
+	return r.Text(b.String())
+}
+
+// HeaderJSON returns the headers as a JSON object with sensitive values hidden
+func (r Redaction) HeaderJSON(header http.Header) string {
+	if len(header) == 0 {
+		return ""
+	}
+	stored := make(map[string]string, len(header))
+	for name, values := range header {
+		if r.sensitiveHeader(name) {
+			stored[name] = Redacted
+			continue
+		}
+		stored[name] = r.Text(strings.Join(values, ", "))
+	}
+	encoded, _ := json.Marshal(stored)
+	return string(encoded)
+}
+
+// Text hides every match of the patterns
+func (r Redaction) Text(text string) string {
+	for _, pattern := range r.Patterns {
+		text = pattern.ReplaceAllString(text, Redacted)
+	}
+	return text
+}
+
+func (r Redaction) sensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range r.Fields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Redaction) sensitiveHeader(name string) bool {
+	return slices.ContainsFunc(r.Headers, func(header string) bool {
+		return strings.EqualFold(header, name)
+	}) || r.sensitiveField(strings.ReplaceAll(name, "-", "_"))
+}
+
+// truncate cuts text to MaxBodyBytes without splitting a character
+func (r Redaction) truncate(text string) string {
+	if len(text) <= r.MaxBodyBytes {
+		return text
+	}
+	cut := r.MaxBodyBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s…[truncated, %d bytes]", text[:cut], len(text))
+}
@@ -0,0 +1,309 @@
+package audit
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/utility"
+)
+
+// maxArchiveLogs bounds one archive so the delete stays a short transaction, the next
+// run picks up where this one stopped
+const maxArchiveLogs = 100_000
+
+// RetentionConfig decides how long audit logs stay in the database
+type RetentionConfig struct {
+	Period time.Duration // logs older than this are archived and deleted, 0 keeps them forever
+	Dir    string        // where archive files and manifests are written
+}
+
+// ArchivedLog is one line of an archive file. Hash can be checked with HashLog(PrevHash, Entry).
+type ArchivedLog struct {
+	ID int64 `json:"id"`
+	Entry
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// ArchiveManifest describes an archive file, it is written next to it
+type ArchiveManifest struct {
+	File            string    `json:"file"`
+	SHA256          string    `json:"sha256"` // of the gzipped file
+	Logs            int64     `json:"logs"`
+	ChainedLogs     int64     `json:"chained_logs"`
+	FirstLogID      int64     `json:"first_log_id"`
+	LastLogID       int64     `json:"last_log_id"`
+	FirstPrevHash   string    `json:"first_prev_hash"` // hash of the newest log of the previous archive
+	LastHash        string    `json:"last_hash"`       // prev_hash of the oldest log left in the database
+	OldestTimestamp time.Time `json:"oldest_timestamp"`
+	NewestTimestamp time.Time `json:"newest_timestamp"`
+	Cutoff          time.Time `json:"cutoff"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ArchiveRun is the outcome of one retention run, stored in audit_archive_runs
+type ArchiveRun struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Cutoff     time.Time
+	Archived   int64  // logs archived and deleted
+	File       string // empty when nothing had expired
+	Manifest   string
+	Error      string
+}
+
+var retention RetentionConfig
+
+// archiveMu keeps runs of this process from archiving the same logs twice
+var archiveMu sync.Mutex
+
+// LoadRetention reads AUDIT_RETENTION_DAYS, 0 or unset keeps logs forever, and
+// AUDIT_ARCHIVE_DIR, archives/audit by default
+func LoadRetention() error {
+	cfg := RetentionConfig{Dir: utility.GetEnvDefault("AUDIT_ARCHIVE_DIR", "archives/audit")}
+	if raw := utility.GetEnvDefault("AUDIT_RETENTION_DAYS", ""); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days < 0 {
+			return fmt.Errorf("AUDIT_RETENTION_DAYS must be a number of days, got %q", raw)
+		}
+		cfg.Period = time.Duration(days) * 24 * time.Hour
+	}
+	retention = cfg
+	return nil
+}
+
+// Retention returns the loaded retention settings
+func Retention() RetentionConfig {
+	return retention
+}
+
+// RetentionEnabled reports whether old logs are archived
+func RetentionEnabled() bool {
+	return retention.Period > 0
+}
+
+// LastArchiveRun returns the latest stored run of the server or of cmd/auditchain, false
+// before the first one
+func LastArchiveRun(ctx context.Context) (ArchiveRun, bool, error) {
+	row, err := db.Get().GetLatestAuditArchiveRun(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ArchiveRun{}, false, nil
+	}
+	if err != nil {
+		return ArchiveRun{}, false, err
+	}
+	return ArchiveRun{
+		StartedAt:  row.StartedAt,
+		FinishedAt: row.FinishedAt,
+		Cutoff:     row.Cutoff,
+		Archived:   row.Archived,
+		File:       row.File,
+		Manifest:   row.Manifest,
+		Error:      row.Error,
+	}, true, nil
+}
+
+// ListArchives returns the newest archives first
+func ListArchives(ctx context.Context, limit int64) ([]db.AuditArchive, error) {
+	return db.Get().ListAuditArchives(ctx, limit)
+}
+
+// ArchiveExpired exports the logs older than the retention period to a gzipped JSONL
+// file with a manifest and a sha256sum file, then deletes them. Logs are archived oldest
+// first and the run stops at the first log that hasn't expired, so the logs left keep
+// linking to the newest archive. It returns false when nothing had expired. Every run is
+// recorded, see LastArchiveRun.
+func ArchiveExpired(ctx context.Context) (db.AuditArchive, bool, error) {
+	if !RetentionEnabled() {
+		return db.AuditArchive{}, false, nil
+	}
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	run := ArchiveRun{StartedAt: time.Now().UTC()}
+	run.Cutoff = run.StartedAt.Add(-retention.Period)
+	archive, created, err := archiveExpired(ctx, &run)
+	run.FinishedAt = time.Now().UTC()
+	if err != nil {
+		run.Error = err.Error()
+	}
+	// A failed run is still recorded, its error is what the admin needs to see
+	if rerr := db.Get().CreateAuditArchiveRun(ctx, db.CreateAuditArchiveRunParams{
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		Cutoff:     run.Cutoff,
+		Archived:   run.Archived,
+		File:       run.File,
+		Manifest:   run.Manifest,
+		Error:      run.Error,
+	}); rerr != nil {
+		logger.Error(ctx, rerr, "Failed to record the audit archive run")
+	}
+	return archive, created, err
+}
+
+func archiveExpired(ctx context.Context, run *ArchiveRun) (db.AuditArchive, bool, error) {
+
+	anchor, err := latestArchive(ctx, db.Get())
+	if err != nil {
+		return db.AuditArchive{}, false, err
+	}
+	if err := os.MkdirAll(retention.Dir, 0o700); err != nil {
+		return db.AuditArchive{}, false, err
+	}
+	tmp, err := os.CreateTemp(retention.Dir, ".audit-*.tmp")
+	if err != nil {
+		return db.AuditArchive{}, false, err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+	manifest, err := exportExpired(ctx, tmp, anchor, run.Cutoff)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || manifest.Logs == 0 {
+		return db.AuditArchive{}, false, err
+	}
+
+	base := fmt.Sprintf("audit-%d-%d", manifest.FirstLogID, manifest.LastLogID)
+	manifest.File = base + ".jsonl.gz"
+	manifest.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	file := filepath.Join(retention.Dir, manifest.File)
+	manifestFile := filepath.Join(retention.Dir, base+".manifest.json")
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return db.AuditArchive{}, false, err
+	}
+	checksum := fmt.Sprintf("%s  %s\n", manifest.SHA256, manifest.File) // sha256sum -c format
+	if err := os.WriteFile(filepath.Join(retention.Dir, base+".sha256"), []byte(checksum), 0o600); err != nil {
+		return db.AuditArchive{}, false, err
+	}
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return db.AuditArchive{}, false, err
+	}
+	if err := os.WriteFile(manifestFile, append(encoded, '\n'), 0o600); err != nil {
+		return db.AuditArchive{}, false, err
+	}
+
+	archive, err := recordArchive(ctx, manifest, file, manifestFile)
+	if err != nil {
+		return db.AuditArchive{}, false, err
+	}
+	run.Archived, run.File, run.Manifest = archive.LogCount, archive.File, archive.Manifest
+	logger.Info(ctx, fmt.Sprintf("archived %d audit logs %d-%d to %s, sha256 %s",
+		archive.LogCount, archive.FirstLogID, archive.LastLogID, archive.File, archive.Sha256))
+	return archive, true, nil
+}
+
+// exportExpired writes the expired logs after the anchor to w, gzipped, and describes them
+func exportExpired(ctx context.Context, w io.Writer, anchor db.AuditArchive, cutoff time.Time) (ArchiveManifest, error) {
+	manifest := ArchiveManifest{FirstPrevHash: anchor.LastHash, LastHash: anchor.LastHash, Cutoff: cutoff}
+	digest := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(w, digest))
+	encoder := json.NewEncoder(gz)
+	lastID := anchor.LastLogID
+	for manifest.Logs < maxArchiveLogs {
+		rows, err := db.Get().ListAuditLogsAfter(ctx, db.ListAuditLogsAfterParams{
+			ID:    lastID,
+			Limit: min(verifyBatchSize, maxArchiveLogs-manifest.Logs),
+		})
+		if err != nil {
+			return manifest, err
+		}
+		for _, row := range rows {
+			entry := entryFromLog(row)
+			if !entry.Timestamp.Before(cutoff) {
+				return manifest, finishExport(gz, digest, &manifest)
+			}
+			if err := encoder.Encode(ArchivedLog{ID: row.ID, Entry: entry, PrevHash: row.PrevHash, Hash: row.Hash}); err != nil {
+				return manifest, err
+			}
+			if manifest.Logs == 0 {
+				manifest.FirstLogID, manifest.FirstPrevHash = row.ID, row.PrevHash
+			}
+			if row.Hash != "" {
+				manifest.ChainedLogs++
+				manifest.LastHash = row.Hash
+			}
+			manifest.Logs++
+			manifest.LastLogID = row.ID
+			manifest.OldestTimestamp = minTime(manifest.OldestTimestamp, entry.Timestamp)
+			manifest.NewestTimestamp = maxTime(manifest.NewestTimestamp, entry.Timestamp)
+			lastID = row.ID
+		}
+		if int64(len(rows)) < verifyBatchSize {
+			break
+		}
+	}
+	return manifest, finishExport(gz, digest, &manifest)
+}
+
+func finishExport(gz *gzip.Writer, digest hash.Hash, manifest *ArchiveManifest) error {
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	manifest.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	return nil
+}
+
+// recordArchive stores the archive and deletes its logs in one transaction
+func recordArchive(ctx context.Context, manifest ArchiveManifest, file, manifestFile string) (db.AuditArchive, error) {
+	chainMu.Lock()
+	defer chainMu.Unlock()
+	tx, err := db.Conn().BeginTx(ctx, nil)
+	if err != nil {
+		return db.AuditArchive{}, err
+	}
+	defer tx.Rollback() // no-op after Commit
+	q := db.Get().WithTx(tx)
+	archive, err := q.CreateAuditArchive(ctx, db.CreateAuditArchiveParams{
+		File:         file,
+		Manifest:     manifestFile,
+		Sha256:       manifest.SHA256,
+		LogCount:     manifest.Logs,
+		ChainedCount: manifest.ChainedLogs,
+		FirstLogID:   manifest.FirstLogID,
+		LastLogID:    manifest.LastLogID,
+		LastHash:     manifest.LastHash,
+		Cutoff:       manifest.Cutoff,
+		CreatedAt:    manifest.CreatedAt,
+	})
+	if err != nil {
+		return db.AuditArchive{}, err
+	}
+	deleted, err := q.DeleteAuditLogsThrough(ctx, manifest.LastLogID)
+	if err != nil {
+		return db.AuditArchive{}, err
+	}
+	if deleted != manifest.Logs {
+		return db.AuditArchive{}, fmt.Errorf("archived %d audit logs but %d were up for deletion", manifest.Logs, deleted)
+	}
+	return archive, tx.Commit()
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.IsZero() || b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
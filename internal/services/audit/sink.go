@@ -0,0 +1,349 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/utility"
+)
+
+// flushTimeout bounds one batch insert, a batch that doesn't make it is spilled
+const flushTimeout = 10 * time.Second
+
+// ErrQueueFull indicates an entry was dropped because the audit queue stayed full.
+var ErrQueueFull = errors.New("audit queue is full")
+
+// SinkConfig controls how recorded entries reach the database
+type SinkConfig struct {
+	QueueSize     int           // entries waiting to be written
+	BatchSize     int           // entries written per transaction
+	FlushInterval time.Duration // longest time an entry waits for its batch to fill
+	EnqueueWait   time.Duration // how long a request waits for room in a full queue before the entry is dropped
+	SpillFile     string        // JSON lines of entries the database didn't take, written on the next flush
+}
+
+// DefaultSinkConfig is used for every setting that isn't in the environment
+func DefaultSinkConfig() SinkConfig {
+	return SinkConfig{
+		QueueSize:     1024,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		EnqueueWait:   100 * time.Millisecond,
+		SpillFile:     "logs/audit_spill.jsonl",
+	}
+}
+
+// SinkStats counts what happened to recorded entries since the sink started
+type SinkStats struct {
+	Queued   int   // entries waiting now
+	Capacity int   // size of the queue
+	Enqueued int64 // entries accepted into the queue
+	Blocked  int64 // entries that had to wait for room in the queue
+	Dropped  int64 // entries dropped because the queue stayed full
+	Written  int64 // entries written to the database from the queue
+	Batches  int64 // transactions that wrote them
+	Spilled  int64 // entries written to the spill file
+	Replayed int64 // spilled entries later written to the database
+	Lost     int64 // entries neither the database nor the spill file took
+}
+
+// sink writes queued entries in batches from a single goroutine
+type sink struct {
+	cfg   SinkConfig
+	queue chan Entry
+	done  chan struct{}
+
+	mu     sync.RWMutex // held for reading while enqueuing, Close takes it to close the queue
+	closed bool
+
+	spillMu sync.Mutex
+
+	enqueued, blocked, dropped, written, batches, spilled, replayed, lost atomic.Int64
+}
+
+var activeSink *sink
+
+// LoadSinkConfig reads AUDIT_QUEUE_SIZE, AUDIT_BATCH_SIZE, AUDIT_FLUSH_INTERVAL,
+// AUDIT_ENQUEUE_WAIT and AUDIT_SPILL_FILE on top of DefaultSinkConfig
+func LoadSinkConfig() (SinkConfig, error) {
+	cfg := DefaultSinkConfig()
+	var err error
+	if cfg.QueueSize, err = envCount("AUDIT_QUEUE_SIZE", cfg.QueueSize); err != nil {
+		return cfg, err
+	}
+	if cfg.BatchSize, err = envCount("AUDIT_BATCH_SIZE", cfg.BatchSize); err != nil {
+		return cfg, err
+	}
+	if cfg.FlushInterval, err = envDuration("AUDIT_FLUSH_INTERVAL", cfg.FlushInterval); err != nil {
+		return cfg, err
+	}
+	if cfg.FlushInterval == 0 {
+		return cfg, errors.New("AUDIT_FLUSH_INTERVAL must be longer than zero")
+	}
+	if cfg.EnqueueWait, err = envDuration("AUDIT_ENQUEUE_WAIT", cfg.EnqueueWait); err != nil {
+		return cfg, err
+	}
+	cfg.SpillFile = utility.GetEnvDefault("AUDIT_SPILL_FILE", cfg.SpillFile)
+	return cfg, nil
+}
+
+func envCount(name string, fallback int) (int, error) {
+	raw := utility.GetEnvDefault(name, "")
+	if raw == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive number, got %q", name, raw)
+	}
+	return n, nil
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	raw := utility.GetEnvDefault(name, "")
+	if raw == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a duration such as 500ms, got %q", name, raw)
+	}
+	return d, nil
+}
+
+// StartSink makes Record queue entries and starts writing them in the background.
+// Entries spilled by an earlier run are written first.
+func StartSink(cfg SinkConfig) {
+	s := &sink{
+		cfg:   cfg,
+		queue: make(chan Entry, cfg.QueueSize),
+		done:  make(chan struct{}),
+	}
+	activeSink = s
+	go s.run()
+}
+
+// Record hands the entry to the sink without waiting for the database. When the queue is
+// full it waits up to EnqueueWait for room and then drops the entry. Without a running
+// sink the entry is written right away.
+func Record(ctx context.Context, entry Entry) {
+	s := activeSink
+	if s == nil {
+		if _, err := Append(ctx, entry); err != nil {
+			logger.Error(ctx, err, "Failed to write audit log")
+		}
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		// Shutting down, the spill file is written on the next start
+		s.spill(ctx, []Entry{entry})
+		return
+	}
+	select {
+	case s.queue <- entry:
+		s.enqueued.Add(1)
+		return
+	default:
+	}
+	s.blocked.Add(1)
+	timer := time.NewTimer(s.cfg.EnqueueWait)
+	defer timer.Stop()
+	select {
+	case s.queue <- entry:
+		s.enqueued.Add(1)
+	case <-timer.C:
+		s.dropped.Add(1)
+		logger.Warn(ctx, ErrQueueFull, fmt.Sprintf("Dropped audit log of request %s", entry.RequestID))
+	}
+}
+
+// Close stops accepting entries and waits until the queued ones are written or spilled
+func Close(ctx context.Context) error {
+	s := activeSink
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the counters of the running sink, zero without one
+func Stats() SinkStats {
+	s := activeSink
+	if s == nil {
+		return SinkStats{}
+	}
+	return SinkStats{
+		Queued:   len(s.queue),
+		Capacity: cap(s.queue),
+		Enqueued: s.enqueued.Load(),
+		Blocked:  s.blocked.Load(),
+		Dropped:  s.dropped.Load(),
+		Written:  s.written.Load(),
+		Batches:  s.batches.Load(),
+		Spilled:  s.spilled.Load(),
+		Replayed: s.replayed.Load(),
+		Lost:     s.lost.Load(),
+	}
+}
+
+func (s *sink) run() {
+	defer close(s.done)
+	s.replay()
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Entry, 0, s.cfg.BatchSize)
+	for {
+		select {
+		case entry, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= s.cfg.BatchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+			s.replay()
+		}
+	}
+}
+
+// flush writes the batch in one transaction and spills it when the database fails
+func (s *sink) flush(batch []Entry) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := AppendBatch(ctx, batch); err != nil {
+		logger.Error(ctx, err, fmt.Sprintf("Failed to write %d audit logs, spilling them to %s", len(batch), s.cfg.SpillFile))
+		s.spill(ctx, batch)
+		return
+	}
+	s.written.Add(int64(len(batch)))
+	s.batches.Add(1)
+}
+
+// spill appends the entries to the spill file
+func (s *sink) spill(ctx context.Context, entries []Entry) {
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+	if err := appendSpill(s.cfg.SpillFile, entries); err != nil {
+		s.lost.Add(int64(len(entries)))
+		logger.Error(ctx, err, fmt.Sprintf("Lost %d audit logs", len(entries)))
+		return
+	}
+	s.spilled.Add(int64(len(entries)))
+}
+
+func appendSpill(path string, entries []Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// replay writes the spilled entries to the database in batches. Entries still left when
+// the database fails again stay in the spill file for the next try.
+func (s *sink) replay() {
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+	ctx := context.Background()
+	entries, err := readSpill(ctx, s.cfg.SpillFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Error(ctx, err, "Failed to read the audit spill file")
+		}
+		return
+	}
+	total := len(entries)
+	for len(entries) > 0 {
+		n := min(len(entries), s.cfg.BatchSize)
+		batchCtx, cancel := context.WithTimeout(ctx, flushTimeout)
+		err := AppendBatch(batchCtx, entries[:n])
+		cancel()
+		if err != nil {
+			break
+		}
+		s.replayed.Add(int64(n))
+		entries = entries[n:]
+	}
+	if len(entries) == 0 {
+		if err := os.Remove(s.cfg.SpillFile); err != nil {
+			logger.Error(ctx, err, "Failed to remove the audit spill file")
+		}
+		return
+	}
+	if len(entries) == total {
+		return // the database is still unavailable
+	}
+	// Rewrite what is left so the written entries aren't written twice
+	tmp := s.cfg.SpillFile + ".tmp"
+	if err := appendSpill(tmp, entries); err != nil {
+		os.Remove(tmp)
+		logger.Error(ctx, err, "Failed to rewrite the audit spill file")
+		return
+	}
+	if err := os.Rename(tmp, s.cfg.SpillFile); err != nil {
+		logger.Error(ctx, err, "Failed to rewrite the audit spill file")
+	}
+}
+
+// readSpill reads the spill file, lines that aren't entries are logged and skipped
+func readSpill(ctx context.Context, path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 4*MaxRedactableBody) // a line holds a whole stored body
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Error(ctx, err, fmt.Sprintf("Skipping line %d of the audit spill file", line))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+)
+
+// AdminStats summarises what one admin has done
+type AdminStats struct {
+	AdminUserID       string
+	AdminEmail        string
+	TotalActions      int64
+	UniqueTargets     int64
+	UniqueActions     int64
+	AvgResponseTimeMs float64
+	LastActivity      time.Time
+}
+
+// ResourceStats summarises the requests made to one resource
+type ResourceStats struct {
+	Resource          string
+	TotalActions      int64
+	UniqueAdmins      int64
+	AvgResponseTimeMs float64
+	ErrorCount        int64
+}
+
+// ActionStats summarises one kind of action
+type ActionStats struct {
+	Action            string
+	TotalCount        int64
+	UniqueAdmins      int64
+	UniqueTargets     int64
+	AvgResponseTimeMs float64
+}
+
+// StatsByAdmin returns the activity of every admin, most active first
+func StatsByAdmin(ctx context.Context) ([]AdminStats, error) {
+	rows, err := db.Get().GetAuditLogStatsByAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]AdminStats, 0, len(rows))
+	for _, row := range rows {
+		stats = append(stats, AdminStats{
+			AdminUserID:       row.AdminUserID,
+			AdminEmail:        row.AdminEmail,
+			TotalActions:      row.TotalActions,
+			UniqueTargets:     row.UniqueTargets,
+			UniqueActions:     row.UniqueActions,
+			AvgResponseTimeMs: row.AvgResponseTime.Float64,
+			LastActivity:      ParseTimestamp(row.LastActivity),
+		})
+	}
+	return stats, nil
+}
+
+// StatsByResource returns the activity of every resource, busiest first
+func StatsByResource(ctx context.Context) ([]ResourceStats, error) {
+	rows, err := db.Get().GetAuditLogStatsByResource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]ResourceStats, 0, len(rows))
+	for _, row := range rows {
+		stats = append(stats, ResourceStats{
+			Resource:          row.Resource,
+			TotalActions:      row.TotalActions,
+			UniqueAdmins:      row.UniqueAdmins,
+			AvgResponseTimeMs: row.AvgResponseTime.Float64,
+			ErrorCount:        int64(row.ErrorCount.Float64),
+		})
+	}
+	return stats, nil
+}
+
+// StatsByAction returns the activity of every action, most common first
+func StatsByAction(ctx context.Context) ([]ActionStats, error) {
+	rows, err := db.Get().GetAuditLogStatsByAction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]ActionStats, 0, len(rows))
+	for _, row := range rows {
+		stats = append(stats, ActionStats{
+			Action:            row.Action,
+			TotalCount:        row.TotalCount,
+			UniqueAdmins:      row.UniqueAdmins,
+			UniqueTargets:     row.UniqueTargets,
+			AvgResponseTimeMs: row.AvgResponseTime.Float64,
+		})
+	}
+	return stats, nil
+}
@@ -0,0 +1,62 @@
+// Package audit reads the admin audit log written by middleware.AdminAuditMiddleware
+package audit
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultPageSize is the number of logs returned when the page size isn't given
+	DefaultPageSize = 50
+	// MaxPageSize caps the page size a caller can ask for
+	MaxPageSize = 200
+)
+
+// ErrInvalidCursor indicates the cursor wasn't returned by a previous page.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidFilter indicates a malformed filter value, e.g. a status code or time range.
+var ErrInvalidFilter = errors.New("invalid audit log filter")
+
+// Filter narrows down the audit logs, zero values match everything
+type Filter struct {
+	AdminUserID  string
+	TargetUserID string
+	Action       string
+	Resource     string
+	StatusCode   int
+	Since        time.Time // inclusive
+	Until        time.Time // exclusive
+	Search       string    // literal part of the admin email, a user id, the action, resource or path
+	Cursor       string    // NextCursor of the previous page, empty for the first page
+	PageSize     int
+}
+
+// Page is one page of audit logs, newest first. NextCursor is empty on the last page.
+type Page struct {
+	Logs       []Log
+	NextCursor string
+}
+
+// Log is an audit log row with the timestamp parsed
+type Log struct {
+	ID                 int64
+	AdminUserID        string
+	AdminEmail         string
+	TargetUserID       string
+	ImpersonatedUserID string
+	Action             string
+	Resource           string
+	Method             string
+	Path               string
+	QueryParams        string
+	RequestBody        string
+	RequestHeaders     string // JSON object
+	IPAddress          string
+	UserAgent          string
+	StatusCode         int64
+	ResponseTimeMs     int64
+	Timestamp          time.Time
+	RequestID          string
+}
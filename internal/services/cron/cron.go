@@ -3,28 +3,75 @@ package cron
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/nikojunttila/community/internal/auth"
 	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/services/audit"
+	"github.com/nikojunttila/community/internal/services/oidc"
+	userService "github.com/nikojunttila/community/internal/services/user"
 	"github.com/robfig/cron/v3"
 )
 
-func task() {
-	fmt.Println("hellope from cronjob")
+// purgeExpiredTokens keeps the token tables from growing forever
+func purgeExpiredTokens() {
+	ctx := context.Background()
+	if err := auth.PurgeExpiredTokens(ctx); err != nil {
+		logger.Error(ctx, err, "Failed to purge expired tokens")
+	}
+	if err := auth.PurgeExpiredPersonalAccessTokens(ctx); err != nil {
+		logger.Error(ctx, err, "Failed to purge expired personal access tokens")
+	}
+	if err := userService.PurgeExpiredPasswordResetTokens(ctx); err != nil {
+		logger.Error(ctx, err, "Failed to purge expired password reset tokens")
+	}
+	if err := userService.PurgeExpiredEmailVerificationTokens(ctx); err != nil {
+		logger.Error(ctx, err, "Failed to purge expired email verification tokens")
+	}
+	if err := userService.PurgeExpiredPasskeySessions(ctx); err != nil {
+		logger.Error(ctx, err, "Failed to purge expired passkey challenges")
+	}
+	if err := userService.PurgeStaleLoginAttempts(ctx); err != nil {
+		logger.Error(ctx, err, "Failed to purge stale login attempts")
+	}
+	if err := oidc.PurgeExpired(ctx); err != nil {
+		logger.Error(ctx, err, "Failed to purge expired oauth codes and tokens")
+	}
+}
+
+// checkpointAuditLog signs the head of the audit log chain so deleting the newest logs is detectable
+func checkpointAuditLog() {
+	ctx := context.Background()
+	if _, _, err := audit.CreateCheckpoint(ctx); err != nil {
+		logger.Error(ctx, err, "Failed to create audit log checkpoint")
+	}
+}
+
+// archiveAuditLog moves audit logs past the retention period to archive files
+func archiveAuditLog() {
+	ctx := context.Background()
+	if _, _, err := audit.ArchiveExpired(ctx); err != nil {
+		logger.Error(ctx, err, "Failed to archive expired audit logs")
+	}
 }
 
 // Setup initializes cron jobs
 func Setup() {
 	c := cron.New()
-	// c.AddFunc("@every 1s", func() {
-	// 	fmt.Println("Running data transfer")
-	// })
-	_, err := c.AddFunc("* * 1 * *", func() {
-		task()
-	})
-	if err != nil {
-		logger.Fatal(context.Background(), err, "Failed to add cron job")
+	if _, err := c.AddFunc("@hourly", purgeExpiredTokens); err != nil {
+		logger.Fatal(context.Background(), err, "Failed to add token purge job")
 		return
 	}
+	if audit.CheckpointsEnabled() {
+		if _, err := c.AddFunc("@every 15m", checkpointAuditLog); err != nil {
+			logger.Fatal(context.Background(), err, "Failed to add audit checkpoint job")
+			return
+		}
+	}
+	if audit.RetentionEnabled() {
+		if _, err := c.AddFunc("@daily", archiveAuditLog); err != nil {
+			logger.Fatal(context.Background(), err, "Failed to add audit archive job")
+			return
+		}
+	}
 	c.Start()
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mailgun/mailgun-go/v5"
@@ -14,9 +15,10 @@ import (
 
 // Emailer struct for sending emails
 type Emailer struct {
-	mg     *mailgun.Client
-	APIKey string
-	Domain string
+	mg      *mailgun.Client
+	APIKey  string
+	Domain  string
+	BaseURL string // public address of this service, used for links inside emails
 }
 
 // Mailer object that can send emails
@@ -26,6 +28,7 @@ var Mailer Emailer
 func EmailerInit(cfg *Emailer) {
 	cfg.Domain = utility.GetEnv("MAILGUN_DOMAIN")
 	cfg.APIKey = utility.GetEnv("MAILGUN_APIKEY")
+	cfg.BaseURL = strings.TrimSuffix(utility.GetEnv("APP_URL"), "/")
 	//create instance of mailgun client
 	cfg.mg = mailgun.NewMailgun(cfg.APIKey)
 }
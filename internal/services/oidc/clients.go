@@ -0,0 +1,150 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+// RegisterClientParams describes an app that wants to log its users in through this service.
+// Confidential clients get a secret, public clients (SPAs, mobile apps) rely on PKCE alone.
+type RegisterClientParams struct {
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	Confidential bool
+}
+
+// RegisterClient stores a new client. The returned secret is only shown once, only its hash is kept.
+func RegisterClient(ctx context.Context, adminID string, params RegisterClientParams) (db.OauthClient, string, error) {
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(params.RedirectURIs) == 0 {
+		return db.OauthClient{}, "", ErrInvalidClientParams
+	}
+	for _, uri := range params.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return db.OauthClient{}, "", ErrInvalidClientParams
+		}
+	}
+	scopes := params.Scopes
+	if len(scopes) == 0 {
+		scopes = SupportedScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(SupportedScopes, scope) {
+			return db.OauthClient{}, "", ErrInvalidClientParams
+		}
+	}
+	if !slices.Contains(scopes, ScopeOpenID) {
+		scopes = append([]string{ScopeOpenID}, scopes...)
+	}
+
+	var secret, secretHash string
+	if params.Confidential {
+		var err error
+		secret, err = auth.GenerateOpaqueToken()
+		if err != nil {
+			return db.OauthClient{}, "", err
+		}
+		secretHash = auth.HashToken(secret)
+	}
+	client := db.OauthClient{
+		ID:           uuid.New().String(),
+		Name:         name,
+		SecretHash:   secretHash,
+		RedirectUris: strings.Join(params.RedirectURIs, " "),
+		Scopes:       strings.Join(scopes, " "),
+		CreatedBy:    adminID,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := db.Get().CreateOAuthClient(ctx, db.CreateOAuthClientParams{
+		ID:           client.ID,
+		Name:         client.Name,
+		SecretHash:   client.SecretHash,
+		RedirectUris: client.RedirectUris,
+		Scopes:       client.Scopes,
+		CreatedBy:    client.CreatedBy,
+		CreatedAt:    client.CreatedAt,
+	}); err != nil {
+		return db.OauthClient{}, "", err
+	}
+	logger.Info(ctx, fmt.Sprintf("oauth client %s (%s) registered by %s", client.ID, client.Name, adminID))
+	return client, secret, nil
+}
+
+// ListClients returns every registered client
+func ListClients(ctx context.Context) ([]db.OauthClient, error) {
+	return db.Get().ListOAuthClients(ctx)
+}
+
+// DeleteClient removes a client together with its codes, tokens and consents, sql.ErrNoRows if it doesn't exist
+func DeleteClient(ctx context.Context, adminID, clientID string) error {
+	rows, err := db.Get().DeleteOAuthClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	logger.Info(ctx, fmt.Sprintf("oauth client %s deleted by %s", clientID, adminID))
+	return nil
+}
+
+// RedirectURIs splits the stored redirect uris of a client
+func RedirectURIs(client db.OauthClient) []string {
+	return strings.Fields(client.RedirectUris)
+}
+
+// IsConfidential reports whether the client authenticates with a secret
+func IsConfidential(client db.OauthClient) bool {
+	return client.SecretHash != ""
+}
+
+// authenticateClient checks the client credentials sent to the token endpoint
+func authenticateClient(ctx context.Context, clientID, secret string) (db.OauthClient, error) {
+	client, err := db.Get().GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.OauthClient{}, oauthError("invalid_client", "unknown client")
+		}
+		return db.OauthClient{}, err
+	}
+	if !IsConfidential(client) {
+		if secret != "" {
+			return db.OauthClient{}, oauthError("invalid_client", "public clients don't have a secret")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return db.OauthClient{}, oauthError("invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+// validRedirectURI accepts absolute https uris without a fragment, and http for local development
+func validRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" || parsed.Fragment != "" || strings.ContainsAny(uri, " \t\n") {
+		return false
+	}
+	switch parsed.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := parsed.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,339 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+// AuthorizationRequest is a validated request to the authorize endpoint
+type AuthorizationRequest struct {
+	Client        db.OauthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	Nonce         string
+	CodeChallenge string
+	Prompt        string
+}
+
+// ParseAuthorizationRequest validates the parameters of the authorize endpoint. ErrClientNotFound
+// and ErrRedirectURIMismatch must be shown to the user, an *Error is sent to the redirect uri.
+func ParseAuthorizationRequest(ctx context.Context, params url.Values) (AuthorizationRequest, error) {
+	client, err := db.Get().GetOAuthClient(ctx, params.Get("client_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return AuthorizationRequest{}, ErrClientNotFound
+		}
+		return AuthorizationRequest{}, err
+	}
+	req := AuthorizationRequest{
+		Client:        client,
+		RedirectURI:   params.Get("redirect_uri"),
+		State:         params.Get("state"),
+		Nonce:         params.Get("nonce"),
+		CodeChallenge: params.Get("code_challenge"),
+		Prompt:        params.Get("prompt"),
+	}
+	if !slices.Contains(RedirectURIs(client), req.RedirectURI) {
+		return AuthorizationRequest{}, ErrRedirectURIMismatch
+	}
+
+	if params.Get("response_type") != "code" {
+		return req, oauthError("unsupported_response_type", "only the code response type is supported")
+	}
+	req.Scopes = strings.Fields(params.Get("scope"))
+	if !slices.Contains(req.Scopes, ScopeOpenID) {
+		return req, oauthError("invalid_scope", "the openid scope is required")
+	}
+	allowed := strings.Fields(client.Scopes)
+	for _, scope := range req.Scopes {
+		if !slices.Contains(allowed, scope) {
+			return req, oauthError("invalid_scope", "scope "+scope+" is not allowed for this client")
+		}
+	}
+	// PKCE is required for every client, plain challenges would leak the verifier
+	if req.CodeChallenge == "" || params.Get("code_challenge_method") != "S256" {
+		return req, oauthError("invalid_request", "a code_challenge with the S256 method is required")
+	}
+	if !slices.Contains([]string{"", "none", "login", "consent"}, req.Prompt) {
+		return req, oauthError("invalid_request", "unsupported prompt value")
+	}
+	return req, nil
+}
+
+// Scope returns the requested scopes as the space separated string used on the wire
+func (req AuthorizationRequest) Scope() string {
+	return strings.Join(req.Scopes, " ")
+}
+
+// RedirectURL is the client's redirect uri with params and the state added
+func (req AuthorizationRequest) RedirectURL(params url.Values) string {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	target, _ := url.Parse(req.RedirectURI)
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	target.RawQuery = query.Encode()
+	return target.String()
+}
+
+// ErrorRedirectURL sends an OAuth error back to the client
+func (req AuthorizationRequest) ErrorRedirectURL(err *Error) string {
+	params := url.Values{"error": {err.Code}}
+	if err.Description != "" {
+		params.Set("error_description", err.Description)
+	}
+	return req.RedirectURL(params)
+}
+
+// NeedsConsent reports whether the user still has to approve some of the requested scopes for the client
+func NeedsConsent(ctx context.Context, userID string, req AuthorizationRequest) (bool, error) {
+	if req.Prompt == "consent" {
+		return true, nil
+	}
+	consent, err := db.Get().GetOAuthConsent(ctx, db.GetOAuthConsentParams{
+		UserID:   userID,
+		ClientID: req.Client.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
+	}
+	granted := strings.Fields(consent.Scope)
+	for _, scope := range req.Scopes {
+		if !slices.Contains(granted, scope) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GrantConsent remembers that the user approved the requested scopes for the client
+func GrantConsent(ctx context.Context, userID string, req AuthorizationRequest) error {
+	scopes := slices.Clone(req.Scopes)
+	consent, err := db.Get().GetOAuthConsent(ctx, db.GetOAuthConsentParams{
+		UserID:   userID,
+		ClientID: req.Client.ID,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	for _, scope := range strings.Fields(consent.Scope) {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return db.Get().UpsertOAuthConsent(ctx, db.UpsertOAuthConsentParams{
+		UserID:    userID,
+		ClientID:  req.Client.ID,
+		Scope:     strings.Join(scopes, " "),
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// IssueAuthorizationCode creates the code the client exchanges for tokens. amr are the
+// authentication methods of the user's session and end up in the ID token.
+func IssueAuthorizationCode(ctx context.Context, user db.User, req AuthorizationRequest, amr []string) (string, error) {
+	code, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	if err := db.Get().CreateOAuthAuthorizationCode(ctx, db.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.Client.ID,
+		UserID:        user.ID,
+		RedirectUri:   req.RedirectURI,
+		Scope:         req.Scope(),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		Amr:           strings.Join(amr, " "),
+		ExpiresAt:     now.Add(authorizationCodeTTL),
+		CreatedAt:     now,
+	}); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code at the token endpoint and returns an access token
+// for the userinfo endpoint and a signed ID token. Failures are returned as *Error.
+func ExchangeCode(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	if req.GrantType != "authorization_code" {
+		return TokenResponse{}, oauthError("unsupported_grant_type", "only authorization_code is supported")
+	}
+	client, err := authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if req.Code == "" || req.CodeVerifier == "" {
+		return TokenResponse{}, oauthError("invalid_request", "code and code_verifier are required")
+	}
+
+	stored, err := db.Get().ConsumeOAuthAuthorizationCode(ctx, auth.HashToken(req.Code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TokenResponse{}, oauthError("invalid_grant", "authorization code is invalid or already used")
+		}
+		return TokenResponse{}, err
+	}
+	if stored.ClientID != client.ID || stored.RedirectUri != req.RedirectURI || time.Now().UTC().After(stored.ExpiresAt) {
+		return TokenResponse{}, oauthError("invalid_grant", "authorization code is invalid or expired")
+	}
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(stored.CodeChallenge)) != 1 {
+		return TokenResponse{}, oauthError("invalid_grant", "code_verifier does not match the code_challenge")
+	}
+
+	user, err := db.Get().GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if auth.IsSuspended(user) {
+		return TokenResponse{}, oauthError("invalid_grant", "user is suspended")
+	}
+
+	accessToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	now := time.Now().UTC()
+	if err := db.Get().CreateOAuthAccessToken(ctx, db.CreateOAuthAccessTokenParams{
+		TokenHash: auth.HashToken(accessToken),
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		Scope:     stored.Scope,
+		ExpiresAt: now.Add(AccessTokenTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return TokenResponse{}, err
+	}
+
+	idToken, err := signIDToken(user, client.ID, stored, now)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	logger.Info(ctx, fmt.Sprintf("oauth client %s issued tokens for user %s", client.ID, user.ID))
+	return TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(AccessTokenTTL.Seconds()),
+		IDToken:     idToken,
+		Scope:       stored.Scope,
+	}, nil
+}
+
+// UserInfo returns the claims the access token's scopes allow
+func UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	invalid := oauthError("invalid_token", "access token is invalid or expired")
+	if accessToken == "" {
+		return nil, invalid
+	}
+	stored, err := db.Get().GetOAuthAccessToken(ctx, auth.HashToken(accessToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, invalid
+		}
+		return nil, err
+	}
+	if time.Now().UTC().After(stored.ExpiresAt) {
+		return nil, invalid
+	}
+	user, err := db.Get().GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, invalid
+		}
+		return nil, err
+	}
+	if auth.IsSuspended(user) {
+		return nil, invalid
+	}
+	return userClaims(user, strings.Fields(stored.Scope)), nil
+}
+
+// Enabled reports whether the provider can serve other apps. ID tokens have to be signed with
+// a key from JWT_KEY_DIR, never with the JWT_SECRET that also signs access tokens.
+func Enabled() bool {
+	return auth.AsymmetricSigning()
+}
+
+// Metadata returns the discovery document
+func Metadata() ProviderMetadata {
+	issuer := Issuer()
+	return ProviderMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{auth.SigningAlgorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "nonce", "amr", "email", "email_verified", "name", "picture"},
+	}
+}
+
+// PurgeExpired removes codes and access tokens that can no longer be used
+func PurgeExpired(ctx context.Context) error {
+	now := time.Now().UTC()
+	if err := db.Get().DeleteExpiredOAuthAuthorizationCodes(ctx, now); err != nil {
+		return err
+	}
+	return db.Get().DeleteExpiredOAuthAccessTokens(ctx, now)
+}
+
+// signIDToken builds the ID token for the user with the same keys as access tokens
+func signIDToken(user db.User, clientID string, code db.OauthAuthorizationCode, now time.Time) (string, error) {
+	claims := userClaims(user, strings.Fields(code.Scope))
+	claims["iss"] = Issuer()
+	claims["aud"] = clientID
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+	if amr := strings.Fields(code.Amr); len(amr) > 0 {
+		claims[auth.ClaimAMR] = amr
+	}
+	jwtauth.SetIssuedAt(claims, now)
+	jwtauth.SetExpiry(claims, now.Add(idTokenTTL))
+	return auth.SignClaims(claims)
+}
+
+// userClaims maps the user to the standard claims of the granted scopes
+func userClaims(user db.User, scopes []string) map[string]any {
+	claims := map[string]any{"sub": user.ID}
+	if slices.Contains(scopes, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		claims["name"] = user.Name
+		if user.AvatarUrl != "" {
+			claims["picture"] = user.AvatarUrl
+		}
+	}
+	return claims
+}
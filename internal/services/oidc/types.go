@@ -0,0 +1,98 @@
+// Package oidc lets other apps log their users in through this service with
+// OpenID Connect, using the authorization code flow with PKCE
+package oidc
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nikojunttila/community/internal/utility"
+)
+
+const (
+	// authorizationCodeTTL is how long the client has to exchange a code for tokens
+	authorizationCodeTTL = 2 * time.Minute
+	// AccessTokenTTL is the lifetime of access tokens for the userinfo endpoint
+	AccessTokenTTL = time.Hour
+	// idTokenTTL is the lifetime of ID tokens
+	idTokenTTL = 10 * time.Minute
+)
+
+// Scopes clients can request
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// SupportedScopes are the scopes a client is allowed when registered without a list
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// ErrClientNotFound indicates the client_id isn't registered. The user is shown an error
+// instead of being redirected, since the redirect uri can't be trusted.
+var ErrClientNotFound = errors.New("unknown client")
+
+// ErrRedirectURIMismatch indicates the redirect_uri isn't registered for the client.
+var ErrRedirectURIMismatch = errors.New("redirect_uri is not registered for this client")
+
+// ErrInvalidClientParams indicates a client registration with a missing name or unusable redirect uris.
+var ErrInvalidClientParams = errors.New("client needs a name, https redirect uris (http only for localhost) and supported scopes")
+
+// Error is an OAuth 2.0 error response, see RFC 6749 sections 4.1.2.1 and 5.2.
+// The authorize endpoint sends it to the client's redirect uri, the token and
+// userinfo endpoints return it as JSON.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) error {
+	return &Error{Code: code, Description: description}
+}
+
+// Issuer is the OIDC issuer identifier, OIDC_ISSUER or APP_URL without the trailing slash
+func Issuer() string {
+	return strings.TrimSuffix(utility.GetEnvDefault("OIDC_ISSUER", utility.GetEnv("APP_URL")), "/")
+}
+
+// ProviderMetadata is the discovery document served at /.well-known/openid-configuration
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// TokenResponse is the successful response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// TokenRequest is a code exchange at the token endpoint. The client authenticates with
+// HTTP basic auth or form fields, public clients send only their client_id.
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+}
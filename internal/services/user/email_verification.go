@@ -0,0 +1,138 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/services/email"
+)
+
+const (
+	// verificationTTL is how long an emailed verification link stays valid
+	verificationTTL = 24 * time.Hour
+	// verificationCooldown is the minimum time between two verification emails
+	verificationCooldown = time.Minute
+	// verificationMaxPerHour caps how many verification emails one user can trigger per hour
+	verificationMaxPerHour = 5
+)
+
+// SendVerificationEmail emails a link that confirms the user's address.
+// Returns ErrVerificationThrottled if the user asked for one too recently or too often.
+func SendVerificationEmail(ctx context.Context, user db.User) error {
+	now := time.Now().UTC()
+	recent, err := db.Get().CountEmailVerificationTokensSince(ctx, db.CountEmailVerificationTokensSinceParams{
+		UserID:    user.ID,
+		CreatedAt: now.Add(-verificationCooldown),
+	})
+	if err != nil {
+		return err
+	}
+	hourly, err := db.Get().CountEmailVerificationTokensSince(ctx, db.CountEmailVerificationTokensSinceParams{
+		UserID:    user.ID,
+		CreatedAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		return err
+	}
+	if recent > 0 || hourly >= verificationMaxPerHour {
+		return ErrVerificationThrottled
+	}
+
+	// Only the most recent link should work
+	if err := db.Get().InvalidateUserEmailVerificationTokens(ctx, user.ID); err != nil {
+		return err
+	}
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if _, err := db.Get().CreateEmailVerificationToken(ctx, db.CreateEmailVerificationTokenParams{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: now.Add(verificationTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/public/verify_email?token=%s", email.Mailer.BaseURL, url.QueryEscape(token))
+	html := fmt.Sprintf(`<p>Please confirm your email address.</p>
+<p><a href="%s">Verify email</a></p>
+<p>The link expires in 24 hours.</p>`, link)
+	text := fmt.Sprintf("Please confirm your email address.\n\nVerify email: %s\n\nThe link expires in 24 hours.", link)
+
+	go func() {
+		if err := email.Mailer.Send(context.Background(), "", user.Email, "Verify your email address", html, text); err != nil {
+			logger.Error(ctx, err, fmt.Sprintf("Failed to send verification email to user %s", user.ID))
+		}
+	}()
+	return nil
+}
+
+// ResendVerificationEmail sends a new verification link to an unverified user.
+// Unknown or already verified addresses are silently ignored so the endpoint can't be used to probe for accounts.
+func ResendVerificationEmail(ctx context.Context, emailAddress string) error {
+	user, err := db.Get().GetUserByEmail(ctx, emailAddress)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return SendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail consumes a verification token and marks the owner's address as verified
+func VerifyEmail(ctx context.Context, token string) (db.User, error) {
+	stored, err := db.Get().GetEmailVerificationTokenByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.User{}, ErrVerificationTokenInvalid
+		}
+		return db.User{}, err
+	}
+	if stored.UsedAt.Valid || time.Now().UTC().After(stored.ExpiresAt) {
+		return db.User{}, ErrVerificationTokenInvalid
+	}
+	claimed, err := db.Get().MarkEmailVerificationTokenUsed(ctx, stored.ID)
+	if err != nil {
+		return db.User{}, err
+	}
+	if claimed == 0 {
+		return db.User{}, ErrVerificationTokenInvalid
+	}
+
+	user, err := db.Get().GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return db.User{}, err
+	}
+	if err := db.Get().SetUserEmailVerified(ctx, db.SetUserEmailVerifiedParams{
+		EmailVerified: true,
+		UpdatedAt:     time.Now(),
+		ID:            user.ID,
+	}); err != nil {
+		return db.User{}, err
+	}
+	cache.RemoveUser(user.LookupID)
+	user.EmailVerified = true
+	logger.Info(ctx, fmt.Sprintf("email verified for user %s", user.ID))
+	return user, nil
+}
+
+// PurgeExpiredEmailVerificationTokens removes verification tokens that can no longer be used
+func PurgeExpiredEmailVerificationTokens(ctx context.Context) error {
+	return db.Get().DeleteExpiredEmailVerificationTokens(ctx, time.Now().UTC())
+}
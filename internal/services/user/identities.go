@@ -0,0 +1,201 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+// ExternalIdentity is the user an OAuth provider vouched for
+type ExternalIdentity struct {
+	Provider       string
+	ProviderUserID string
+	Email          string
+	EmailVerified  bool // the provider confirmed the user owns the address
+	Name           string
+	AvatarURL      string
+}
+
+// LoginWithIdentity returns the user the identity belongs to. Unknown identities are linked to
+// the account with the same email, but only when both the provider and this service have
+// verified the address, otherwise anyone could register an unverified account with somebody
+// else's email and wait for them to log in. Without an account with that email a new user is created.
+func LoginWithIdentity(ctx context.Context, identity ExternalIdentity) (db.User, error) {
+	if identity.Provider == "" || identity.ProviderUserID == "" {
+		return db.User{}, ErrParamsMismatch
+	}
+	stored, err := db.Get().GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Provider:       identity.Provider,
+		ProviderUserID: identity.ProviderUserID,
+	})
+	if err == nil {
+		touchIdentity(ctx, stored.ID)
+		return db.Get().GetUserByID(ctx, stored.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return db.User{}, err
+	}
+
+	email := strings.TrimSpace(strings.ToLower(identity.Email))
+	if email == "" {
+		return db.User{}, ErrParamsMismatch
+	}
+	user, err := db.Get().GetUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		if !identity.EmailVerified || !user.EmailVerified {
+			logger.Warn(ctx, ErrIdentityNotLinked, fmt.Sprintf("refused to auto-link %s identity to user %s", identity.Provider, user.ID))
+			return db.User{}, ErrIdentityNotLinked
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = CreateUser(ctx, "", CreateUserParams{
+			Email:     email,
+			Name:      identity.Name,
+			AvatarURL: identity.AvatarURL,
+		}, OauthCreate{
+			IsOAuth:       true,
+			EmailVerified: identity.EmailVerified,
+			Provider:      identity.Provider,
+			ProviderID:    identity.ProviderUserID,
+		})
+		if err != nil {
+			return db.User{}, err
+		}
+	default:
+		return db.User{}, err
+	}
+
+	if err := createIdentity(ctx, user.ID, identity, true); err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+// LinkIdentity attaches a provider login to the logged in user
+func LinkIdentity(ctx context.Context, user db.User, identity ExternalIdentity) error {
+	if identity.Provider == "" || identity.ProviderUserID == "" {
+		return ErrParamsMismatch
+	}
+	stored, err := db.Get().GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Provider:       identity.Provider,
+		ProviderUserID: identity.ProviderUserID,
+	})
+	if err == nil {
+		if stored.UserID == user.ID {
+			return nil
+		}
+		return ErrIdentityInUse
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	identities, err := db.Get().ListUserIdentities(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, linked := range identities {
+		if linked.Provider == identity.Provider {
+			return ErrProviderAlreadyLinked
+		}
+	}
+	if err := createIdentity(ctx, user.ID, identity, false); err != nil {
+		return err
+	}
+	logger.Info(ctx, fmt.Sprintf("user %s linked their %s account", user.ID, identity.Provider))
+	return nil
+}
+
+// ListIdentities returns the providers linked to the user
+func ListIdentities(ctx context.Context, userID string) ([]db.UserIdentity, error) {
+	return db.Get().ListUserIdentities(ctx, userID)
+}
+
+// UnlinkIdentity removes a provider login. The last way to log in can't be removed,
+// the user has to keep a password, a passkey or another provider.
+func UnlinkIdentity(ctx context.Context, user db.User, provider string) error {
+	identities, err := db.Get().CountUserIdentities(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if identities <= 1 && user.PasswordHash == "" {
+		passkeys, err := db.Get().CountWebAuthnCredentials(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if passkeys == 0 {
+			return ErrLastLoginMethod
+		}
+	}
+	rows, err := db.Get().DeleteUserIdentity(ctx, db.DeleteUserIdentityParams{
+		UserID:   user.ID,
+		Provider: provider,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	logger.Info(ctx, fmt.Sprintf("user %s unlinked their %s account", user.ID, provider))
+	return nil
+}
+
+// SetPassword sets or changes the user's password. Accounts created with a provider can add
+// a password without knowing one, everybody else has to confirm the current password.
+// The new password has to pass the password policy. The user's other sessions are signed out.
+func SetPassword(ctx context.Context, user db.User, sessionID, currentPassword, newPassword string) error {
+	if user.PasswordHash != "" && !auth.CheckPasswordHash(currentPassword, user.PasswordHash) {
+		return ErrWrongPassword
+	}
+	if err := auth.CheckPassword(ctx, newPassword, user.Email); err != nil {
+		return err
+	}
+	passHash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := db.Get().UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		PasswordHash: passHash,
+		UpdatedAt:    time.Now(),
+		ID:           user.ID,
+	}); err != nil {
+		return err
+	}
+	if err := auth.RevokeOtherSessions(ctx, user.ID, sessionID); err != nil {
+		return fmt.Errorf("password changed but failed to revoke sessions: %w", err)
+	}
+	logger.Info(ctx, fmt.Sprintf("password set for user %s", user.ID))
+	return nil
+}
+
+// createIdentity stores the link, loggedIn records the link as the identity's first login
+func createIdentity(ctx context.Context, userID string, identity ExternalIdentity, loggedIn bool) error {
+	now := time.Now().UTC()
+	return db.Get().CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		ID:             uuid.New().String(),
+		UserID:         userID,
+		Provider:       identity.Provider,
+		ProviderUserID: identity.ProviderUserID,
+		Email:          identity.Email,
+		CreatedAt:      now,
+		LastLoginAt:    sql.NullTime{Time: now, Valid: loggedIn},
+	})
+}
+
+// touchIdentity records a login with the identity, failing to do so doesn't fail the login
+func touchIdentity(ctx context.Context, identityID string) {
+	if err := db.Get().TouchUserIdentity(ctx, db.TouchUserIdentityParams{
+		LastLoginAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:          identityID,
+	}); err != nil {
+		logger.Warn(ctx, err, "failed to record identity login")
+	}
+}
@@ -0,0 +1,42 @@
+package userservice
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+// Impersonation is a token that lets an admin see the app as the user
+type Impersonation struct {
+	Token     string
+	ExpiresAt time.Time
+	User      db.User
+}
+
+// StartImpersonation issues an impersonation token for the user. sessionID and methods
+// come from the admin's own access token. Everything done with the token is audited.
+func StartImpersonation(ctx context.Context, admin db.User, userID, sessionID string, methods []string, reason string) (Impersonation, error) {
+	user, err := db.Get().GetUserByID(ctx, userID)
+	if err != nil {
+		return Impersonation{}, err
+	}
+	token, expiresAt, err := auth.Impersonate(ctx, admin, user, sessionID, methods)
+	if err != nil {
+		return Impersonation{}, err
+	}
+	logger.Warn(ctx, nil, fmt.Sprintf("admin %s started impersonating user %s: %s", admin.ID, user.ID, reason))
+	return Impersonation{Token: token, ExpiresAt: expiresAt, User: user}, nil
+}
+
+// EndImpersonation revokes the impersonation token so it can't be used again
+func EndImpersonation(ctx context.Context, adminLookupID string, user db.User, jti string, expiresAt time.Time) error {
+	if err := auth.RevokeAccessToken(ctx, jti, expiresAt); err != nil {
+		return err
+	}
+	logger.Info(ctx, fmt.Sprintf("admin %s stopped impersonating user %s", adminLookupID, user.ID))
+	return nil
+}
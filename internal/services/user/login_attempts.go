@@ -0,0 +1,217 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/services/email"
+)
+
+// Scopes failed logins are counted for
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP      = "ip"
+)
+
+// loginFailureWindow is how long failures are remembered, an older failure starts a new count
+const loginFailureWindow = 24 * time.Hour
+
+// loginThrottle is the backoff policy of one scope. The first failures are free, after
+// that each failure delays the next attempt exponentially and at lockAfter failures the
+// subject is locked out, again doubling with every further failure.
+type loginThrottle struct {
+	backoffAfter int64
+	baseDelay    time.Duration
+	lockAfter    int64
+	lockout      time.Duration
+	maxLockout   time.Duration
+}
+
+// loginThrottles holds the policy per scope. An ip is shared by many users, so it gets more slack.
+var loginThrottles = map[string]loginThrottle{
+	LoginScopeAccount: {backoffAfter: 3, baseDelay: time.Second, lockAfter: 10, lockout: 15 * time.Minute, maxLockout: 24 * time.Hour},
+	LoginScopeIP:      {backoffAfter: 10, baseDelay: time.Second, lockAfter: 50, lockout: 15 * time.Minute, maxLockout: 24 * time.Hour},
+}
+
+// delay returns how long the subject has to wait after its nth failure
+func (t loginThrottle) delay(failed int64) time.Duration {
+	switch {
+	case failed >= t.lockAfter:
+		return min(t.lockout<<min(failed-t.lockAfter, 10), t.maxLockout)
+	case failed > t.backoffAfter:
+		return min(t.baseDelay<<min(failed-t.backoffAfter-1, 10), t.lockout)
+	default:
+		return 0
+	}
+}
+
+// normalizeLoginEmail is the account subject, unknown addresses are throttled the same way so lockouts don't reveal accounts
+func normalizeLoginEmail(emailAddress string) string {
+	return strings.ToLower(strings.TrimSpace(emailAddress))
+}
+
+// LoginRetryAfter returns how long the client has to wait before another password attempt
+// for the email address or from the ip is accepted. Zero means the attempt is allowed.
+func LoginRetryAfter(ctx context.Context, emailAddress, ip string) (time.Duration, error) {
+	now := time.Now().UTC()
+	var wait time.Duration
+	for scope, subject := range map[string]string{LoginScopeAccount: normalizeLoginEmail(emailAddress), LoginScopeIP: ip} {
+		if subject == "" {
+			continue
+		}
+		attempt, err := db.Get().GetLoginAttempt(ctx, db.GetLoginAttemptParams{
+			Scope:   scope,
+			Subject: subject,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return 0, err
+		}
+		if attempt.LockedUntil.Valid && now.Before(attempt.LockedUntil.Time) {
+			wait = max(wait, attempt.LockedUntil.Time.Sub(now))
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed password attempt for the email address and the ip and
+// delays their next attempts. The account owner is emailed when their account gets locked.
+func RecordLoginFailure(ctx context.Context, emailAddress, ip string) error {
+	emailAddress = normalizeLoginEmail(emailAddress)
+	locked, err := recordLoginFailure(ctx, LoginScopeAccount, emailAddress)
+	if err != nil {
+		return err
+	}
+	if ip != "" {
+		if _, err := recordLoginFailure(ctx, LoginScopeIP, ip); err != nil {
+			return err
+		}
+	}
+	if locked {
+		notifyAccountLocked(ctx, emailAddress)
+	}
+	return nil
+}
+
+// RecordLoginSuccess forgets the failures of the account after a correct password.
+// The ip keeps its count so one valid account can't be used to reset it.
+func RecordLoginSuccess(ctx context.Context, emailAddress string) error {
+	_, err := db.Get().DeleteLoginAttempt(ctx, db.DeleteLoginAttemptParams{
+		Scope:   LoginScopeAccount,
+		Subject: normalizeLoginEmail(emailAddress),
+	})
+	return err
+}
+
+// ListLoginLockouts returns the accounts and ips that are currently locked
+func ListLoginLockouts(ctx context.Context) ([]db.LoginAttempt, error) {
+	return db.Get().ListLockedLoginAttempts(ctx, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+}
+
+// ClearLoginLockout removes the failures and lockout of an account or ip, sql.ErrNoRows if there were none
+func ClearLoginLockout(ctx context.Context, adminID, scope, subject string) error {
+	if _, ok := loginThrottles[scope]; !ok || subject == "" {
+		return ErrParamsMismatch
+	}
+	if scope == LoginScopeAccount {
+		subject = normalizeLoginEmail(subject)
+	}
+	rows, err := db.Get().DeleteLoginAttempt(ctx, db.DeleteLoginAttemptParams{
+		Scope:   scope,
+		Subject: subject,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	logger.Info(ctx, fmt.Sprintf("login lockout of %s %s cleared by %s", scope, subject, adminID))
+	return nil
+}
+
+// UnlockUserLogin clears the lockout of the user's account
+func UnlockUserLogin(ctx context.Context, adminID, userID string) (db.User, error) {
+	user, err := db.Get().GetUserByID(ctx, userID)
+	if err != nil {
+		return db.User{}, err
+	}
+	if err := ClearLoginLockout(ctx, adminID, LoginScopeAccount, user.Email); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+// PurgeStaleLoginAttempts removes failures that are outside the window and no longer locked
+func PurgeStaleLoginAttempts(ctx context.Context) error {
+	now := time.Now().UTC()
+	return db.Get().DeleteStaleLoginAttempts(ctx, db.DeleteStaleLoginAttemptsParams{
+		LockedUntil:  sql.NullTime{Time: now, Valid: true},
+		LastFailedAt: sql.NullTime{Time: now.Add(-loginFailureWindow), Valid: true},
+	})
+}
+
+// recordLoginFailure counts one failure for the subject and sets its backoff.
+// It reports whether this failure is the one that locked the subject.
+func recordLoginFailure(ctx context.Context, scope, subject string) (bool, error) {
+	throttle := loginThrottles[scope]
+	now := time.Now().UTC()
+	failed, err := db.Get().RecordLoginFailure(ctx, db.RecordLoginFailureParams{
+		Scope:          scope,
+		Subject:        subject,
+		LastFailedAt:   sql.NullTime{Time: now, Valid: true},
+		UpdatedAt:      now,
+		LastFailedAt_2: sql.NullTime{Time: now.Add(-loginFailureWindow), Valid: true},
+	})
+	if err != nil {
+		return false, err
+	}
+	delay := throttle.delay(failed)
+	if delay == 0 {
+		return false, nil
+	}
+	if err := db.Get().LockLoginAttempt(ctx, db.LockLoginAttemptParams{
+		LockedUntil: sql.NullTime{Time: now.Add(delay), Valid: true},
+		UpdatedAt:   now,
+		Scope:       scope,
+		Subject:     subject,
+	}); err != nil {
+		return false, err
+	}
+	if failed < throttle.lockAfter {
+		return false, nil
+	}
+	logger.Warn(ctx, nil, fmt.Sprintf("login for %s %s locked for %s after %d failed attempts", scope, subject, delay, failed))
+	return failed == throttle.lockAfter, nil
+}
+
+// notifyAccountLocked tells the owner of the email address that their account was locked.
+// Addresses without an account are ignored.
+func notifyAccountLocked(ctx context.Context, emailAddress string) {
+	user, err := db.Get().GetUserByEmail(ctx, emailAddress)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			logger.Error(ctx, err, "failed to look up locked account")
+		}
+		return
+	}
+
+	link := fmt.Sprintf("%s/public/forgot_password", email.Mailer.BaseURL)
+	html := fmt.Sprintf(`<p>Your account was temporarily locked after too many failed login attempts.</p>
+<p>If this wasn't you, someone may be guessing your password. Consider <a href="%s">resetting your password</a> and enabling two-factor authentication.</p>`, link)
+	text := fmt.Sprintf("Your account was temporarily locked after too many failed login attempts.\n\nIf this wasn't you, someone may be guessing your password. Consider resetting your password: %s", link)
+
+	go func() {
+		if err := email.Mailer.Send(context.Background(), "", user.Email, "Your account was locked", html, text); err != nil {
+			logger.Error(ctx, err, fmt.Sprintf("Failed to send lockout email to user %s", user.ID))
+		}
+	}()
+}
@@ -0,0 +1,143 @@
+package userservice
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// otpPeriod is the TOTP time step in seconds
+	otpPeriod = 30
+	// otpMaxAttempts is how many consecutive failures are allowed before the second factor locks
+	otpMaxAttempts = 5
+	// otpBaseLockout is the first lockout, each further failure doubles it
+	otpBaseLockout = time.Minute
+	// otpMaxLockout caps the exponential backoff
+	otpMaxLockout = time.Hour
+)
+
+// ValidateTOTP checks an OTP against the user's secret. Codes of an already used
+// time step are rejected as replays and repeated failures lock the second factor
+// with exponential backoff.
+func ValidateTOTP(ctx context.Context, user db.User, code string) error {
+	if user.Secret == "" {
+		return ErrTwoFactorNotEnabled
+	}
+	secret, err := auth.OpenSecret(user.ID, user.Secret)
+	if err != nil {
+		return err
+	}
+	attempt, err := claimOTPAttempt(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	step, ok := matchTOTPStep(strings.ReplaceAll(strings.TrimSpace(code), " ", ""), secret, now)
+	if !ok {
+		return otpFailure(ctx, user.ID, attempt, ErrOTPInvalid)
+	}
+	rows, err := db.Get().MarkOTPStepUsed(ctx, db.MarkOTPStepUsedParams{
+		LastUsedStep:   step,
+		UpdatedAt:      now,
+		UserID:         user.ID,
+		LastUsedStep_2: step,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return otpFailure(ctx, user.ID, attempt, ErrOTPReplayed)
+	}
+	return nil
+}
+
+// claimOTPAttempt counts the attempt before the code is checked, so concurrent guesses can't
+// all get in before the first failure is recorded. The attempt that reaches otpMaxAttempts
+// locks the second factor up front, a correct code lifts the lock again. Returns the number
+// of the attempt, or ErrOTPLocked while the second factor is locked.
+func claimOTPAttempt(ctx context.Context, userID string) (int64, error) {
+	now := time.Now().UTC()
+	if err := db.Get().EnsureOTPState(ctx, db.EnsureOTPStateParams{
+		UserID:    userID,
+		UpdatedAt: now,
+	}); err != nil {
+		return 0, err
+	}
+	// The claim and the lock are one transaction so no attempt slips in between them
+	tx, err := db.Conn().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op after Commit
+	q := db.Get().WithTx(tx)
+	attempt, err := q.ClaimOTPAttempt(ctx, db.ClaimOTPAttemptParams{
+		UpdatedAt:   now,
+		UserID:      userID,
+		LockedUntil: sql.NullTime{Time: now, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrOTPLocked
+	}
+	if err != nil {
+		return 0, err
+	}
+	if attempt >= otpMaxAttempts {
+		if err := q.LockOTP(ctx, db.LockOTPParams{
+			LockedUntil: sql.NullTime{Time: now.Add(otpLockout(attempt)), Valid: true},
+			UpdatedAt:   now,
+			UserID:      userID,
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return attempt, tx.Commit()
+}
+
+// otpFailure returns the cause of a failed attempt, or ErrOTPLocked when the attempt
+// locked the second factor
+func otpFailure(ctx context.Context, userID string, attempt int64, cause error) error {
+	if attempt < otpMaxAttempts {
+		return cause
+	}
+	logger.Warn(ctx, cause, fmt.Sprintf("second factor of user %s locked for %s after %d failed attempts", userID, otpLockout(attempt), attempt))
+	return ErrOTPLocked
+}
+
+// otpLockout doubles the lockout with every attempt past otpMaxAttempts, up to otpMaxLockout
+func otpLockout(attempt int64) time.Duration {
+	return min(otpBaseLockout<<min(attempt-otpMaxAttempts, 6), otpMaxLockout)
+}
+
+// matchTOTPStep returns the time step the code belongs to, allowing one step of clock skew
+func matchTOTPStep(code, secret string, now time.Time) (int64, bool) {
+	if code == "" {
+		return 0, false
+	}
+	current := now.Unix() / otpPeriod
+	for _, step := range []int64{current - 1, current, current + 1} {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*otpPeriod, 0), totp.ValidateOpts{
+			Period:    otpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
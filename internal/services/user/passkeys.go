@@ -0,0 +1,368 @@
+package userservice
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+// passkeySessionTTL is how long the browser has to answer a passkey challenge
+const passkeySessionTTL = 5 * time.Minute
+
+// Ceremonies a stored passkey challenge can be used for
+const (
+	passkeyRegister = "register"
+	passkeyLogin    = "login"
+	passkeyMFA      = "mfa"
+	passkeyReauth   = "reauth"
+)
+
+// PasskeyReauth proves the user is present before a passkey is added or removed.
+// Assertion answers the challenge from BeginPasskeyReauth that Token identifies.
+type PasskeyReauth struct {
+	Password  string
+	OTPCode   string
+	Token     string
+	Assertion []byte
+}
+
+// passkeyUser adapts a user and their stored credentials to webauthn.User
+type passkeyUser struct {
+	user        db.User
+	credentials []webauthn.Credential
+}
+
+func (u passkeyUser) WebAuthnID() []byte {
+	return []byte(u.user.ID)
+}
+
+func (u passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u passkeyUser) WebAuthnDisplayName() string {
+	if u.user.Name != "" {
+		return u.user.Name
+	}
+	return u.user.Email
+}
+
+func (u passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// BeginPasskeyRegistration starts adding a passkey to the account. The returned options are
+// passed to navigator.credentials.create and the token identifies the challenge in the finish step.
+// Callers check ReauthenticatePasskeyChange first, the finish step only accepts this challenge.
+func BeginPasskeyRegistration(ctx context.Context, user db.User) (*protocol.CredentialCreation, string, error) {
+	pu, err := loadPasskeyUser(ctx, user)
+	if err != nil {
+		return nil, "", err
+	}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(pu.credentials))
+	for _, cred := range pu.credentials {
+		exclusions = append(exclusions, cred.Descriptor())
+	}
+	creation, session, err := auth.WebAuthn().BeginRegistration(pu, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := storePasskeySession(ctx, user.ID, passkeyRegister, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, token, nil
+}
+
+// FinishPasskeyRegistration verifies the attestation in body and stores the new credential
+func FinishPasskeyRegistration(ctx context.Context, user db.User, token, name string, body io.Reader) (db.WebauthnCredential, error) {
+	session, err := consumePasskeySession(ctx, token, passkeyRegister, user.ID)
+	if err != nil {
+		return db.WebauthnCredential{}, err
+	}
+	pu, err := loadPasskeyUser(ctx, user)
+	if err != nil {
+		return db.WebauthnCredential{}, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return db.WebauthnCredential{}, errors.Join(ErrPasskeyInvalid, err)
+	}
+	cred, err := auth.WebAuthn().CreateCredential(pu, session, parsed)
+	if err != nil {
+		return db.WebauthnCredential{}, errors.Join(ErrPasskeyInvalid, err)
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return db.WebauthnCredential{}, err
+	}
+	if name == "" {
+		name = "Passkey"
+	}
+	stored := db.WebauthnCredential{
+		ID:           uuid.New().String(),
+		UserID:       user.ID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(cred.ID),
+		Credential:   string(data),
+		Name:         name,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := db.Get().CreateWebAuthnCredential(ctx, db.CreateWebAuthnCredentialParams{
+		ID:           stored.ID,
+		UserID:       stored.UserID,
+		CredentialID: stored.CredentialID,
+		Credential:   stored.Credential,
+		Name:         stored.Name,
+		CreatedAt:    stored.CreatedAt,
+	}); err != nil {
+		return db.WebauthnCredential{}, err
+	}
+	logger.Info(ctx, fmt.Sprintf("passkey %s registered for user %s", stored.ID, user.ID))
+	return stored, nil
+}
+
+// BeginPasskeyLogin starts a passwordless login where the authenticator picks the account
+func BeginPasskeyLogin(ctx context.Context) (*protocol.CredentialAssertion, string, error) {
+	assertion, session, err := auth.WebAuthn().BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := storePasskeySession(ctx, "", passkeyLogin, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, token, nil
+}
+
+// FinishPasskeyLogin verifies a passwordless assertion and returns the user it belongs to
+func FinishPasskeyLogin(ctx context.Context, token string, body io.Reader) (db.User, error) {
+	session, err := consumePasskeySession(ctx, token, passkeyLogin, "")
+	if err != nil {
+		return db.User{}, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return db.User{}, errors.Join(ErrPasskeyInvalid, err)
+	}
+
+	var owner db.User
+	findUser := func(_, userHandle []byte) (webauthn.User, error) {
+		user, err := db.Get().GetUserByID(ctx, string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		owner = user
+		return loadPasskeyUser(ctx, user)
+	}
+	cred, err := auth.WebAuthn().ValidateDiscoverableLogin(findUser, session, parsed)
+	if err != nil {
+		return db.User{}, errors.Join(ErrPasskeyInvalid, err)
+	}
+	if err := updatePasskeyUsage(ctx, cred); err != nil {
+		return db.User{}, err
+	}
+	return owner, nil
+}
+
+// BeginPasskeySecondFactor challenges one of the user's passkeys after a password login
+func BeginPasskeySecondFactor(ctx context.Context, user db.User) (*protocol.CredentialAssertion, string, error) {
+	return beginPasskeyAssertion(ctx, user, passkeyMFA)
+}
+
+// FinishPasskeySecondFactor verifies the assertion for the user's second factor
+func FinishPasskeySecondFactor(ctx context.Context, user db.User, token string, body io.Reader) error {
+	return finishPasskeyAssertion(ctx, user, token, passkeyMFA, body)
+}
+
+// BeginPasskeyReauth challenges one of the user's passkeys to confirm a change to their passkeys
+func BeginPasskeyReauth(ctx context.Context, user db.User) (*protocol.CredentialAssertion, string, error) {
+	return beginPasskeyAssertion(ctx, user, passkeyReauth)
+}
+
+// ReauthenticatePasskeyChange checks that the user is present before a passkey is added or removed.
+// A fresh passkey assertion is always enough. Otherwise the account's strongest factor is asked:
+// password and OTP with TOTP enabled, a passkey when passkeys are the second factor and the
+// password when there is no second factor. OAuth accounts without any of them have nothing to prove.
+func ReauthenticatePasskeyChange(ctx context.Context, user db.User, reauth PasskeyReauth) error {
+	if len(reauth.Assertion) > 0 {
+		return finishPasskeyAssertion(ctx, user, reauth.Token, passkeyReauth, bytes.NewReader(reauth.Assertion))
+	}
+	if user.Secret != "" {
+		return ReauthenticateTwoFactor(ctx, user, reauth.Password, reauth.OTPCode)
+	}
+	creds, err := db.Get().ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if len(creds) > 0 {
+		return ErrPasskeyReauthRequired
+	}
+	if user.PasswordHash != "" && !auth.CheckPasswordHash(reauth.Password, user.PasswordHash) {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// ListPasskeys returns the passkeys registered by the user
+func ListPasskeys(ctx context.Context, userID string) ([]db.WebauthnCredential, error) {
+	return db.Get().ListWebAuthnCredentials(ctx, userID)
+}
+
+// DeletePasskey removes one of the user's passkeys, sql.ErrNoRows if it isn't theirs.
+// Callers check ReauthenticatePasskeyChange first.
+func DeletePasskey(ctx context.Context, userID, id string) error {
+	rows, err := db.Get().DeleteWebAuthnCredential(ctx, db.DeleteWebAuthnCredentialParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PurgeExpiredPasskeySessions deletes challenges that were never answered
+func PurgeExpiredPasskeySessions(ctx context.Context) error {
+	return db.Get().DeleteExpiredWebAuthnSessions(ctx, time.Now().UTC())
+}
+
+// loadPasskeyUser reads the user's stored credentials
+func loadPasskeyUser(ctx context.Context, user db.User) (passkeyUser, error) {
+	rows, err := db.Get().ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return passkeyUser{}, err
+	}
+	pu := passkeyUser{user: user, credentials: make([]webauthn.Credential, 0, len(rows))}
+	for _, row := range rows {
+		var cred webauthn.Credential
+		if err := json.Unmarshal([]byte(row.Credential), &cred); err != nil {
+			return passkeyUser{}, fmt.Errorf("passkey %s: %w", row.ID, err)
+		}
+		pu.credentials = append(pu.credentials, cred)
+	}
+	return pu, nil
+}
+
+// beginPasskeyAssertion challenges the passkeys of a known user for the given ceremony
+func beginPasskeyAssertion(ctx context.Context, user db.User, purpose string) (*protocol.CredentialAssertion, string, error) {
+	pu, err := loadPasskeyUser(ctx, user)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(pu.credentials) == 0 {
+		return nil, "", ErrNoPasskeys
+	}
+	assertion, session, err := auth.WebAuthn().BeginLogin(pu)
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := storePasskeySession(ctx, user.ID, purpose, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, token, nil
+}
+
+// finishPasskeyAssertion verifies an assertion against the challenge stored by beginPasskeyAssertion
+func finishPasskeyAssertion(ctx context.Context, user db.User, token, purpose string, body io.Reader) error {
+	session, err := consumePasskeySession(ctx, token, purpose, user.ID)
+	if err != nil {
+		return err
+	}
+	pu, err := loadPasskeyUser(ctx, user)
+	if err != nil {
+		return err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return errors.Join(ErrPasskeyInvalid, err)
+	}
+	cred, err := auth.WebAuthn().ValidateLogin(pu, session, parsed)
+	if err != nil {
+		return errors.Join(ErrPasskeyInvalid, err)
+	}
+	return updatePasskeyUsage(ctx, cred)
+}
+
+// updatePasskeyUsage stores the new sign count and flags after a successful assertion
+func updatePasskeyUsage(ctx context.Context, cred *webauthn.Credential) error {
+	credentialID := base64.RawURLEncoding.EncodeToString(cred.ID)
+	if cred.Authenticator.CloneWarning {
+		// The sign count went backwards, another copy of the key may be in use
+		logger.Warn(ctx, nil, "passkey sign count decreased, possible cloned authenticator "+credentialID)
+		return ErrPasskeyInvalid
+	}
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	return db.Get().UpdateWebAuthnCredentialUsage(ctx, db.UpdateWebAuthnCredentialUsageParams{
+		Credential:   string(data),
+		LastUsedAt:   sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		CredentialID: credentialID,
+	})
+}
+
+// storePasskeySession saves the challenge of a started ceremony and returns the token for its cookie
+func storePasskeySession(ctx context.Context, userID, purpose string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	if err := db.Get().CreateWebAuthnSession(ctx, db.CreateWebAuthnSessionParams{
+		ID:        auth.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Data:      string(data),
+		ExpiresAt: now.Add(passkeySessionTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumePasskeySession loads and deletes a stored challenge so every challenge is answered at most once
+func consumePasskeySession(ctx context.Context, token, purpose, userID string) (webauthn.SessionData, error) {
+	if token == "" {
+		return webauthn.SessionData{}, ErrPasskeySessionInvalid
+	}
+	row, err := db.Get().ConsumeWebAuthnSession(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return webauthn.SessionData{}, ErrPasskeySessionInvalid
+		}
+		return webauthn.SessionData{}, err
+	}
+	if row.Purpose != purpose || row.UserID != userID || time.Now().UTC().After(row.ExpiresAt) {
+		return webauthn.SessionData{}, ErrPasskeySessionInvalid
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(row.Data), &session); err != nil {
+		return webauthn.SessionData{}, err
+	}
+	return session, nil
+}
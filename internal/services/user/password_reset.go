@@ -0,0 +1,126 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+	"github.com/nikojunttila/community/internal/services/email"
+)
+
+// passwordResetTTL is how long an emailed reset link stays valid
+const passwordResetTTL = time.Hour
+
+// RequestPasswordReset emails a single-use reset link to a user with a password.
+// Unknown addresses and OAuth accounts without a password are silently ignored so the endpoint can't be used to probe for accounts.
+func RequestPasswordReset(ctx context.Context, emailAddress string) error {
+	user, err := db.Get().GetUserByEmail(ctx, emailAddress)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if user.PasswordHash == "" {
+		logger.Info(ctx, fmt.Sprintf("password reset requested for account %s without a password", user.ID))
+		return nil
+	}
+
+	// Only the most recent link should work
+	if err := db.Get().InvalidateUserPasswordResetTokens(ctx, user.ID); err != nil {
+		return err
+	}
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if _, err := db.Get().CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: now.Add(passwordResetTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/public/reset_password?token=%s", email.Mailer.BaseURL, url.QueryEscape(token))
+	html := fmt.Sprintf(`<p>Someone requested a password reset for your account.</p>
+<p><a href="%s">Reset your password</a></p>
+<p>The link expires in one hour. If you did not request this you can ignore this email.</p>`, link)
+	text := fmt.Sprintf("Someone requested a password reset for your account.\n\nReset your password: %s\n\nThe link expires in one hour. If you did not request this you can ignore this email.", link)
+
+	// Send in the background so response time doesn't reveal whether the account exists
+	go func() {
+		if err := email.Mailer.Send(context.Background(), "", user.Email, "Reset your password", html, text); err != nil {
+			logger.Error(ctx, err, fmt.Sprintf("Failed to send password reset email to user %s", user.ID))
+		}
+	}()
+	return nil
+}
+
+// ResetPassword consumes a reset token, stores the new password hash, signs the user out everywhere
+// and revokes their personal access tokens. The new password has to pass the password policy.
+func ResetPassword(ctx context.Context, token, newPassword string) (db.User, error) {
+	stored, err := db.Get().GetPasswordResetTokenByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.User{}, ErrResetTokenInvalid
+		}
+		return db.User{}, err
+	}
+	if stored.UsedAt.Valid || time.Now().UTC().After(stored.ExpiresAt) {
+		return db.User{}, ErrResetTokenInvalid
+	}
+
+	user, err := db.Get().GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		return db.User{}, err
+	}
+	// A rejected password leaves the token usable for another try
+	if err := auth.CheckPassword(ctx, newPassword, user.Email); err != nil {
+		return db.User{}, err
+	}
+
+	// Claim the token before changing anything so two concurrent requests can't both use it
+	claimed, err := db.Get().MarkPasswordResetTokenUsed(ctx, stored.ID)
+	if err != nil {
+		return db.User{}, err
+	}
+	if claimed == 0 {
+		return db.User{}, ErrResetTokenInvalid
+	}
+	passHash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return db.User{}, err
+	}
+	if err := db.Get().UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		PasswordHash: passHash,
+		UpdatedAt:    time.Now(),
+		ID:           user.ID,
+	}); err != nil {
+		return db.User{}, err
+	}
+	// The cached user still has the old hash, which reauthentication checks against
+	cache.RemoveUser(user.LookupID)
+
+	if err := auth.RevokeAllUserSessions(ctx, user.ID); err != nil {
+		return db.User{}, fmt.Errorf("password changed but failed to revoke sessions and tokens: %w", err)
+	}
+	logger.Info(ctx, fmt.Sprintf("password reset for user %s", user.ID))
+	return user, nil
+}
+
+// PurgeExpiredPasswordResetTokens removes reset tokens that can no longer be used
+func PurgeExpiredPasswordResetTokens(ctx context.Context) error {
+	return db.Get().DeleteExpiredPasswordResetTokens(ctx, time.Now().UTC())
+}
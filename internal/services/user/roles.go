@@ -0,0 +1,146 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// AssignRole changes the user's role. The admin has to outrank the user, and can only hand out
+// their own role or one it inherits from. The cached user is evicted, so permissions the new role
+// lacks are refused on the next request. Access tokens keep the old role claim until they are
+// refreshed, RequirePermission checks the current role too.
+func AssignRole(ctx context.Context, adminID, userID, role string) (db.User, error) {
+	if adminID == userID {
+		return db.User{}, ErrCannotChangeOwnRole
+	}
+	roles, err := auth.Roles(ctx)
+	if err != nil {
+		return db.User{}, err
+	}
+	if !roles.Exists(role) {
+		return db.User{}, ErrInvalidRole
+	}
+	user, err := db.Get().GetUserByID(ctx, userID)
+	if err != nil {
+		return db.User{}, err
+	}
+	admin, err := checkOutranks(ctx, adminID, user, ErrCannotChangeStaffRole)
+	if err != nil {
+		return db.User{}, err
+	}
+	if !roles.Inherits(admin.Role, role) {
+		return db.User{}, ErrRoleAboveOwn
+	}
+	if err := db.Get().UpdateUserRole(ctx, db.UpdateUserRoleParams{
+		Role:      role,
+		UpdatedAt: time.Now(),
+		ID:        user.ID,
+	}); err != nil {
+		return db.User{}, err
+	}
+	cache.RemoveUser(user.LookupID)
+
+	logger.Info(ctx, fmt.Sprintf("user %s role changed from %s to %s by %s", user.ID, user.Role, role, adminID))
+	user.Role = role
+	return user, nil
+}
+
+// CreateRole adds a role that inherits the permissions of parentRole, empty for none
+func CreateRole(ctx context.Context, name, description, parentRole string) (db.Role, error) {
+	if !roleNamePattern.MatchString(name) {
+		return db.Role{}, ErrInvalidRole
+	}
+	if _, err := db.Get().GetRole(ctx, name); err == nil {
+		return db.Role{}, ErrRoleExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return db.Role{}, err
+	}
+	if parentRole != "" {
+		if _, err := db.Get().GetRole(ctx, parentRole); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return db.Role{}, ErrInvalidRole
+			}
+			return db.Role{}, err
+		}
+	}
+	role := db.Role{
+		Name:        name,
+		Description: description,
+		ParentRole:  parentRole,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := db.Get().CreateRole(ctx, db.CreateRoleParams{
+		Name:        role.Name,
+		Description: role.Description,
+		ParentRole:  role.ParentRole,
+		CreatedAt:   role.CreatedAt,
+	}); err != nil {
+		return db.Role{}, err
+	}
+	auth.InvalidatePermissions()
+	logger.Info(ctx, fmt.Sprintf("role %s created", name))
+	return role, nil
+}
+
+// SetRolePermissions replaces the permissions granted directly to the role and returns
+// the permissions it ends up with, inherited ones included.
+func SetRolePermissions(ctx context.Context, role string, permissions []string) ([]string, error) {
+	if _, err := db.Get().GetRole(ctx, role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidRole
+		}
+		return nil, err
+	}
+	for _, permission := range permissions {
+		if !auth.ValidPermission(permission) {
+			return nil, ErrInvalidPermission
+		}
+	}
+	err := replaceRolePermissions(ctx, role, permissions)
+	// Invalidate even when the write failed, and before reading the permissions back
+	auth.InvalidatePermissions()
+	if err != nil {
+		return nil, err
+	}
+	logger.Info(ctx, fmt.Sprintf("permissions of role %s set to %v", role, permissions))
+	return auth.RolePermissions(ctx, role)
+}
+
+// replaceRolePermissions swaps the role's permissions in one transaction, so a failure
+// leaves the old set in place
+func replaceRolePermissions(ctx context.Context, role string, permissions []string) error {
+	tx, err := db.Conn().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+	q := db.Get().WithTx(tx)
+	if err := q.DeleteRolePermissions(ctx, role); err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if err := q.AddRolePermission(ctx, db.AddRolePermissionParams{
+			Role:       role,
+			Permission: permission,
+		}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListRoles returns every role ordered by name
+func ListRoles(ctx context.Context) ([]db.Role, error) {
+	return db.Get().ListRoles(ctx)
+}
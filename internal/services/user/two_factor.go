@@ -0,0 +1,182 @@
+package userservice
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/logger"
+)
+
+// RecoveryCodeCount is how many recovery codes a user gets per generation
+const RecoveryCodeCount = 10
+
+// recoveryCodeAlphabet is the base32 alphabet, it has no 0 or 1 to mix up with o and l when typed from paper
+const recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+// GenerateRecoveryCodes replaces all recovery codes of the user with a fresh set.
+// The plaintext codes are returned once and only their hashes are stored.
+func GenerateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	if err := db.Get().DeleteUserRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, RecoveryCodeCount)
+	for range RecoveryCodeCount {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Get().CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			CodeHash:  auth.HashToken(normalizeRecoveryCode(code)),
+			CreatedAt: time.Now().UTC(),
+		}); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// RedeemRecoveryCode consumes one unused recovery code of the user
+func RedeemRecoveryCode(ctx context.Context, userID, code string) error {
+	// Recovery codes share the attempt counter and lockout of the OTP
+	attempt, err := claimOTPAttempt(ctx, userID)
+	if err != nil {
+		return err
+	}
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return otpFailure(ctx, userID, attempt, ErrRecoveryCodeInvalid)
+	}
+	rows, err := db.Get().UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+		UserID:   userID,
+		CodeHash: auth.HashToken(code),
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return otpFailure(ctx, userID, attempt, ErrRecoveryCodeInvalid)
+	}
+	if err := db.Get().ResetOTPFailures(ctx, db.ResetOTPFailuresParams{
+		UpdatedAt: time.Now().UTC(),
+		UserID:    userID,
+	}); err != nil {
+		return err
+	}
+	remaining, err := db.Get().CountUnusedRecoveryCodes(ctx, userID)
+	if err == nil && remaining <= 2 {
+		logger.Warn(ctx, nil, fmt.Sprintf("user %s has %d recovery codes left", userID, remaining))
+	}
+	return nil
+}
+
+// ReauthenticateTwoFactor checks the password (for accounts that have one) and a current OTP
+// before sensitive changes to the second factor
+func ReauthenticateTwoFactor(ctx context.Context, user db.User, password, otpCode string) error {
+	if user.Secret == "" {
+		return ErrTwoFactorNotEnabled
+	}
+	if user.PasswordHash != "" && !auth.CheckPasswordHash(password, user.PasswordHash) {
+		return ErrWrongPassword
+	}
+	return ValidateTOTP(ctx, user, otpCode)
+}
+
+// DisableTwoFactor removes the TOTP secret, recovery codes and OTP lockout of the user
+func DisableTwoFactor(ctx context.Context, user db.User) error {
+	if err := db.Get().UpdateUserSecret(ctx, db.UpdateUserSecretParams{
+		Secret: "",
+		ID:     user.ID,
+	}); err != nil {
+		return err
+	}
+	if err := db.Get().DeleteUserRecoveryCodes(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := db.Get().DeleteOTPState(ctx, user.ID); err != nil {
+		return err
+	}
+	cache.RemoveUser(user.LookupID)
+	logger.Info(ctx, fmt.Sprintf("two-factor authentication disabled for user %s", user.ID))
+	return nil
+}
+
+// ResetTwoFactor lets an admin remove the second factor of a user who lost their device.
+// Existing sessions are revoked so the user has to log in and enroll again.
+func ResetTwoFactor(ctx context.Context, adminID, userID string) (db.User, error) {
+	user, err := db.Get().GetUserByID(ctx, userID)
+	if err != nil {
+		return db.User{}, err
+	}
+	if err := DisableTwoFactor(ctx, user); err != nil {
+		return db.User{}, err
+	}
+	if err := auth.RevokeAllUserSessions(ctx, user.ID); err != nil {
+		return db.User{}, fmt.Errorf("two-factor reset but failed to revoke sessions: %w", err)
+	}
+
+	user.Secret = ""
+	logger.Info(ctx, fmt.Sprintf("two-factor authentication of user %s reset by %s", user.ID, adminID))
+	return user, nil
+}
+
+// generateRecoveryCode returns a random code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)] // 256 is a multiple of 32, no modulo bias
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+// normalizeRecoveryCode makes codes comparable regardless of case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// ResealTOTPSecrets encrypts stored TOTP secrets with the active key. With rotate false only
+// legacy plaintext secrets are sealed, with rotate true secrets sealed under an older key are
+// re-encrypted as well. It returns how many rows were updated.
+func ResealTOTPSecrets(ctx context.Context, rotate bool) (int, error) {
+	rows, err := db.Get().ListUserSecrets(ctx)
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, row := range rows {
+		if auth.IsSealedWithActiveKey(row.Secret) || (auth.IsSealed(row.Secret) && !rotate) {
+			continue
+		}
+		secret, err := auth.OpenSecret(row.ID, row.Secret)
+		if err != nil {
+			return updated, fmt.Errorf("user %s: %w", row.ID, err)
+		}
+		sealed, err := auth.SealSecret(row.ID, secret)
+		if err != nil {
+			return updated, err
+		}
+		n, err := db.Get().ReplaceUserSecret(ctx, db.ReplaceUserSecretParams{
+			Secret:   sealed,
+			ID:       row.ID,
+			Secret_2: row.Secret,
+		})
+		if err != nil {
+			return updated, err
+		}
+		updated += int(n)
+	}
+	return updated, nil
+}
@@ -15,6 +15,9 @@ const (
 
 	// Discord represents authentication via Discord OAuth.
 	Discord AuthServiceEnum = "discord"
+
+	// GitHub represents authentication via GitHub OAuth.
+	GitHub AuthServiceEnum = "github"
 )
 
 // ErrUserAlreadyExists indicates that the user already exists.
@@ -32,6 +35,86 @@ var ErrWrongPassword = errors.New("wrong password")
 // ErrTooWeakPassword indicates that the provided password does not meet strength requirements.
 var ErrTooWeakPassword = errors.New("weak password")
 
+// ErrResetTokenInvalid indicates the password reset token is unknown, already used or expired.
+var ErrResetTokenInvalid = errors.New("password reset token is invalid or expired")
+
+// ErrEmailNotVerified indicates the user has to verify their email address before logging in.
+var ErrEmailNotVerified = errors.New("email address not verified")
+
+// ErrVerificationTokenInvalid indicates the email verification token is unknown, already used or expired.
+var ErrVerificationTokenInvalid = errors.New("email verification token is invalid or expired")
+
+// ErrVerificationThrottled indicates too many verification emails were requested recently.
+var ErrVerificationThrottled = errors.New("too many verification emails requested")
+
+// ErrCannotSuspendSelf indicates an admin tried to suspend their own account.
+var ErrCannotSuspendSelf = errors.New("admins cannot suspend themselves")
+
+// ErrCannotSuspendStaff indicates the target's role is the same as or above the role of the
+// staff member trying to suspend or unsuspend them.
+var ErrCannotSuspendStaff = errors.New("cannot suspend or unsuspend a user with an equal or higher role")
+
+// ErrRecoveryCodeInvalid indicates the recovery code is unknown or already used.
+var ErrRecoveryCodeInvalid = errors.New("recovery code is invalid or already used")
+
+// ErrOTPInvalid indicates the submitted one-time password did not validate.
+var ErrOTPInvalid = errors.New("invalid one-time password")
+
+// ErrOTPReplayed indicates the one-time password of an already used time step was submitted again.
+var ErrOTPReplayed = errors.New("one-time password already used")
+
+// ErrOTPLocked indicates too many failed second factor attempts, further attempts are rejected for a while.
+var ErrOTPLocked = errors.New("too many failed attempts, try again later")
+
+// ErrTwoFactorNotEnabled indicates the user has no second factor enrolled.
+var ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+
+// ErrLoginThrottled indicates too many failed logins for the account or from the client ip, the login is rejected for a while.
+var ErrLoginThrottled = errors.New("too many failed login attempts, try again later")
+
+// ErrPasskeyInvalid indicates a passkey response failed verification.
+var ErrPasskeyInvalid = errors.New("passkey verification failed")
+
+// ErrPasskeySessionInvalid indicates the passkey challenge is unknown, already answered or expired.
+var ErrPasskeySessionInvalid = errors.New("passkey challenge is invalid or expired")
+
+// ErrNoPasskeys indicates the user has no passkeys registered.
+var ErrNoPasskeys = errors.New("no passkeys registered")
+
+// ErrPasskeyReauthRequired indicates the account's passkeys are its second factor, so changing them needs one of them.
+var ErrPasskeyReauthRequired = errors.New("confirm with one of your passkeys")
+
+// ErrIdentityNotLinked indicates an account with the provider's email exists but the address isn't verified on both sides,
+// the user has to log in and link the provider from their account instead.
+var ErrIdentityNotLinked = errors.New("an account with this email already exists, log in and link the provider from your account")
+
+// ErrIdentityInUse indicates the provider account is already linked to another user.
+var ErrIdentityInUse = errors.New("this provider account is linked to another user")
+
+// ErrProviderAlreadyLinked indicates the user already linked a different account of the same provider.
+var ErrProviderAlreadyLinked = errors.New("another account of this provider is already linked")
+
+// ErrLastLoginMethod indicates unlinking would leave the user without any way to log in.
+var ErrLastLoginMethod = errors.New("set a password or link another login method first")
+
+// ErrCannotChangeOwnRole indicates an admin tried to change their own role.
+var ErrCannotChangeOwnRole = errors.New("admins cannot change their own role")
+
+// ErrCannotChangeStaffRole indicates the target's role is the same as or above the role of the admin changing it.
+var ErrCannotChangeStaffRole = errors.New("cannot change the role of a user with an equal or higher role")
+
+// ErrRoleAboveOwn indicates the admin tried to assign a role that their own role doesn't include.
+var ErrRoleAboveOwn = errors.New("cannot assign a role above your own")
+
+// ErrInvalidRole indicates the role name or parent role is malformed or unknown.
+var ErrInvalidRole = errors.New("invalid role")
+
+// ErrInvalidPermission indicates a permission isn't in the resource:action form.
+var ErrInvalidPermission = errors.New("invalid permission, expected resource:action")
+
+// ErrRoleExists indicates a role with the name already exists.
+var ErrRoleExists = errors.New("role already exists")
+
 // GetServiceEnumName returns the given AuthServiceEnum as-is.
 // Useful for type safety or validation logic.
 func GetServiceEnumName(service AuthServiceEnum) AuthServiceEnum {
@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
 	"github.com/nikojunttila/community/internal/db"
 	"github.com/nikojunttila/community/internal/logger"
 )
@@ -67,3 +69,26 @@ func CreateUser(ctx context.Context, password string, params CreateUserParams, o
 
 	return newUser, nil
 }
+
+// UpgradePasswordHash rehashes the password the user just logged in with when the stored hash
+// is bcrypt or uses outdated argon2id parameters. Failing to do so doesn't fail the login.
+func UpgradePasswordHash(ctx context.Context, user db.User, password string) {
+	if !auth.PasswordNeedsRehash(user.PasswordHash) {
+		return
+	}
+	passHash, err := auth.HashPassword(password)
+	if err != nil {
+		logger.Warn(ctx, err, "failed to rehash password")
+		return
+	}
+	if err := db.Get().UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		PasswordHash: passHash,
+		UpdatedAt:    time.Now(),
+		ID:           user.ID,
+	}); err != nil {
+		logger.Warn(ctx, err, "failed to store rehashed password")
+		return
+	}
+	cache.RemoveUser(user.LookupID)
+	logger.Info(ctx, fmt.Sprintf("upgraded password hash of user %s", user.ID))
+}
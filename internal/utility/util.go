@@ -18,3 +18,11 @@ func GetEnv(name string) string {
 	}
 	return value
 }
+
+// GetEnvDefault returns the value from env or fallback when it is not set
+func GetEnvDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -14,11 +14,31 @@ INSERT INTO admin_audit_logs (
     status_code,
     response_time_ms,
     timestamp,
-    request_id
+    request_id,
+    impersonated_user_id,
+    prev_hash,
+    hash,
+    request_headers
 ) VALUES (
-    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
 ) RETURNING *;
 
+-- name: GetLastAuditLogHash :one
+SELECT id, hash FROM admin_audit_logs
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: ListAuditLogsAfter :many
+-- The chain in write order, for verification
+SELECT * FROM admin_audit_logs
+WHERE id > ?
+ORDER BY id
+LIMIT ?;
+
+-- name: CountChainedAuditLogs :one
+SELECT COUNT(*) FROM admin_audit_logs
+WHERE hash != '' AND id <= ?;
+
 -- name: GetAuditLogByID :one
 SELECT * FROM admin_audit_logs 
 WHERE id = ?;
@@ -158,6 +178,11 @@ SELECT * FROM admin_audit_logs
 ORDER BY timestamp DESC
 LIMIT ? OFFSET ?;
 
+-- name: DeleteAuditLogsThrough :execrows
+-- Deletes the oldest logs up to an id, so the rest of the chain stays verifiable
+DELETE FROM admin_audit_logs
+WHERE id <= ?;
+
 -- name: DeleteOldAuditLogs :exec
 DELETE FROM admin_audit_logs 
 WHERE timestamp < ?;
@@ -195,3 +220,29 @@ WHERE action = 'VIEW'
   AND timestamp BETWEEN ? AND ?
 ORDER BY timestamp DESC
 LIMIT ?;
+
+-- name: ListAuditLogs :many
+-- Newest first. cursor is the id of the last log of the previous page, 0 for the first page.
+-- Empty filters match everything, search matches parts of the email, ids, action, resource and path.
+-- search is a LIKE pattern, the caller escapes % and _ with a backslash to match them literally.
+SELECT * FROM admin_audit_logs
+WHERE (sqlc.arg(cursor) = 0 OR id < sqlc.arg(cursor))
+  AND (sqlc.arg(admin_user_id) = '' OR admin_user_id = sqlc.arg(admin_user_id))
+  AND (sqlc.arg(target_user_id) = '' OR target_user_id = sqlc.arg(target_user_id))
+  AND (sqlc.arg(action) = '' OR action = sqlc.arg(action))
+  AND (sqlc.arg(resource) = '' OR resource = sqlc.arg(resource))
+  AND (sqlc.arg(status_code) = 0 OR status_code = sqlc.arg(status_code))
+  AND timestamp >= sqlc.arg(since)
+  AND timestamp < sqlc.arg(until)
+  AND (
+    sqlc.arg(search) = '' OR
+    admin_email LIKE '%' || sqlc.arg(search) || '%' ESCAPE '\' OR
+    admin_user_id LIKE '%' || sqlc.arg(search) || '%' ESCAPE '\' OR
+    target_user_id LIKE '%' || sqlc.arg(search) || '%' ESCAPE '\' OR
+    impersonated_user_id LIKE '%' || sqlc.arg(search) || '%' ESCAPE '\' OR
+    action LIKE '%' || sqlc.arg(search) || '%' ESCAPE '\' OR
+    resource LIKE '%' || sqlc.arg(search) || '%' ESCAPE '\' OR
+    path LIKE '%' || sqlc.arg(search) || '%' ESCAPE '\'
+  )
+ORDER BY id DESC
+LIMIT sqlc.arg(page_size);
@@ -0,0 +1,28 @@
+-- name: CreateAuditArchive :one
+INSERT INTO audit_archives (
+    file, manifest, sha256, log_count, chained_count, first_log_id, last_log_id, last_hash, cutoff, created_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetLatestAuditArchive :one
+SELECT * FROM audit_archives
+ORDER BY last_log_id DESC
+LIMIT 1;
+
+-- name: ListAuditArchives :many
+SELECT * FROM audit_archives
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: SumArchivedChainedAuditLogs :one
+SELECT CAST(COALESCE(SUM(chained_count), 0) AS INTEGER) FROM audit_archives;
+
+-- name: CreateAuditArchiveRun :exec
+INSERT INTO audit_archive_runs (
+    started_at, finished_at, cutoff, archived, file, manifest, error
+) VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetLatestAuditArchiveRun :one
+SELECT * FROM audit_archive_runs
+ORDER BY id DESC
+LIMIT 1;
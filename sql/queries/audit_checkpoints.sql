@@ -0,0 +1,13 @@
+-- name: CreateAuditCheckpoint :one
+INSERT INTO audit_checkpoints (last_log_id, last_hash, log_count, key_id, signature, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetLatestAuditCheckpoint :one
+SELECT * FROM audit_checkpoints
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: ListAuditCheckpoints :many
+SELECT * FROM audit_checkpoints
+ORDER BY id;
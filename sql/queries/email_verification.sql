@@ -0,0 +1,32 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (
+  id,
+  user_id,
+  token_hash,
+  expires_at,
+  created_at
+) VALUES (
+  ?, ?, ?, ?, ?
+) RETURNING *;
+
+-- name: GetEmailVerificationTokenByHash :one
+SELECT * FROM email_verification_tokens
+WHERE token_hash = ?;
+
+-- name: MarkEmailVerificationTokenUsed :execrows
+UPDATE email_verification_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND used_at IS NULL;
+
+-- name: InvalidateUserEmailVerificationTokens :exec
+UPDATE email_verification_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND used_at IS NULL;
+
+-- name: CountEmailVerificationTokensSince :one
+SELECT COUNT(*) FROM email_verification_tokens
+WHERE user_id = ? AND created_at > ?;
+
+-- name: DeleteExpiredEmailVerificationTokens :exec
+DELETE FROM email_verification_tokens
+WHERE expires_at < ?;
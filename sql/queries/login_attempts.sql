@@ -0,0 +1,37 @@
+-- name: GetLoginAttempt :one
+SELECT * FROM login_attempts
+WHERE scope = ? AND subject = ?;
+
+-- name: RecordLoginFailure :one
+-- Failures older than the window start a new count
+INSERT INTO login_attempts (
+  scope,
+  subject,
+  failed_attempts,
+  last_failed_at,
+  updated_at
+) VALUES (
+  ?, ?, 1, ?, ?
+) ON CONFLICT(scope, subject) DO UPDATE SET
+  failed_attempts = CASE WHEN login_attempts.last_failed_at < ? THEN 1 ELSE login_attempts.failed_attempts + 1 END,
+  last_failed_at = excluded.last_failed_at,
+  updated_at = excluded.updated_at
+RETURNING failed_attempts;
+
+-- name: LockLoginAttempt :exec
+UPDATE login_attempts
+SET locked_until = ?, updated_at = ?
+WHERE scope = ? AND subject = ?;
+
+-- name: DeleteLoginAttempt :execrows
+DELETE FROM login_attempts
+WHERE scope = ? AND subject = ?;
+
+-- name: ListLockedLoginAttempts :many
+SELECT * FROM login_attempts
+WHERE locked_until > ?
+ORDER BY locked_until DESC;
+
+-- name: DeleteStaleLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE (locked_until IS NULL OR locked_until < ?) AND last_failed_at < ?;
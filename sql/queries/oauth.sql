@@ -0,0 +1,88 @@
+-- name: CreateOAuthClient :exec
+INSERT INTO oauth_clients (
+  id,
+  name,
+  secret_hash,
+  redirect_uris,
+  scopes,
+  created_by,
+  created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?
+);
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = ?;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = ?;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+  code_hash,
+  client_id,
+  user_id,
+  redirect_uri,
+  scope,
+  nonce,
+  code_challenge,
+  amr,
+  expires_at,
+  created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+-- Deleting on read makes every code single use
+DELETE FROM oauth_authorization_codes
+WHERE code_hash = ?
+RETURNING *;
+
+-- name: CreateOAuthAccessToken :exec
+INSERT INTO oauth_access_tokens (
+  token_hash,
+  client_id,
+  user_id,
+  scope,
+  expires_at,
+  created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?
+);
+
+-- name: GetOAuthAccessToken :one
+-- Tokens of deleted clients are not returned even when foreign keys aren't enforced
+SELECT oauth_access_tokens.* FROM oauth_access_tokens
+JOIN oauth_clients ON oauth_clients.id = oauth_access_tokens.client_id
+WHERE oauth_access_tokens.token_hash = ?;
+
+-- name: GetOAuthConsent :one
+SELECT * FROM oauth_consents
+WHERE user_id = ? AND client_id = ?;
+
+-- name: UpsertOAuthConsent :exec
+INSERT INTO oauth_consents (
+  user_id,
+  client_id,
+  scope,
+  created_at
+) VALUES (
+  ?, ?, ?, ?
+) ON CONFLICT(user_id, client_id) DO UPDATE SET
+  scope = excluded.scope,
+  created_at = excluded.created_at;
+
+-- name: DeleteExpiredOAuthAuthorizationCodes :exec
+DELETE FROM oauth_authorization_codes
+WHERE expires_at < ?;
+
+-- name: DeleteExpiredOAuthAccessTokens :exec
+DELETE FROM oauth_access_tokens
+WHERE expires_at < ?;
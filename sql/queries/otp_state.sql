@@ -0,0 +1,37 @@
+-- name: EnsureOTPState :exec
+INSERT INTO user_otp_state (
+  user_id,
+  updated_at
+) VALUES (
+  ?, ?
+) ON CONFLICT(user_id) DO NOTHING;
+
+-- name: GetOTPState :one
+SELECT * FROM user_otp_state
+WHERE user_id = ?;
+
+-- name: MarkOTPStepUsed :execrows
+UPDATE user_otp_state
+SET last_used_step = ?, failed_attempts = 0, locked_until = NULL, updated_at = ?
+WHERE user_id = ? AND last_used_step < ?;
+
+-- name: ClaimOTPAttempt :one
+-- Counts an attempt before the code is checked, no row is returned while locked
+UPDATE user_otp_state
+SET failed_attempts = failed_attempts + 1, updated_at = ?
+WHERE user_id = ? AND (locked_until IS NULL OR locked_until <= ?)
+RETURNING failed_attempts;
+
+-- name: ResetOTPFailures :exec
+UPDATE user_otp_state
+SET failed_attempts = 0, locked_until = NULL, updated_at = ?
+WHERE user_id = ?;
+
+-- name: LockOTP :exec
+UPDATE user_otp_state
+SET locked_until = ?, updated_at = ?
+WHERE user_id = ?;
+
+-- name: DeleteOTPState :exec
+DELETE FROM user_otp_state
+WHERE user_id = ?;
@@ -0,0 +1,28 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (
+  id,
+  user_id,
+  token_hash,
+  expires_at,
+  created_at
+) VALUES (
+  ?, ?, ?, ?, ?
+) RETURNING *;
+
+-- name: GetPasswordResetTokenByHash :one
+SELECT * FROM password_reset_tokens
+WHERE token_hash = ?;
+
+-- name: MarkPasswordResetTokenUsed :execrows
+UPDATE password_reset_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND used_at IS NULL;
+
+-- name: InvalidateUserPasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND used_at IS NULL;
+
+-- name: DeleteExpiredPasswordResetTokens :exec
+DELETE FROM password_reset_tokens
+WHERE expires_at < ?;
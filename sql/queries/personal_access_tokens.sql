@@ -0,0 +1,42 @@
+-- name: CreatePersonalAccessToken :exec
+INSERT INTO personal_access_tokens (
+  id,
+  user_id,
+  name,
+  token_prefix,
+  token_hash,
+  scopes,
+  expires_at,
+  created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?, ?
+);
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT * FROM personal_access_tokens
+WHERE token_hash = ? AND revoked_at IS NULL;
+
+-- name: ListPersonalAccessTokens :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = ? AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: TouchPersonalAccessToken :exec
+-- Only written once a minute so busy scripts don't turn every request into a write
+UPDATE personal_access_tokens
+SET last_used_at = ?
+WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?);
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET revoked_at = ?
+WHERE id = ? AND user_id = ? AND revoked_at IS NULL;
+
+-- name: RevokeUserPersonalAccessTokens :exec
+UPDATE personal_access_tokens
+SET revoked_at = ?
+WHERE user_id = ? AND revoked_at IS NULL;
+
+-- name: DeleteExpiredPersonalAccessTokens :exec
+DELETE FROM personal_access_tokens
+WHERE expires_at < ? OR revoked_at < ?;
@@ -0,0 +1,22 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (
+  id,
+  user_id,
+  code_hash,
+  created_at
+) VALUES (
+  ?, ?, ?, ?
+);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND code_hash = ? AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM recovery_codes
+WHERE user_id = ? AND used_at IS NULL;
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = ?;
@@ -0,0 +1,24 @@
+-- name: ListRoles :many
+SELECT * FROM roles
+ORDER BY name;
+
+-- name: GetRole :one
+SELECT * FROM roles
+WHERE name = ?;
+
+-- name: CreateRole :exec
+INSERT INTO roles (name, description, parent_role, created_at)
+VALUES (?, ?, ?, ?);
+
+-- name: ListRolePermissions :many
+SELECT * FROM role_permissions
+ORDER BY role, permission;
+
+-- name: AddRolePermission :exec
+INSERT INTO role_permissions (role, permission)
+VALUES (?, ?)
+ON CONFLICT (role, permission) DO NOTHING;
+
+-- name: DeleteRolePermissions :exec
+DELETE FROM role_permissions
+WHERE role = ?;
@@ -0,0 +1,43 @@
+-- name: UpsertSession :exec
+-- Refresh token rotation keeps the session id, only the newest token and location change
+INSERT INTO sessions (
+  id,
+  user_id,
+  current_jti,
+  user_agent,
+  ip_address,
+  created_at,
+  last_seen_at,
+  expires_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?, ?
+) ON CONFLICT(id) DO UPDATE SET
+  current_jti = excluded.current_jti,
+  user_agent = excluded.user_agent,
+  ip_address = excluded.ip_address,
+  last_seen_at = excluded.last_seen_at,
+  expires_at = excluded.expires_at;
+
+-- name: GetSession :one
+SELECT * FROM sessions
+WHERE id = ?;
+
+-- name: ListActiveSessions :many
+SELECT * FROM sessions
+WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+ORDER BY last_seen_at DESC;
+
+-- name: TouchSession :exec
+-- Only written once a minute so requests don't all turn into writes
+UPDATE sessions
+SET last_seen_at = ?, ip_address = ?
+WHERE id = ? AND last_seen_at < ?;
+
+-- name: MarkSessionRevoked :exec
+UPDATE sessions
+SET revoked_at = ?
+WHERE id = ? AND revoked_at IS NULL;
+
+-- name: DeleteExpiredSessions :exec
+DELETE FROM sessions
+WHERE expires_at < ? OR revoked_at < ?;
@@ -0,0 +1,55 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (
+  id,
+  user_id,
+  family_id,
+  token_hash,
+  expires_at,
+  amr,
+  created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?
+) RETURNING *;
+
+-- name: GetRefreshTokenByHash :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = ?;
+
+-- name: MarkRefreshTokenRotated :execrows
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP, replaced_by = ?
+WHERE id = ? AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE family_id = ? AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND revoked_at IS NULL;
+
+-- name: CountActiveRefreshTokensInFamily :one
+SELECT COUNT(*) FROM refresh_tokens
+WHERE family_id = ? AND revoked_at IS NULL AND expires_at > ?;
+
+-- name: DeleteExpiredRefreshTokens :exec
+DELETE FROM refresh_tokens
+WHERE expires_at < ?;
+
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_tokens (
+  jti,
+  expires_at
+) VALUES (
+  ?, ?
+) ON CONFLICT (jti) DO NOTHING;
+
+-- name: CountRevokedAccessTokens :one
+SELECT COUNT(*) FROM revoked_tokens
+WHERE jti = ?;
+
+-- name: DeleteExpiredRevokedTokens :exec
+DELETE FROM revoked_tokens
+WHERE expires_at < ?;
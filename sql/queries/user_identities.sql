@@ -0,0 +1,34 @@
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (
+  id,
+  user_id,
+  provider,
+  provider_user_id,
+  email,
+  created_at,
+  last_login_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?
+);
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = ? AND provider_user_id = ?;
+
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = ?
+ORDER BY created_at;
+
+-- name: CountUserIdentities :one
+SELECT COUNT(*) FROM user_identities
+WHERE user_id = ?;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET last_login_at = ?
+WHERE id = ?;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities
+WHERE user_id = ? AND provider = ?;
@@ -53,3 +53,30 @@ WHERE id = ?;
 -- name: UpdateUserSecret :exec
 -- #nosec G101 this is a parameterized query, no hardcoded credential
 UPDATE users SET secret = ? WHERE id = ?;
+
+-- name: UpdateUserPassword :exec
+UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?;
+
+-- name: SetUserEmailVerified :exec
+UPDATE users SET email_verified = ?, updated_at = ? WHERE id = ?;
+
+-- name: SuspendUser :exec
+UPDATE users
+SET disabled = TRUE, disabled_reason = ?, suspended_until = ?, updated_at = ?
+WHERE id = ?;
+
+-- name: UnsuspendUser :exec
+UPDATE users
+SET disabled = FALSE, disabled_reason = '', suspended_until = NULL, updated_at = ?
+WHERE id = ?;
+
+-- name: ListUserSecrets :many
+SELECT id, secret FROM users
+WHERE secret != '';
+
+-- name: ReplaceUserSecret :execrows
+-- only replaces the value that was read, so a concurrent enrollment isn't overwritten
+UPDATE users SET secret = ? WHERE id = ? AND secret = ?;
+
+-- name: UpdateUserRole :exec
+UPDATE users SET role = ?, updated_at = ? WHERE id = ?;
@@ -0,0 +1,50 @@
+-- name: CreateWebAuthnCredential :exec
+INSERT INTO webauthn_credentials (
+  id,
+  user_id,
+  credential_id,
+  credential,
+  name,
+  created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?
+);
+
+-- name: ListWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = ?
+ORDER BY created_at;
+
+-- name: CountWebAuthnCredentials :one
+SELECT COUNT(*) FROM webauthn_credentials
+WHERE user_id = ?;
+
+-- name: UpdateWebAuthnCredentialUsage :exec
+UPDATE webauthn_credentials
+SET credential = ?, last_used_at = ?
+WHERE credential_id = ?;
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = ? AND user_id = ?;
+
+-- name: CreateWebAuthnSession :exec
+INSERT INTO webauthn_sessions (
+  id,
+  user_id,
+  purpose,
+  data,
+  expires_at,
+  created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?
+);
+
+-- name: ConsumeWebAuthnSession :one
+DELETE FROM webauthn_sessions
+WHERE id = ?
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnSessions :exec
+DELETE FROM webauthn_sessions
+WHERE expires_at < ?;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN disabled_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN suspended_until DATETIME; -- NULL with disabled = TRUE means suspended indefinitely
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN suspended_until;
+ALTER TABLE users DROP COLUMN disabled_reason;
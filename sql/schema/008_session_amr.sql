@@ -0,0 +1,6 @@
+-- +goose Up
+-- space separated authentication methods (pwd, fed, otp) the session was established with
+ALTER TABLE refresh_tokens ADD COLUMN amr TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE refresh_tokens DROP COLUMN amr;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS user_otp_state (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_used_step INTEGER NOT NULL DEFAULT 0, -- unix time / 30 of the last accepted code, older or equal steps are replays
+    failed_attempts INTEGER NOT NULL DEFAULT 0, -- consecutive failures, reset on success
+    locked_until DATETIME, -- no codes are accepted before this time
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_otp_state;
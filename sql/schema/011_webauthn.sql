@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id TEXT UNIQUE NOT NULL, -- base64url of the id chosen by the authenticator
+    credential TEXT NOT NULL, -- JSON encoded credential with public key, flags and sign count
+    name TEXT NOT NULL DEFAULT '', -- label picked by the user
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+-- challenges of ceremonies in progress, consumed by the finish step
+CREATE TABLE IF NOT EXISTS webauthn_sessions (
+    id TEXT PRIMARY KEY, -- sha256 of the session cookie
+    user_id TEXT NOT NULL DEFAULT '', -- empty for passwordless login where the user isn't known yet
+    purpose TEXT NOT NULL, -- register, login or mfa
+    data TEXT NOT NULL, -- JSON encoded session data with the challenge
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS webauthn_sessions;
+DROP TABLE IF EXISTS webauthn_credentials;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope TEXT NOT NULL, -- 'account' for an email address, 'ip' for a client address
+    subject TEXT NOT NULL, -- the normalized email address or ip the failures are counted for
+    failed_attempts INTEGER NOT NULL DEFAULT 0, -- failures within the current window, an account resets on a successful login
+    last_failed_at DATETIME,
+    locked_until DATETIME, -- logins are rejected before this time
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_locked_until ON login_attempts(locked_until);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_login_attempts_locked_until;
+DROP TABLE IF EXISTS login_attempts;
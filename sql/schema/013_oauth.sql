@@ -0,0 +1,53 @@
+-- +goose Up
+-- Apps that log their users in through this service with OpenID Connect
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id TEXT PRIMARY KEY, -- the client_id
+    name TEXT NOT NULL, -- shown on the consent screen
+    secret_hash TEXT NOT NULL DEFAULT '', -- empty for public clients, which rely on PKCE alone
+    redirect_uris TEXT NOT NULL, -- space separated, matched exactly
+    scopes TEXT NOT NULL DEFAULT 'openid profile email', -- space separated scopes the client may request
+    created_by TEXT NOT NULL, -- admin who registered the client
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY, -- sha256 of the code, the code itself is only sent to the client
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    nonce TEXT NOT NULL DEFAULT '',
+    code_challenge TEXT NOT NULL, -- PKCE S256 challenge
+    amr TEXT NOT NULL DEFAULT '', -- authentication methods of the session that approved the request
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_access_tokens (
+    token_hash TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scope TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Scopes a user already approved for a client, so the consent screen is shown once
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scope TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes(expires_at);
+CREATE INDEX IF NOT EXISTS idx_oauth_access_tokens_expires_at ON oauth_access_tokens(expires_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_oauth_access_tokens_expires_at;
+DROP INDEX IF EXISTS idx_oauth_authorization_codes_expires_at;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_access_tokens;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
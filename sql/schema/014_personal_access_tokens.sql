@@ -0,0 +1,19 @@
+-- +goose Up
+-- API keys for scripts and CI jobs, sent as "Authorization: Bearer pat_..."
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL, -- label picked by the user
+    token_prefix TEXT NOT NULL, -- first characters of the token so the user can tell keys apart
+    token_hash TEXT UNIQUE NOT NULL, -- sha256 of the token, the token itself is only shown once
+    scopes TEXT NOT NULL, -- space separated: read, write, admin
+    expires_at DATETIME NOT NULL,
+    last_used_at DATETIME,
+    revoked_at DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_personal_access_tokens_user_id;
+DROP TABLE IF EXISTS personal_access_tokens;
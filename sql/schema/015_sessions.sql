@@ -0,0 +1,19 @@
+-- +goose Up
+-- One row per login, shown to the user as their signed in devices. The id is the
+-- refresh token family id carried in the sid claim of every access token.
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    current_jti TEXT NOT NULL, -- jti of the newest access token issued for the session
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '', -- address the session was last seen from
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL, -- expiry of the newest refresh token
+    revoked_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_sessions_user_id;
+DROP TABLE IF EXISTS sessions;
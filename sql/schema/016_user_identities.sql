@@ -0,0 +1,23 @@
+-- +goose Up
+-- Logins with external providers. A user can link several providers next to their
+-- password, users.provider only records how the account was first created.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL, -- 'google', 'discord'...
+    provider_user_id TEXT NOT NULL, -- id of the user at the provider
+    email TEXT NOT NULL DEFAULT '', -- address the provider reported when linking
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at DATETIME,
+    UNIQUE (provider, provider_user_id),
+    UNIQUE (user_id, provider)
+);
+
+-- Accounts created with OAuth before identities existed
+INSERT INTO user_identities (id, user_id, provider, provider_user_id, email, created_at)
+SELECT lower(hex(randomblob(16))), id, provider, provider_id, email, created_at
+FROM users
+WHERE provider NOT IN ('email', 'local') AND provider_id != '';
+
+-- +goose Down
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Set on requests an admin made while impersonating the user, admin_user_id is the admin
+ALTER TABLE admin_audit_logs ADD COLUMN impersonated_user_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_admin_audit_logs_impersonated_user_id ON admin_audit_logs(impersonated_user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_admin_audit_logs_impersonated_user_id;
+ALTER TABLE admin_audit_logs DROP COLUMN impersonated_user_id;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- users.role names one of these roles. A role has its own permissions and everything its
+-- parent role has, so admin > moderator > user.
+CREATE TABLE IF NOT EXISTS roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    parent_role TEXT NOT NULL DEFAULT '', -- '' for roles that inherit nothing
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL, -- resource:action, e.g. users:read
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description, parent_role) VALUES
+    ('unverified', 'Email users that have not confirmed their address', ''),
+    ('user', 'Regular users', ''),
+    ('moderator', 'Staff that can look up and suspend users', 'user'),
+    ('admin', 'Full access', 'moderator');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('moderator', 'admin:access'),
+    ('moderator', 'users:read'),
+    ('moderator', 'users:suspend'),
+    ('moderator', 'audit:read'),
+    ('admin', 'users:write'),
+    ('admin', 'users:impersonate'),
+    ('admin', 'roles:read'),
+    ('admin', 'roles:write'),
+    ('admin', 'oauth_clients:write');
+
+-- +goose Down
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
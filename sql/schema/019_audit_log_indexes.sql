@@ -0,0 +1,12 @@
+-- +goose Up
+-- Filters of the /admin/audit endpoints
+CREATE INDEX IF NOT EXISTS idx_admin_audit_logs_admin_user_id ON admin_audit_logs(admin_user_id);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_logs_target_user_id ON admin_audit_logs(target_user_id);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_logs_request_id ON admin_audit_logs(request_id);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_logs_timestamp ON admin_audit_logs(timestamp);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_admin_audit_logs_timestamp;
+DROP INDEX IF EXISTS idx_admin_audit_logs_request_id;
+DROP INDEX IF EXISTS idx_admin_audit_logs_target_user_id;
+DROP INDEX IF EXISTS idx_admin_audit_logs_admin_user_id;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- hash = sha256(prev_hash, row contents), see audit.HashLog. Rows written before this
+-- migration keep empty hashes and are reported as unchained by the verifier.
+ALTER TABLE admin_audit_logs ADD COLUMN prev_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE admin_audit_logs ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+-- A second writer that read the same previous hash fails instead of forking the chain
+CREATE UNIQUE INDEX idx_admin_audit_logs_prev_hash ON admin_audit_logs(prev_hash) WHERE hash != '';
+
+-- Signed statements of the chain head, so deleting rows at the tail is detectable too
+CREATE TABLE audit_checkpoints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    last_log_id INTEGER NOT NULL,
+    last_hash TEXT NOT NULL,
+    log_count INTEGER NOT NULL, -- chained rows up to and including last_log_id
+    key_id TEXT NOT NULL,
+    signature TEXT NOT NULL, -- base64 Ed25519 signature, see audit.checkpointMessage
+    created_at DATETIME NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP INDEX IF EXISTS idx_admin_audit_logs_prev_hash;
+ALTER TABLE admin_audit_logs DROP COLUMN hash;
+ALTER TABLE admin_audit_logs DROP COLUMN prev_hash;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- JSON object of the request headers, sensitive ones redacted
+ALTER TABLE admin_audit_logs ADD COLUMN request_headers TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE admin_audit_logs DROP COLUMN request_headers;
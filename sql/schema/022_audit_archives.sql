@@ -0,0 +1,19 @@
+-- +goose Up
+-- Audit logs past the retention period are exported to a gzipped JSONL file with a manifest,
+-- then deleted. The newest archive anchors the hash chain of the logs that remain.
+CREATE TABLE audit_archives (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file TEXT NOT NULL,
+    manifest TEXT NOT NULL,
+    sha256 TEXT NOT NULL, -- hex SHA-256 of file
+    log_count INTEGER NOT NULL,
+    chained_count INTEGER NOT NULL, -- archived rows with a hash, see audit_checkpoints.log_count
+    first_log_id INTEGER NOT NULL,
+    last_log_id INTEGER NOT NULL,
+    last_hash TEXT NOT NULL, -- prev_hash of the first log left in admin_audit_logs
+    cutoff DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_archives;
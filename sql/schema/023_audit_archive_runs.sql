@@ -0,0 +1,16 @@
+-- +goose Up
+-- One row per retention run, failed ones included, so the latest outcome survives restarts
+-- and runs of cmd/auditchain show up next to the server's own.
+CREATE TABLE audit_archive_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME NOT NULL,
+    cutoff DATETIME NOT NULL,
+    archived INTEGER NOT NULL, -- logs archived and deleted
+    file TEXT NOT NULL, -- empty when nothing had expired
+    manifest TEXT NOT NULL,
+    error TEXT NOT NULL -- empty when the run succeeded
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_archive_runs;
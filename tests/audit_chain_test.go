@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/services/audit"
+)
+
+func TestHashLog(t *testing.T) {
+	at := time.Date(2025, 3, 1, 12, 30, 0, 123456789, time.UTC)
+	entry := audit.Entry{
+		AdminUserID: "admin-1",
+		Action:      "UPDATE",
+		Resource:    "users",
+		Path:        "/admin/users/u-1/suspend",
+		StatusCode:  200,
+		Timestamp:   at,
+		RequestID:   "req_1",
+	}
+	first := audit.HashLog("", entry)
+	if first != audit.HashLog("", entry) {
+		t.Fatal("hash is not deterministic")
+	}
+
+	// The same instant in another zone is the same log
+	local := entry
+	local.Timestamp = at.In(time.FixedZone("EET", 2*60*60))
+	if audit.HashLog("", local) != first {
+		t.Error("hash depends on the time zone of the timestamp")
+	}
+
+	modified := entry
+	modified.StatusCode = 403
+	if audit.HashLog("", modified) == first {
+		t.Error("modified log has the same hash")
+	}
+	if audit.HashLog(first, entry) == first {
+		t.Error("hash doesn't depend on the previous hash")
+	}
+}
+
+func TestArchivedLogKeepsHash(t *testing.T) {
+	entry := audit.Entry{
+		AdminUserID:    "admin-1",
+		Action:         "DELETE",
+		Path:           "/admin/users/u-1",
+		RequestHeaders: `{"Accept":"*/*"}`,
+		StatusCode:     204,
+		Timestamp:      time.Date(2025, 3, 1, 12, 30, 0, 123456789, time.UTC),
+		RequestID:      "req_1",
+	}
+	line, err := json.Marshal(audit.ArchivedLog{ID: 1, Entry: entry, Hash: audit.HashLog("", entry)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archived audit.ArchivedLog
+	if err := json.Unmarshal(line, &archived); err != nil {
+		t.Fatal(err)
+	}
+	if audit.HashLog(archived.PrevHash, archived.Entry) != archived.Hash {
+		t.Error("archived log doesn't match its hash")
+	}
+}
+
+func TestVerifyAgainstExternalCheckpoint(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	seed, _, err := audit.GenerateCheckpointKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Runs after the environment is restored, so later tests go without checkpoints again
+	t.Cleanup(func() { audit.LoadCheckpointKeys() })
+	t.Setenv("AUDIT_CHECKPOINT_KEYS", "test:"+seed)
+	if err := audit.LoadCheckpointKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs []db.AdminAuditLog
+	for i := range 4 {
+		row, err := audit.Append(ctx, audit.Entry{
+			AdminUserID: "admin-1",
+			Action:      "UPDATE",
+			Resource:    "users",
+			StatusCode:  200,
+			Timestamp:   time.Now().UTC(),
+			RequestID:   fmt.Sprintf("req_%d", i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, row)
+	}
+	cp, created, err := audit.CreateCheckpoint(ctx)
+	if err != nil || !created {
+		t.Fatalf("checkpoint not created: %v", err)
+	}
+	// The copy kept off-host goes through JSON like the output of the command
+	raw, err := json.Marshal(audit.ExportCheckpoint(cp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var external audit.ExportedCheckpoint
+	if err := json.Unmarshal(raw, &external); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := audit.Verify(ctx, external); err != nil || !v.OK() {
+		t.Fatalf("intact chain: %+v, %v", v, err)
+	}
+
+	forged := external
+	forged.LogCount++
+	if v, err := audit.Verify(ctx, forged); err != nil || v.OK() {
+		t.Errorf("forged checkpoint accepted: %+v, %v", v, err)
+	}
+
+	// Deleting the newest logs and every checkpoint leaves a consistent database behind
+	if _, err := db.Conn().Exec("DELETE FROM admin_audit_logs WHERE id > ?", logs[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Conn().Exec("DELETE FROM audit_checkpoints"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := audit.Verify(ctx); err != nil || !v.OK() {
+		t.Fatalf("truncated chain without checkpoints: %+v, %v", v, err)
+	}
+	v, err := audit.Verify(ctx, external)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.OK() || !strings.Contains(v.Problem, "deleted from the end") {
+		t.Errorf("truncation not caught by the external checkpoint: %+v", v)
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nikojunttila/community/internal/services/audit"
+)
+
+func TestListAuditLogs(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	start := time.Now().UTC().Add(-time.Hour)
+	for i := range 5 {
+		entry := audit.Entry{
+			AdminUserID:  "admin-1",
+			AdminEmail:   "admin@example.com",
+			TargetUserID: "user-1",
+			Action:       "UPDATE",
+			Resource:     "users",
+			Method:       "PUT",
+			Path:         "/admin/users/user-1",
+			StatusCode:   200,
+			Timestamp:    start.Add(time.Duration(i) * time.Minute),
+			RequestID:    fmt.Sprintf("req_%d", i),
+		}
+		if i >= 3 {
+			entry.AdminUserID = "admin-2"
+			entry.AdminEmail = "moderator@example.com"
+			entry.Action = "DELETE"
+			entry.Path = "/admin/users/user-2"
+			entry.TargetUserID = "user-2"
+			entry.StatusCode = 404
+		}
+		if _, err := audit.Append(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(filter audit.Filter) int {
+		t.Helper()
+		page, err := audit.List(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(page.Logs)
+	}
+
+	for name, tc := range map[string]struct {
+		filter audit.Filter
+		want   int
+	}{
+		"everything":  {audit.Filter{}, 5},
+		"admin":       {audit.Filter{AdminUserID: "admin-2"}, 2},
+		"action":      {audit.Filter{Action: "UPDATE"}, 3},
+		"status":      {audit.Filter{StatusCode: 404}, 2},
+		"since":       {audit.Filter{Since: start.Add(2 * time.Minute)}, 3},
+		"until":       {audit.Filter{Until: start.Add(2 * time.Minute)}, 2},
+		"search path": {audit.Filter{Search: "user-2"}, 2},
+		"search mail": {audit.Filter{Search: "moderator@"}, 2},
+		"combined":    {audit.Filter{AdminUserID: "admin-1", Search: "user-2"}, 0},
+		// Wildcards are matched literally
+		"percent":    {audit.Filter{Search: "%"}, 0},
+		"underscore": {audit.Filter{Search: "user_2"}, 0},
+		"backslash":  {audit.Filter{Search: `admin\-1`}, 0},
+	} {
+		if got := count(tc.filter); got != tc.want {
+			t.Errorf("%s: got %d logs, want %d", name, got, tc.want)
+		}
+	}
+
+	// Pages don't overlap and the last one has no cursor
+	var seen []int64
+	filter := audit.Filter{PageSize: 2}
+	for {
+		page, err := audit.List(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, log := range page.Logs {
+			if len(seen) > 0 && log.ID >= seen[len(seen)-1] {
+				t.Fatalf("log %d out of order after %v", log.ID, seen)
+			}
+			seen = append(seen, log.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Errorf("paged through %d logs, want 5", len(seen))
+	}
+
+	if _, err := audit.List(ctx, audit.Filter{Cursor: "abc"}); !errors.Is(err, audit.ErrInvalidCursor) {
+		t.Errorf("bad cursor: got %v", err)
+	}
+	if _, err := audit.List(ctx, audit.Filter{Since: start, Until: start}); !errors.Is(err, audit.ErrInvalidFilter) {
+		t.Errorf("empty time range: got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikojunttila/community/internal/services/audit"
+)
+
+func TestArchiveRunsAreRecorded(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	// Runs after the environment is restored, so later tests keep their logs again
+	t.Cleanup(func() { audit.LoadRetention() })
+	t.Setenv("AUDIT_RETENTION_DAYS", "1")
+	t.Setenv("AUDIT_ARCHIVE_DIR", dir)
+	if err := audit.LoadRetention(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := audit.LastArchiveRun(ctx); err != nil || ok {
+		t.Fatalf("run before the first one: %v, %v", ok, err)
+	}
+	for _, age := range []time.Duration{48 * time.Hour, time.Minute} {
+		if _, err := audit.Append(ctx, audit.Entry{
+			AdminUserID: "admin-1",
+			Action:      "UPDATE",
+			Resource:    "users",
+			StatusCode:  200,
+			Timestamp:   time.Now().UTC().Add(-age),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive, created, err := audit.ArchiveExpired(ctx)
+	if err != nil || !created {
+		t.Fatalf("nothing archived: %v", err)
+	}
+	run, ok, err := audit.LastArchiveRun(ctx)
+	if err != nil || !ok {
+		t.Fatalf("run not recorded: %v, %v", ok, err)
+	}
+	if run.Archived != 1 || run.File != archive.File || run.Manifest != archive.Manifest || run.Error != "" {
+		t.Errorf("unexpected run %+v", run)
+	}
+
+	// A file where the directory should be makes the next run fail
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.WriteFile(blocked, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AUDIT_ARCHIVE_DIR", blocked)
+	if err := audit.LoadRetention(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := audit.ArchiveExpired(ctx); err == nil {
+		t.Fatal("archiving into a file succeeded")
+	}
+	run, ok, err = audit.LastArchiveRun(ctx)
+	if err != nil || !ok {
+		t.Fatalf("failed run not recorded: %v, %v", ok, err)
+	}
+	if run.Error == "" || run.Archived != 0 || run.File != "" {
+		t.Errorf("failed run recorded as %+v", run)
+	}
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/services/audit"
+)
+
+func TestSinkReplaysSpillAfterFailedFlush(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	spillFile := filepath.Join(t.TempDir(), "audit_spill.jsonl")
+
+	// Without the table every flush fails
+	if _, err := db.Conn().Exec("ALTER TABLE admin_audit_logs RENAME TO admin_audit_logs_offline"); err != nil {
+		t.Fatal(err)
+	}
+	audit.StartSink(audit.SinkConfig{
+		QueueSize:     16,
+		BatchSize:     10,
+		FlushInterval: 20 * time.Millisecond,
+		EnqueueWait:   time.Second,
+		SpillFile:     spillFile,
+	})
+	t.Cleanup(func() { audit.Close(context.Background()) })
+	for i := range 3 {
+		audit.Record(ctx, audit.Entry{
+			AdminUserID: "admin-1",
+			Action:      "UPDATE",
+			Resource:    "users",
+			StatusCode:  200,
+			Timestamp:   time.Now().Add(time.Duration(i) * time.Millisecond),
+			RequestID:   fmt.Sprintf("req_%d", i),
+		})
+	}
+	waitFor(t, "the batch to be spilled", func() bool { return audit.Stats().Spilled == 3 })
+	if _, err := os.Stat(spillFile); err != nil {
+		t.Fatalf("spill file missing: %v", err)
+	}
+	if stats := audit.Stats(); stats.Written != 0 || stats.Replayed != 0 || stats.Lost != 0 {
+		t.Fatalf("unexpected stats while the database is down %+v", stats)
+	}
+
+	if _, err := db.Conn().Exec("ALTER TABLE admin_audit_logs_offline RENAME TO admin_audit_logs"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the spill file to be replayed", func() bool { return audit.Stats().Replayed == 3 })
+	if _, err := os.Stat(spillFile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("spill file left after the replay: %v", err)
+	}
+	if err := audit.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	verification, err := audit.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.OK() || verification.Checked != 3 {
+		t.Errorf("replayed logs not chained: %+v", verification)
+	}
+	for i := range 3 {
+		if _, err := audit.GetByRequestID(ctx, fmt.Sprintf("req_%d", i)); err != nil {
+			t.Errorf("log %d not replayed: %v", i, err)
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
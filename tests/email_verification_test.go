@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+// createVerificationToken stores a verification token the way SendVerificationEmail does, without the email
+func createVerificationToken(t *testing.T, user db.User, expiresAt time.Time) string {
+	t.Helper()
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get().CreateEmailVerificationToken(context.Background(), db.CreateEmailVerificationTokenParams{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyEmail(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "verify@example.com")
+	if user.EmailVerified {
+		t.Fatal("new email user starts verified")
+	}
+
+	expired := createVerificationToken(t, user, time.Now().UTC().Add(-time.Minute))
+	if _, err := userService.VerifyEmail(ctx, expired); !errors.Is(err, userService.ErrVerificationTokenInvalid) {
+		t.Errorf("expired token accepted: %v", err)
+	}
+	token := createVerificationToken(t, user, time.Now().UTC().Add(time.Hour))
+	verified, err := userService.VerifyEmail(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.Get().GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.EmailVerified || !stored.EmailVerified {
+		t.Error("address not marked verified")
+	}
+	if _, err := userService.VerifyEmail(ctx, token); !errors.Is(err, userService.ErrVerificationTokenInvalid) {
+		t.Errorf("token used twice: %v", err)
+	}
+
+	// Verified and unknown addresses are ignored without sending anything
+	if err := userService.ResendVerificationEmail(ctx, user.Email); err != nil {
+		t.Errorf("verified address: %v", err)
+	}
+	if err := userService.ResendVerificationEmail(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("unknown address: %v", err)
+	}
+}
+
+func TestVerificationEmailThrottle(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "throttle-verify@example.com")
+	// A link was just sent, the next one has to wait for the cooldown
+	createVerificationToken(t, user, time.Now().UTC().Add(time.Hour))
+	if err := userService.SendVerificationEmail(context.Background(), user); !errors.Is(err, userService.ErrVerificationThrottled) {
+		t.Errorf("second email within the cooldown: %v", err)
+	}
+}
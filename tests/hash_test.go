@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	long := strings.Repeat("a", 80)
+	hash, err := auth.HashPassword(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$") || auth.PasswordNeedsRehash(hash) {
+		t.Fatalf("unexpected hash %q", hash)
+	}
+	if !auth.CheckPasswordHash(long, hash) {
+		t.Error("password did not verify")
+	}
+	// bcrypt would ignore everything after 72 bytes
+	if auth.CheckPasswordHash(long[:72]+"b", hash) || auth.CheckPasswordHash(long[:72], hash) {
+		t.Error("different password verified")
+	}
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if !auth.CheckPasswordHash("password123", string(legacy)) || auth.CheckPasswordHash("password124", string(legacy)) {
+		t.Error("legacy bcrypt hash verified incorrectly")
+	}
+	if !auth.PasswordNeedsRehash(string(legacy)) {
+		t.Error("bcrypt hash should be rehashed")
+	}
+
+	// Hashes with weaker parameters are upgraded
+	weak, _ := auth.NewArgon2idHasher(auth.Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).Hash("password123")
+	if !auth.CheckPasswordHash("password123", weak) || !auth.PasswordNeedsRehash(weak) {
+		t.Errorf("weak hash %q not handled", weak)
+	}
+}
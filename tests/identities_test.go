@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+func TestLoginWithIdentity(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	identity := userService.ExternalIdentity{
+		Provider:       "google",
+		ProviderUserID: "google-1",
+		Email:          "New.User@Example.com",
+		EmailVerified:  true,
+		Name:           "New User",
+	}
+
+	created, err := userService.LoginWithIdentity(ctx, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Email != "new.user@example.com" || !created.EmailVerified {
+		t.Errorf("unexpected new user %+v", created)
+	}
+	again, err := userService.LoginWithIdentity(ctx, identity)
+	if err != nil || again.ID != created.ID {
+		t.Fatalf("second login: got %s, %v", again.ID, err)
+	}
+
+	// An unverified account with the same email must not be taken over
+	existing := createTestUser(t, "existing@example.com")
+	github := userService.ExternalIdentity{
+		Provider:       "github",
+		ProviderUserID: "github-1",
+		Email:          existing.Email,
+		EmailVerified:  true,
+	}
+	if _, err := userService.LoginWithIdentity(ctx, github); !errors.Is(err, userService.ErrIdentityNotLinked) {
+		t.Fatalf("unverified account: got %v", err)
+	}
+	if err := db.Get().SetUserEmailVerified(ctx, db.SetUserEmailVerifiedParams{EmailVerified: true, UpdatedAt: time.Now(), ID: existing.ID}); err != nil {
+		t.Fatal(err)
+	}
+	unverified := github
+	unverified.EmailVerified = false
+	if _, err := userService.LoginWithIdentity(ctx, unverified); !errors.Is(err, userService.ErrIdentityNotLinked) {
+		t.Fatalf("address not verified by the provider: got %v", err)
+	}
+	linked, err := userService.LoginWithIdentity(ctx, github)
+	if err != nil || linked.ID != existing.ID {
+		t.Errorf("verified on both sides: got %s, %v", linked.ID, err)
+	}
+}
+
+func TestLinkAndUnlinkIdentity(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "link@example.com")
+	other := createTestUser(t, "other@example.com")
+	identity := userService.ExternalIdentity{Provider: "discord", ProviderUserID: "discord-1", Email: "whatever@example.com"}
+
+	if err := userService.LinkIdentity(ctx, user, identity); err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.LinkIdentity(ctx, user, identity); err != nil {
+		t.Errorf("linking the same account again: %v", err)
+	}
+	if err := userService.LinkIdentity(ctx, other, identity); !errors.Is(err, userService.ErrIdentityInUse) {
+		t.Errorf("identity of another user: got %v", err)
+	}
+	second := userService.ExternalIdentity{Provider: "discord", ProviderUserID: "discord-2"}
+	if err := userService.LinkIdentity(ctx, user, second); !errors.Is(err, userService.ErrProviderAlreadyLinked) {
+		t.Errorf("second account of the provider: got %v", err)
+	}
+
+	// The password is still there, so the provider can go
+	if err := userService.UnlinkIdentity(ctx, user, "discord"); err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.UnlinkIdentity(ctx, user, "discord"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unlinking twice: got %v", err)
+	}
+
+	oauthOnly, err := userService.LoginWithIdentity(ctx, userService.ExternalIdentity{
+		Provider:       "google",
+		ProviderUserID: "google-2",
+		Email:          "oauth-only@example.com",
+		EmailVerified:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.UnlinkIdentity(ctx, oauthOnly, "google"); !errors.Is(err, userService.ErrLastLoginMethod) {
+		t.Errorf("last login method: got %v", err)
+	}
+	if identities, err := userService.ListIdentities(ctx, oauthOnly.ID); err != nil || len(identities) != 1 {
+		t.Errorf("identities left: %d, %v", len(identities), err)
+	}
+}
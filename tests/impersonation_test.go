@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/middleware"
+	"github.com/nikojunttila/community/internal/services/audit"
+)
+
+func TestImpersonation(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	admin := setTestUserRole(t, createTestUser(t, "admin@example.com"), "admin")
+	moderator := setTestUserRole(t, createTestUser(t, "moderator@example.com"), "moderator")
+	target := createTestUser(t, "target@example.com")
+	audit.StartSink(audit.SinkConfig{
+		QueueSize:     16,
+		BatchSize:     10,
+		FlushInterval: 10 * time.Millisecond,
+		EnqueueWait:   time.Second,
+		SpillFile:     filepath.Join(t.TempDir(), "audit_spill.jsonl"),
+	})
+	t.Cleanup(func() { audit.Close(context.Background()) })
+
+	session, err := auth.IssueTokenPair(ctx, admin, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, staff := range []db.User{admin, moderator} {
+		if _, _, err := auth.Impersonate(ctx, admin, staff, session.SessionID, nil); !errors.Is(err, auth.ErrImpersonationNotAllowed) {
+			t.Errorf("impersonating %s: got %v", staff.Role, err)
+		}
+	}
+	token, _, err := auth.Impersonate(ctx, admin, target, session.SessionID, []string{auth.AMRPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := auth.VerifyToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := verified.AsMap(ctx)
+	if auth.ActorFromClaims(claims) != admin.LookupID {
+		t.Errorf("act claim = %v, want the admin", claims[auth.ClaimActor])
+	}
+
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+	router := chi.NewRouter()
+	router.Use(middleware.Verifier())
+	router.Use(jwtauth.Authenticator(auth.GetTokenAuth()))
+	router.Use(middleware.RejectRevokedTokens())
+	router.Use(middleware.AuditImpersonation())
+	router.Get("/api/user/me", ok)
+	router.With(middleware.RejectImpersonation()).Get("/auth/passkeys", ok)
+	status := func(path string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if got := status("/api/user/me"); got != http.StatusOK {
+		t.Fatalf("impersonated request: got %d, want 200", got)
+	}
+	if got := status("/auth/passkeys"); got != http.StatusForbidden {
+		t.Errorf("credentials while impersonating: got %d, want 403", got)
+	}
+	if err := audit.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	page, err := audit.List(ctx, audit.Filter{AdminUserID: admin.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rejected requests are audited too, newest first
+	if len(page.Logs) != 2 || page.Logs[0].StatusCode != http.StatusForbidden || page.Logs[1].Path != "/api/user/me" {
+		t.Fatalf("impersonated requests not audited as the admin: %+v", page.Logs)
+	}
+	for _, log := range page.Logs {
+		if log.ImpersonatedUserID != target.ID {
+			t.Errorf("log %d: impersonated user %q", log.ID, log.ImpersonatedUserID)
+		}
+	}
+
+	// The token stops working as soon as the admin loses the permission or the session
+	setTestUserRole(t, admin, "moderator")
+	if got := status("/api/user/me"); got != http.StatusForbidden {
+		t.Errorf("admin demoted: got %d, want 403", got)
+	}
+	setTestUserRole(t, admin, "admin")
+	if err := auth.RevokeAllUserSessions(ctx, admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := status("/api/user/me"); got != http.StatusUnauthorized {
+		t.Errorf("admin signed out: got %d, want 401", got)
+	}
+}
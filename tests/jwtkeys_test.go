@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nikojunttila/community/internal/auth"
+)
+
+func TestJWTKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	first, err := auth.GenerateJWTKey(dir, "RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auth.GenerateJWTKey(dir, "EdDSA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := auth.LoadJWTKeys(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyring.Active.KeyID() != second || keyring.Public.Len() != 2 {
+		t.Fatalf("newest key %s should sign, got %s with %d keys", second, keyring.Active.KeyID(), keyring.Public.Len())
+	}
+
+	// A retired key still verifies but can't be chosen to sign
+	retired, err := auth.RetireJWTKeys(dir, second)
+	if err != nil || len(retired) != 1 || retired[0] != first {
+		t.Fatalf("retired %v, %v", retired, err)
+	}
+	keyring, err = auth.LoadJWTKeys(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keyring.Public.LookupKeyID(first); !ok {
+		t.Error("retired key missing from the verification keys")
+	}
+	if _, err := auth.LoadJWTKeys(dir, first); err == nil {
+		t.Error("retired key accepted as signing key")
+	}
+
+	// Tokens the key just signed are still valid, it is only pruned once they expired
+	pruned, kept, err := auth.PruneJWTKeys(dir)
+	if err != nil || len(pruned) != 0 || !slices.Equal(kept, []string{first}) {
+		t.Fatalf("pruned %v, kept %v, %v", pruned, kept, err)
+	}
+	retiredAt := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, first+".pub.pem"), retiredAt, retiredAt); err != nil {
+		t.Fatal(err)
+	}
+	pruned, kept, err = auth.PruneJWTKeys(dir)
+	if err != nil || !slices.Equal(pruned, []string{first}) || len(kept) != 0 {
+		t.Fatalf("pruned %v, kept %v, %v", pruned, kept, err)
+	}
+	keyring, err = auth.LoadJWTKeys(dir, "")
+	if err != nil || keyring.Public.Len() != 1 {
+		t.Errorf("keys left after pruning: %v", err)
+	}
+}
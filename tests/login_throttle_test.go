@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	// No account behind the address, unknown addresses are throttled the same way
+	const email, ip = "Nobody@Example.com", "203.0.113.7"
+
+	// The first three failures are free
+	for i := 1; i <= 3; i++ {
+		if err := userService.RecordLoginFailure(ctx, email, ip); err != nil {
+			t.Fatal(err)
+		}
+		if wait, err := userService.LoginRetryAfter(ctx, email, ip); err != nil || wait != 0 {
+			t.Fatalf("failure %d: wait %s, %v", i, wait, err)
+		}
+	}
+	if err := userService.RecordLoginFailure(ctx, email, ip); err != nil {
+		t.Fatal(err)
+	}
+	wait, err := userService.LoginRetryAfter(ctx, " nobody@example.com", ip)
+	if err != nil || wait <= 0 || wait > time.Second {
+		t.Fatalf("fourth failure: wait %s, %v", wait, err)
+	}
+
+	for i := 5; i <= 10; i++ {
+		if err := userService.RecordLoginFailure(ctx, email, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait, err = userService.LoginRetryAfter(ctx, email, "")
+	if err != nil || wait < 14*time.Minute {
+		t.Fatalf("tenth failure should lock the account: wait %s, %v", wait, err)
+	}
+	// The ip has more slack, another address from it isn't delayed
+	if wait, err := userService.LoginRetryAfter(ctx, "other@example.com", ip); err != nil || wait != 0 {
+		t.Errorf("ip throttled after 10 failures: wait %s, %v", wait, err)
+	}
+
+	if err := userService.RecordLoginSuccess(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	if wait, err := userService.LoginRetryAfter(ctx, email, ""); err != nil || wait != 0 {
+		t.Errorf("account still throttled after a successful login: wait %s, %v", wait, err)
+	}
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/middleware"
+)
+
+func TestSecondFactorIsPartOfTheSession(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user, _ := enrollTOTP(t, createTestUser(t, "mfa@example.com"))
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler = middleware.RejectMFAPending()(handler)
+	handler = jwtauth.Authenticator(auth.GetTokenAuth())(handler)
+	handler = middleware.Verifier()(handler)
+	status := func(accessToken string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/me", nil)
+		r.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// The password alone only opens a short session waiting for the OTP
+	pending, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pending.MFAPending {
+		t.Fatal("user with TOTP got a full session from the password")
+	}
+	if got := status(pending.AccessToken); got != http.StatusUnauthorized {
+		t.Errorf("pending session: got %d, want 401", got)
+	}
+	if _, err := auth.RotateRefreshToken(ctx, pending.RefreshToken); !errors.Is(err, auth.ErrRefreshTokenInvalid) {
+		t.Errorf("pending session extended: %v", err)
+	}
+
+	full, err := auth.CompleteMFA(ctx, user, pending.SessionID, []string{auth.AMRPassword}, auth.AMROTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.MFAPending || full.SessionID == pending.SessionID {
+		t.Fatalf("second factor didn't start a new full session %+v", full)
+	}
+	if got := status(full.AccessToken); got != http.StatusOK {
+		t.Errorf("full session: got %d, want 200", got)
+	}
+	token, err := auth.VerifyToken(full.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := token.AsMap(ctx)
+	if amr := auth.AMRFromClaims(claims); !slices.Equal(amr, []string{auth.AMRPassword, auth.AMROTP}) {
+		t.Errorf("amr = %v", amr)
+	}
+	if revoked, err := auth.IsTokenRevoked(ctx, accessTokenID(t, pending.AccessToken), pending.SessionID); err != nil || !revoked {
+		t.Errorf("pending session still usable: %v, %v", revoked, err)
+	}
+	if _, err := auth.RotateRefreshToken(ctx, full.RefreshToken); err != nil {
+		t.Errorf("full session can't be refreshed: %v", err)
+	}
+}
+
+func TestUserWithoutSecondFactorGetsFullSession(t *testing.T) {
+	setupTestDB(t)
+	pair, err := auth.IssueTokenPair(context.Background(), createTestUser(t, "no-mfa@example.com"), auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.MFAPending {
+		t.Error("user without a second factor got a pending session")
+	}
+}
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/handlers"
+)
+
+func TestOnlyConfiguredProvidersLogIn(t *testing.T) {
+	setupTestDB(t)
+	router := chi.NewRouter()
+	router.Get("/public/{provider}/begin", handlers.GetBeginAuth)
+	begin := func(provider string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/"+provider+"/begin", nil))
+		return w
+	}
+
+	if !auth.OAuthProviderEnabled("github") || auth.OAuthProviderEnabled("google") {
+		t.Fatal("enabled providers don't follow OAUTH_PROVIDERS")
+	}
+	w := begin("github")
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("github: got %d, want 307", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Host != "github.com" || location.Query().Get("client_id") != "test-client" {
+		t.Errorf("unexpected redirect %s", location)
+	}
+	// The callback defaults to APP_URL
+	if got := location.Query().Get("redirect_uri"); got != "http://localhost:3000/public/github/callback" {
+		t.Errorf("redirect_uri = %q", got)
+	}
+
+	for _, provider := range []string{"google", "gitlab"} {
+		if got := begin(provider).Code; got != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", provider, got)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/nikojunttila/community/internal/services/oidc"
+)
+
+func TestAuthorizationCodePKCE(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "oidc@example.com")
+	const redirectURI = "http://localhost:5173/callback"
+	client, _, err := oidc.RegisterClient(ctx, "admin", oidc.RegisterClientParams{
+		Name:         "SPA",
+		RedirectURIs: []string{redirectURI},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := sha256.Sum256([]byte(verifier))
+	req, err := oidc.ParseAuthorizationRequest(ctx, url.Values{
+		"client_id":             {client.ID},
+		"redirect_uri":          {redirectURI},
+		"response_type":         {"code"},
+		"scope":                 {"openid email"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange := func(code, codeVerifier string) (oidc.TokenResponse, error) {
+		return oidc.ExchangeCode(ctx, oidc.TokenRequest{
+			GrantType:    "authorization_code",
+			Code:         code,
+			RedirectURI:  redirectURI,
+			ClientID:     client.ID,
+			CodeVerifier: codeVerifier,
+		})
+	}
+
+	// A wrong verifier burns the code, the right one can't be tried afterwards
+	code, err := oidc.IssueAuthorizationCode(ctx, user, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exchange(code, "wrong-verifier"); oauthErrorCode(err) != "invalid_grant" {
+		t.Fatalf("verifier mismatch: got %v", err)
+	}
+	if _, err := exchange(code, verifier); oauthErrorCode(err) != "invalid_grant" {
+		t.Errorf("code accepted after a failed exchange: %v", err)
+	}
+
+	code, err = oidc.IssueAuthorizationCode(ctx, user, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := exchange(code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.AccessToken == "" || tokens.IDToken == "" {
+		t.Fatalf("incomplete token response %+v", tokens)
+	}
+	// ID tokens are never signed with the shared JWT_SECRET
+	msg, err := jws.Parse([]byte(tokens.IDToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alg := msg.Signatures()[0].ProtectedHeaders().Algorithm().String()
+	if alg != "EdDSA" || !slices.Equal(oidc.Metadata().IDTokenSigningAlgValuesSupported, []string{alg}) {
+		t.Errorf("ID token signed with %s, discovery advertises %v", alg, oidc.Metadata().IDTokenSigningAlgValuesSupported)
+	}
+	if _, err := exchange(code, verifier); oauthErrorCode(err) != "invalid_grant" {
+		t.Errorf("code exchanged twice: %v", err)
+	}
+}
+
+func oauthErrorCode(err error) string {
+	var oauthErr *oidc.Error
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Code
+	}
+	return ""
+}
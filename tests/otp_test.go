@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+	"github.com/pquerna/otp/totp"
+)
+
+// enrollTOTP gives the user a sealed TOTP secret and returns the plain one
+func enrollTOTP(t *testing.T, user db.User) (db.User, string) {
+	t.Helper()
+	ctx := context.Background()
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "Test", AccountName: user.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := auth.SealSecret(user.ID, key.Secret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get().UpdateUserSecret(ctx, db.UpdateUserSecretParams{Secret: sealed, ID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	user, err = db.Get().GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, key.Secret()
+}
+
+func TestOTPReplayAndLockout(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user, secret := enrollTOTP(t, createTestUser(t, "otp@example.com"))
+
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.ValidateTOTP(ctx, user, code); err != nil {
+		t.Fatalf("valid code rejected: %v", err)
+	}
+	if err := userService.ValidateTOTP(ctx, user, code); !errors.Is(err, userService.ErrOTPReplayed) {
+		t.Fatalf("replayed code: got %v", err)
+	}
+
+	// The replay counted as the first failure, the fifth one locks
+	for i := 2; i < 5; i++ {
+		if err := userService.ValidateTOTP(ctx, user, "wrong"); !errors.Is(err, userService.ErrOTPInvalid) {
+			t.Fatalf("failure %d: got %v", i, err)
+		}
+	}
+	if err := userService.ValidateTOTP(ctx, user, "wrong"); !errors.Is(err, userService.ErrOTPLocked) {
+		t.Fatalf("fifth failure: got %v", err)
+	}
+	next, _ := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	if err := userService.ValidateTOTP(ctx, user, next); !errors.Is(err, userService.ErrOTPLocked) {
+		t.Errorf("valid code accepted while locked: %v", err)
+	}
+}
+
+func TestOTPLockoutConcurrentGuesses(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user, _ := enrollTOTP(t, createTestUser(t, "otp-race@example.com"))
+
+	const guesses = 20
+	results := make(chan error, guesses)
+	var wg sync.WaitGroup
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- userService.ValidateTOTP(ctx, user, "wrong")
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	// Every guess is counted before it is checked, so only the ones before the lock get checked
+	checked := 0
+	for err := range results {
+		switch {
+		case errors.Is(err, userService.ErrOTPInvalid):
+			checked++
+		case !errors.Is(err, userService.ErrOTPLocked):
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if checked != 4 {
+		t.Errorf("%d concurrent guesses were checked before the lockout, want 4", checked)
+	}
+}
+
+func TestRecoveryCodeResetsOTPFailures(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user, _ := enrollTOTP(t, createTestUser(t, "recovery@example.com"))
+	codes, err := userService.GenerateRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < 5; i++ {
+		if err := userService.RedeemRecoveryCode(ctx, user.ID, "not-a-code"); !errors.Is(err, userService.ErrRecoveryCodeInvalid) {
+			t.Fatalf("failure %d: got %v", i, err)
+		}
+	}
+	if err := userService.RedeemRecoveryCode(ctx, user.ID, codes[0]); err != nil {
+		t.Fatalf("valid recovery code rejected: %v", err)
+	}
+	state, err := db.Get().GetOTPState(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.FailedAttempts != 0 || state.LockedUntil.Valid {
+		t.Errorf("failures not reset after a recovery code: %d, locked %v", state.FailedAttempts, state.LockedUntil.Valid)
+	}
+	if err := userService.RedeemRecoveryCode(ctx, user.ID, codes[0]); !errors.Is(err, userService.ErrRecoveryCodeInvalid) {
+		t.Errorf("recovery code used twice: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	"github.com/nikojunttila/community/internal/handlers"
+	"github.com/nikojunttila/community/internal/middleware"
+	userService "github.com/nikojunttila/community/internal/services/user"
+	"github.com/pquerna/otp/totp"
+)
+
+// createTestPasskey stores a placeholder credential, enough for the user to count as having a passkey
+func createTestPasskey(t *testing.T, user db.User) string {
+	t.Helper()
+	id := uuid.New().String()
+	if err := db.Get().CreateWebAuthnCredential(context.Background(), db.CreateWebAuthnCredentialParams{
+		ID:           id,
+		UserID:       user.ID,
+		CredentialID: "cred-" + id,
+		Credential:   "{}",
+		Name:         "Test key",
+		CreatedAt:    time.Now().UTC(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestPasskeyChangeReauthentication(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+
+	// Without a second factor the password is enough
+	user := createTestUser(t, "passkey-password@example.com")
+	if err := userService.ReauthenticatePasskeyChange(ctx, user, userService.PasskeyReauth{}); !errors.Is(err, userService.ErrWrongPassword) {
+		t.Errorf("no password: got %v", err)
+	}
+	if err := userService.ReauthenticatePasskeyChange(ctx, user, userService.PasskeyReauth{Password: "Kettle-Orbit-93"}); err != nil {
+		t.Errorf("right password rejected: %v", err)
+	}
+
+	// Once passkeys are the second factor, only one of them will do
+	createTestPasskey(t, user)
+	if err := userService.ReauthenticatePasskeyChange(ctx, user, userService.PasskeyReauth{Password: "Kettle-Orbit-93"}); !errors.Is(err, userService.ErrPasskeyReauthRequired) {
+		t.Errorf("password replaced the passkey: got %v", err)
+	}
+	_, token, err := userService.BeginPasskeyReauth(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := userService.PasskeyReauth{Token: token, Assertion: []byte(`{"id":"forged"}`)}
+	if err := userService.ReauthenticatePasskeyChange(ctx, user, forged); !errors.Is(err, userService.ErrPasskeyInvalid) {
+		t.Errorf("forged assertion: got %v", err)
+	}
+	if err := userService.ReauthenticatePasskeyChange(ctx, user, forged); !errors.Is(err, userService.ErrPasskeySessionInvalid) {
+		t.Errorf("reauth challenge answered twice: got %v", err)
+	}
+
+	// With TOTP the password alone isn't enough
+	totpUser, secret := enrollTOTP(t, createTestUser(t, "passkey-totp@example.com"))
+	if err := userService.ReauthenticatePasskeyChange(ctx, totpUser, userService.PasskeyReauth{Password: "Kettle-Orbit-93"}); !errors.Is(err, userService.ErrOTPInvalid) {
+		t.Errorf("password without OTP: got %v", err)
+	}
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.ReauthenticatePasskeyChange(ctx, totpUser, userService.PasskeyReauth{Password: "Kettle-Orbit-93", OTPCode: code}); err != nil {
+		t.Errorf("password and OTP rejected: %v", err)
+	}
+}
+
+func TestDeletePasskeyRequiresReauthentication(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user, secret := enrollTOTP(t, createTestUser(t, "passkey-delete@example.com"))
+	passkeyID := createTestPasskey(t, user)
+
+	pending, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := auth.CompleteMFA(ctx, user, pending.SessionID, []string{auth.AMRPassword}, auth.AMROTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := chi.NewRouter()
+	router.Use(middleware.Verifier())
+	router.Use(jwtauth.Authenticator(auth.GetTokenAuth()))
+	router.Delete("/auth/passkeys/{passkeyID}", handlers.DeletePasskeyHandler)
+	remove := func(body string) int {
+		r := httptest.NewRequest(http.MethodDelete, "/auth/passkeys/"+passkeyID, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+session.AccessToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if got := remove(""); got != http.StatusBadRequest {
+		t.Errorf("without a body: got %d, want 400", got)
+	}
+	if got := remove(`{"password":"Kettle-Orbit-93"}`); got != http.StatusUnauthorized {
+		t.Errorf("without an OTP: got %d, want 401", got)
+	}
+	if creds, err := userService.ListPasskeys(ctx, user.ID); err != nil || len(creds) != 1 {
+		t.Fatalf("passkey removed without reauthentication: %d, %v", len(creds), err)
+	}
+
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := remove(`{"password":"Kettle-Orbit-93","otp_code":"` + code + `"}`); got != http.StatusOK {
+		t.Errorf("with password and OTP: got %d, want 200", got)
+	}
+	if creds, err := userService.ListPasskeys(ctx, user.ID); err != nil || len(creds) != 0 {
+		t.Errorf("passkey left after deletion: %d, %v", len(creds), err)
+	}
+}
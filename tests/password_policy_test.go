@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nikojunttila/community/internal/auth"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	prefix, suffix := auth.BreachedPasswordHash("Summer-Breeze-77")
+	if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte("0000000000000000000000000000000000A:0\n"+suffix+":42\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	policy := auth.DefaultPasswordPolicy()
+	breached, err := auth.OpenBreachedPasswords(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.Breached = breached
+
+	for _, tc := range []struct {
+		password string
+		ok       bool
+	}{
+		{"short", false},
+		{"password", false},         // banned
+		{"password123", false},      // banned word and a sequence
+		{"aaaaaaaaaaaa", false},     // repeated
+		{"qwertyuiop12", false},     // keyboard run
+		{"maija.virtanen1", false},  // contains the email
+		{"Summer-Breeze-77", false}, // breached
+		{"kx8Lm2pQ", true},
+		{"correct horse battery staple", true},
+	} {
+		err := policy.Check(ctx, tc.password, "maija.virtanen@example.com")
+		if tc.ok && err != nil {
+			t.Errorf("%q rejected: %v", tc.password, err)
+		}
+		if !tc.ok && !errors.Is(err, auth.ErrPasswordPolicy) {
+			t.Errorf("%q accepted, score %d", tc.password, policy.Score(tc.password))
+		}
+	}
+}
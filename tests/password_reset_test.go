@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+// createResetToken stores a reset token the way RequestPasswordReset does, without the email
+func createResetToken(t *testing.T, user db.User, expiresAt time.Time) string {
+	t.Helper()
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get().CreatePasswordResetToken(context.Background(), db.CreatePasswordResetTokenParams{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestPasswordReset(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "reset@example.com")
+	session, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := createResetToken(t, user, time.Now().UTC().Add(time.Hour))
+
+	// A password the policy rejects leaves the token usable
+	if _, err := userService.ResetPassword(ctx, token, "password"); err == nil {
+		t.Fatal("weak password accepted")
+	}
+	if _, err := userService.ResetPassword(ctx, token, "Lantern-Quarry-58"); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := db.Get().GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.CheckPasswordHash("Lantern-Quarry-58", updated.PasswordHash) || auth.CheckPasswordHash("Kettle-Orbit-93", updated.PasswordHash) {
+		t.Error("password not changed")
+	}
+	if _, err := auth.RotateRefreshToken(ctx, session.RefreshToken); !errors.Is(err, auth.ErrRefreshTokenInvalid) {
+		t.Errorf("session survived the reset: %v", err)
+	}
+
+	if _, err := userService.ResetPassword(ctx, token, "Another-Pass-71"); !errors.Is(err, userService.ErrResetTokenInvalid) {
+		t.Errorf("token used twice: %v", err)
+	}
+	expired := createResetToken(t, user, time.Now().UTC().Add(-time.Minute))
+	if _, err := userService.ResetPassword(ctx, expired, "Another-Pass-71"); !errors.Is(err, userService.ErrResetTokenInvalid) {
+		t.Errorf("expired token accepted: %v", err)
+	}
+	if _, err := userService.ResetPassword(ctx, "unknown", "Another-Pass-71"); !errors.Is(err, userService.ErrResetTokenInvalid) {
+		t.Errorf("unknown token accepted: %v", err)
+	}
+}
+
+func TestPasswordResetRequestIgnoresUnknownAccounts(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	// Neither sends an email, and the response doesn't tell the cases apart
+	if err := userService.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("unknown address: %v", err)
+	}
+	oauthUser, err := userService.CreateUser(ctx, "", userService.CreateUserParams{Email: "oauth@example.com", Name: "OAuth"},
+		userService.OauthCreate{IsOAuth: true, EmailVerified: true, Provider: "google", ProviderID: "g-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := userService.RequestPasswordReset(ctx, oauthUser.Email); err != nil {
+		t.Errorf("account without a password: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/middleware"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "pat@example.com")
+
+	// The middleware of the protected routes in front of a handler that always succeeds
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler = middleware.EnforceTokenScopes()(handler)
+	handler = jwtauth.Authenticator(auth.GetTokenAuth())(handler)
+	handler = middleware.Verifier()(handler)
+	status := func(method, token string) int {
+		r := httptest.NewRequest(method, "/api/user/me", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	read, readToken, err := auth.CreatePersonalAccessToken(ctx, user, "ci", []string{auth.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, writeToken, err := auth.CreatePersonalAccessToken(ctx, user, "deploy", []string{auth.ScopeWrite}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := auth.CreatePersonalAccessToken(ctx, user, "admin", []string{auth.ScopeAdmin}, 0); err == nil {
+		t.Error("user without admin:access got an admin scoped token")
+	}
+
+	for _, tc := range []struct {
+		method, token string
+		want          int
+	}{
+		{http.MethodGet, readToken, http.StatusOK},
+		{http.MethodPost, readToken, http.StatusForbidden},
+		{http.MethodGet, writeToken, http.StatusOK}, // write implies read
+		{http.MethodDelete, writeToken, http.StatusOK},
+		{http.MethodGet, "pat_unknown", http.StatusUnauthorized},
+	} {
+		if got := status(tc.method, tc.token); got != tc.want {
+			t.Errorf("%s with %.12s: got %d, want %d", tc.method, tc.token, got, tc.want)
+		}
+	}
+
+	if err := auth.RevokePersonalAccessToken(ctx, user.ID, read.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(http.MethodGet, readToken); got != http.StatusUnauthorized {
+		t.Errorf("revoked token: got %d, want 401", got)
+	}
+	if _, err := auth.VerifyPersonalAccessToken(ctx, readToken); err == nil {
+		t.Error("revoked token verified")
+	}
+	if got := status(http.MethodGet, writeToken); got != http.StatusOK {
+		t.Errorf("revoking one token affected another: got %d", got)
+	}
+}
+
+func TestPersonalAccessTokensEndWithTheAccount(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "pat-reset@example.com")
+	session, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := auth.CreatePersonalAccessToken(ctx, user, "ci", []string{auth.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signing out the other devices leaves scripts alone
+	if err := auth.RevokeOtherSessions(ctx, user.ID, session.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.VerifyPersonalAccessToken(ctx, token); err != nil {
+		t.Fatalf("token revoked with the other sessions: %v", err)
+	}
+
+	if _, err := userService.ResetPassword(ctx, createResetToken(t, user, time.Now().UTC().Add(time.Hour)), "Lantern-Quarry-58"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.VerifyPersonalAccessToken(ctx, token); err == nil {
+		t.Error("token survived a password reset")
+	}
+
+	// Signing out everywhere revokes them too
+	_, token, err = auth.CreatePersonalAccessToken(ctx, user, "deploy", []string{auth.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.RevokeAllUserSessions(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.VerifyPersonalAccessToken(ctx, token); err == nil {
+		t.Error("token survived signing out everywhere")
+	}
+}
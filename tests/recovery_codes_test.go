@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user, _ := enrollTOTP(t, createTestUser(t, "codes@example.com"))
+
+	old, err := userService.GenerateRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(old) != userService.RecoveryCodeCount {
+		t.Fatalf("got %d codes", len(old))
+	}
+	codes, err := userService.GenerateRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Regenerating replaces the whole set
+	if err := userService.RedeemRecoveryCode(ctx, user.ID, old[0]); !errors.Is(err, userService.ErrRecoveryCodeInvalid) {
+		t.Errorf("code of the replaced set accepted: %v", err)
+	}
+	// Codes are accepted however they were typed from paper
+	if err := userService.RedeemRecoveryCode(ctx, user.ID, " "+strings.ToUpper(codes[0])+" "); err != nil {
+		t.Errorf("code typed in upper case rejected: %v", err)
+	}
+	if err := userService.RedeemRecoveryCode(ctx, user.ID, codes[0]); !errors.Is(err, userService.ErrRecoveryCodeInvalid) {
+		t.Errorf("code used twice: %v", err)
+	}
+	if left, err := db.Get().CountUnusedRecoveryCodes(ctx, user.ID); err != nil || left != int64(len(codes)-1) {
+		t.Errorf("%d codes left, %v", left, err)
+	}
+}
+
+func TestResetTwoFactor(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	admin := setTestUserRole(t, createTestUser(t, "reset-2fa-admin@example.com"), auth.Admin)
+	user, _ := enrollTOTP(t, createTestUser(t, "lost-device@example.com"))
+	codes, err := userService.GenerateRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reset, err := userService.ResetTwoFactor(ctx, admin.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.Get().GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset.Secret != "" || stored.Secret != "" {
+		t.Error("TOTP secret kept")
+	}
+	if left, err := db.Get().CountUnusedRecoveryCodes(ctx, user.ID); err != nil || left != 0 {
+		t.Errorf("%d recovery codes kept, %v", left, err)
+	}
+	if err := userService.RedeemRecoveryCode(ctx, user.ID, codes[0]); !errors.Is(err, userService.ErrRecoveryCodeInvalid) {
+		t.Errorf("recovery code works after the reset: %v", err)
+	}
+	if revoked, err := auth.IsTokenRevoked(ctx, accessTokenID(t, pending.AccessToken), pending.SessionID); err != nil || !revoked {
+		t.Errorf("session survived the reset: %v, %v", revoked, err)
+	}
+	// The user logs in with the password alone and enrolls again
+	pair, err := auth.IssueTokenPair(ctx, stored, auth.AMRPassword)
+	if err != nil || pair.MFAPending {
+		t.Errorf("login after the reset: pending %v, %v", pair.MFAPending, err)
+	}
+}
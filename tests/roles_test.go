@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+func TestRoleGraph(t *testing.T) {
+	g := auth.NewRoleGraph([]db.Role{
+		{Name: "user"},
+		{Name: "moderator", ParentRole: "user"},
+		{Name: "admin", ParentRole: "moderator"},
+		{Name: "loop_a", ParentRole: "loop_b"},
+		{Name: "loop_b", ParentRole: "loop_a"},
+	}, []db.RolePermission{
+		{Role: "user", Permission: "posts:write"},
+		{Role: "moderator", Permission: "users:read"},
+		{Role: "admin", Permission: "users:write"},
+		{Role: "admin", Permission: "users:read"},
+		{Role: "loop_a", Permission: "a:read"},
+		{Role: "loop_b", Permission: "b:read"},
+	})
+
+	if got, want := g.Permissions("admin"), []string{"posts:write", "users:read", "users:write"}; !slices.Equal(got, want) {
+		t.Errorf("admin permissions %v, want %v", got, want)
+	}
+	if g.Has("moderator", "users:write") {
+		t.Error("moderator inherited a permission of its child")
+	}
+	if !g.Inherits("admin", "user") || g.Inherits("user", "admin") {
+		t.Error("wrong inheritance between admin and user")
+	}
+	if got := g.Permissions("loop_a"); !slices.Equal(got, []string{"a:read", "b:read"}) {
+		t.Errorf("cyclic role permissions %v", got)
+	}
+	if g.Permissions("missing") != nil || g.Exists("missing") {
+		t.Error("unknown role has permissions")
+	}
+}
+
+func TestSuspendRequiresHigherRole(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	admin := setTestUserRole(t, createTestUser(t, "rank-admin@example.com"), auth.Admin)
+	moderator := setTestUserRole(t, createTestUser(t, "rank-mod@example.com"), auth.Moderator)
+	peer := setTestUserRole(t, createTestUser(t, "rank-peer@example.com"), auth.Moderator)
+
+	for _, target := range []string{admin.ID, peer.ID} {
+		if _, err := userService.SuspendUser(ctx, moderator.ID, target, "", nil); !errors.Is(err, userService.ErrCannotSuspendStaff) {
+			t.Errorf("moderator suspended %s: %v", target, err)
+		}
+	}
+	if _, err := userService.SuspendUser(ctx, admin.ID, peer.ID, "", nil); err != nil {
+		t.Errorf("admin can't suspend a moderator: %v", err)
+	}
+	if _, err := userService.UnsuspendUser(ctx, moderator.ID, peer.ID); !errors.Is(err, userService.ErrCannotSuspendStaff) {
+		t.Errorf("moderator unsuspended a peer: %v", err)
+	}
+}
+
+func TestAssignRoleRequiresHigherRole(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	admin := setTestUserRole(t, createTestUser(t, "assign-admin@example.com"), auth.Admin)
+	moderator := setTestUserRole(t, createTestUser(t, "assign-mod@example.com"), auth.Moderator)
+	peer := setTestUserRole(t, createTestUser(t, "assign-peer@example.com"), auth.Moderator)
+	user := createTestUser(t, "assign-user@example.com")
+	// A sibling of moderator, not part of the moderator's or the admin's role
+	if _, err := userService.CreateRole(ctx, "support", "", auth.User); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []db.User{admin, peer} {
+		if _, err := userService.AssignRole(ctx, moderator.ID, target.ID, auth.User); !errors.Is(err, userService.ErrCannotChangeStaffRole) {
+			t.Errorf("moderator changed the role of a %s: %v", target.Role, err)
+		}
+	}
+	for _, role := range []string{auth.Admin, "support"} {
+		if _, err := userService.AssignRole(ctx, moderator.ID, user.ID, role); !errors.Is(err, userService.ErrRoleAboveOwn) {
+			t.Errorf("moderator assigned %s: %v", role, err)
+		}
+	}
+	if _, err := userService.AssignRole(ctx, moderator.ID, user.ID, auth.Moderator); err != nil {
+		t.Errorf("moderator can't assign their own role: %v", err)
+	}
+	if _, err := userService.AssignRole(ctx, admin.ID, peer.ID, "support"); !errors.Is(err, userService.ErrRoleAboveOwn) {
+		t.Errorf("admin assigned a role outside their own: %v", err)
+	}
+	if _, err := userService.AssignRole(ctx, admin.ID, peer.ID, auth.User); err != nil {
+		t.Errorf("admin can't demote a moderator: %v", err)
+	}
+}
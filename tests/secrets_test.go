@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nikojunttila/community/internal/auth"
+)
+
+func TestSealSecretRoundTrip(t *testing.T) {
+	oldKey, _ := auth.GenerateSecretKey()
+	newKey, _ := auth.GenerateSecretKey()
+	t.Setenv("SECRET_ENCRYPTION_KEYS", "old:"+oldKey)
+	if err := auth.LoadSecretKeys(); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := auth.SealSecret("user-1", "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "JBSWY3DPEHPK3PXP") || !auth.IsSealedWithActiveKey(sealed) {
+		t.Fatalf("unexpected sealed value %q", sealed)
+	}
+
+	// Rotating keeps old secrets readable
+	t.Setenv("SECRET_ENCRYPTION_KEYS", "new:"+newKey+",old:"+oldKey)
+	if err := auth.LoadSecretKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if auth.IsSealedWithActiveKey(sealed) {
+		t.Error("secret sealed with the old key reported as active")
+	}
+	plain, err := auth.OpenSecret("user-1", sealed)
+	if err != nil || plain != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	if _, err := auth.OpenSecret("user-2", sealed); err == nil {
+		t.Error("secret opened for a different owner")
+	}
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/db"
+)
+
+func TestSignOutEverywhereRevokesCurrentToken(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "signout@example.com")
+
+	current, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jti := accessTokenID(t, current.AccessToken)
+	if revoked, err := auth.IsTokenRevoked(ctx, jti, current.SessionID); err != nil || revoked {
+		t.Fatalf("fresh access token revoked: %v, %v", revoked, err)
+	}
+
+	if err := auth.RevokeAllUserSessions(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	// The token that made the request is denied right away, not when it expires
+	if revoked, err := auth.IsTokenRevoked(ctx, jti, current.SessionID); err != nil || !revoked {
+		t.Errorf("current access token still accepted: %v, %v", revoked, err)
+	}
+	if denied, err := db.Get().CountRevokedAccessTokens(ctx, jti); err != nil || denied != 1 {
+		t.Errorf("current access token wasn't denylisted: %d, %v", denied, err)
+	}
+	if _, err := auth.RotateRefreshToken(ctx, other.RefreshToken); !errors.Is(err, auth.ErrRefreshTokenInvalid) {
+		t.Errorf("refresh token of another device: got %v", err)
+	}
+	if sessions, err := auth.ListSessions(ctx, user.ID); err != nil || len(sessions) != 0 {
+		t.Errorf("sessions left after signing out everywhere: %d, %v", len(sessions), err)
+	}
+}
+
+func TestSignOutOtherSessionsKeepsCurrent(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "signout-others@example.com")
+
+	current, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.RevokeOtherSessions(ctx, user.ID, current.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := auth.IsTokenRevoked(ctx, accessTokenID(t, current.AccessToken), current.SessionID); err != nil || revoked {
+		t.Errorf("current session signed out: %v, %v", revoked, err)
+	}
+	if revoked, err := auth.IsTokenRevoked(ctx, accessTokenID(t, other.AccessToken), other.SessionID); err != nil || !revoked {
+		t.Errorf("other session still signed in: %v, %v", revoked, err)
+	}
+	sessions, err := auth.ListSessions(ctx, user.ID)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != current.SessionID {
+		t.Errorf("sessions left %+v, %v", sessions, err)
+	}
+	// Another user's session can't be revoked through this user
+	stranger := createTestUser(t, "stranger@example.com")
+	if err := auth.RevokeUserSession(ctx, stranger.ID, current.SessionID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("revoked another user's session: %v", err)
+	}
+}
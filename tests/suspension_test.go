@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nikojunttila/community/internal/auth"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+func TestSuspendUser(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	admin := setTestUserRole(t, createTestUser(t, "suspend-admin@example.com"), auth.Admin)
+	user := createTestUser(t, "suspended@example.com")
+	session, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suspended, err := userService.SuspendUser(ctx, admin.ID, user.ID, "spam", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsSuspended(suspended) {
+		t.Error("user not suspended")
+	}
+	if _, err := auth.RotateRefreshToken(ctx, session.RefreshToken); !errors.Is(err, auth.ErrRefreshTokenInvalid) {
+		t.Errorf("session survived the suspension: %v", err)
+	}
+	if _, err := auth.IssueTokenPair(ctx, suspended, auth.AMRPassword); !errors.Is(err, auth.ErrUserSuspended) {
+		t.Errorf("suspended user logged in: %v", err)
+	}
+	if _, err := userService.SuspendUser(ctx, admin.ID, admin.ID, "", nil); !errors.Is(err, userService.ErrCannotSuspendSelf) {
+		t.Errorf("admin suspended themselves: %v", err)
+	}
+
+	unsuspended, err := userService.UnsuspendUser(ctx, admin.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.IsSuspended(unsuspended) {
+		t.Error("user still suspended")
+	}
+	if _, err := auth.IssueTokenPair(ctx, unsuspended, auth.AMRPassword); err != nil {
+		t.Errorf("unsuspended user can't log in: %v", err)
+	}
+}
+
+func TestTemporarySuspensionLiftsItself(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	admin := setTestUserRole(t, createTestUser(t, "temp-admin@example.com"), auth.Admin)
+	user := createTestUser(t, "temp@example.com")
+
+	until := time.Now().Add(time.Hour)
+	suspended, err := userService.SuspendUser(ctx, admin.ID, user.ID, "cool off", &until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsSuspended(suspended) {
+		t.Fatal("user not suspended")
+	}
+	suspended.SuspendedUntil.Time = time.Now().Add(-time.Second)
+	if auth.IsSuspended(suspended) {
+		t.Error("suspension still applies after its end time")
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikojunttila/community/internal/auth"
+	"github.com/nikojunttila/community/internal/cache"
+	"github.com/nikojunttila/community/internal/db"
+	userService "github.com/nikojunttila/community/internal/services/user"
+)
+
+var authSetup sync.Once
+
+// setupTestDB points db.Get at a fresh sqlite database with every migration applied and
+// sets up auth with throwaway keys
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	migrations, err := filepath.Glob("../sql/schema/*.sql")
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	for _, migration := range migrations {
+		raw, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(raw), "-- +goose Down")
+		if _, err := conn.Exec(up); err != nil {
+			t.Fatalf("failed to apply %s: %v", migration, err)
+		}
+	}
+
+	db.Init(db.Config{Driver: "sqlite3", Name: path})
+	t.Cleanup(func() { db.Conn().Close() })
+	auth.InvalidatePermissions() // roles are cached from the previous database
+
+	authSetup.Do(func() {
+		key, err := auth.GenerateSecretKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The keys are read once by auth.Setup, the directory can go with the first test
+		keyDir := t.TempDir()
+		if _, err := auth.GenerateJWTKey(keyDir, "EdDSA"); err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range map[string]string{
+			"APP_URL":                "http://localhost:3000",
+			"JWT_SECRET":             "test-jwt-secret",
+			"JWT_KEY_DIR":            keyDir,
+			"OAUTH_KEY":              "test-oauth-key",
+			"OAUTH_PROVIDERS":        "github",
+			"OAUTH_GITHUB_CLIENT":    "test-client",
+			"OAUTH_GITHUB_SECRET":    "test-secret",
+			"PROD":                   "false",
+			"SECRET_ENCRYPTION_KEYS": "test:" + key,
+		} {
+			os.Setenv(name, value)
+		}
+		auth.Setup()
+		cache.SetupUserCache()
+	})
+	// Other tests load their own keys
+	if err := auth.LoadSecretKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createTestUser stores an email/password user whose address is not verified yet
+func createTestUser(t *testing.T, email string) db.User {
+	t.Helper()
+	user, err := userService.CreateUser(context.Background(), "Kettle-Orbit-93", userService.CreateUserParams{
+		Email:   email,
+		Name:    "Test User",
+		Service: "email",
+	}, userService.OauthCreate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// setTestUserRole changes the user's role and returns the stored user
+func setTestUserRole(t *testing.T, user db.User, role string) db.User {
+	t.Helper()
+	ctx := context.Background()
+	if err := db.Get().UpdateUserRole(ctx, db.UpdateUserRoleParams{Role: role, UpdatedAt: time.Now(), ID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.Get().GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nikojunttila/community/internal/auth"
+)
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "refresh@example.com")
+
+	first, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auth.RotateRefreshToken(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.SessionID != first.SessionID || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("rotation didn't stay in the family: %s -> %s", first.SessionID, second.SessionID)
+	}
+
+	// Presenting the rotated token again kills the tokens issued after it too
+	if _, err := auth.RotateRefreshToken(ctx, first.RefreshToken); !errors.Is(err, auth.ErrRefreshTokenReused) {
+		t.Fatalf("reused token: got %v", err)
+	}
+	if _, err := auth.RotateRefreshToken(ctx, second.RefreshToken); !errors.Is(err, auth.ErrRefreshTokenInvalid) {
+		t.Errorf("successor of the reused token: got %v", err)
+	}
+	jti := accessTokenID(t, second.AccessToken)
+	if revoked, err := auth.IsTokenRevoked(ctx, jti, second.SessionID); err != nil || !revoked {
+		t.Errorf("access token of the revoked family accepted: %v, %v", revoked, err)
+	}
+}
+
+func accessTokenID(t *testing.T, accessToken string) string {
+	t.Helper()
+	token, err := auth.VerifyToken(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.JwtID()
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	setupTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "logout@example.com")
+
+	pair, err := auth.IssueTokenPair(ctx, user, auth.AMRPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.VerifyToken(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.RevokeAccessToken(ctx, token.JwtID(), token.Expiration()); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := auth.IsTokenRevoked(ctx, token.JwtID(), pair.SessionID); err != nil || !revoked {
+		t.Errorf("revoked access token accepted: %v, %v", revoked, err)
+	}
+	if err := auth.RevokeRefreshToken(ctx, pair.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.RotateRefreshToken(ctx, pair.RefreshToken); !errors.Is(err, auth.ErrRefreshTokenInvalid) {
+		t.Errorf("refresh token usable after logout: %v", err)
+	}
+	if _, err := auth.RotateRefreshToken(ctx, "unknown"); !errors.Is(err, auth.ErrRefreshTokenInvalid) {
+		t.Errorf("unknown refresh token: %v", err)
+	}
+}